@@ -5,11 +5,21 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
 
 	"github.com/PundarikakshNTripathi/Kortex/internal/adapters/agent"
+	"github.com/PundarikakshNTripathi/Kortex/internal/config"
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
 	"github.com/PundarikakshNTripathi/Kortex/internal/infra/browser"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/hitl"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/logger"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/redact"
 	"github.com/PundarikakshNTripathi/Kortex/internal/infra/sqlite"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/tracing"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/urlpolicy"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/vault"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -22,6 +32,13 @@ type App struct {
 	agent       *agent.AgentAdapter
 	browser     *browser.PlaywrightBrowser
 	vectorStore *sqlite.SQLiteVectorStore
+	approvals   *hitl.Broker                // Shows approval requests and questions in the UI and hands the answers back to the agent
+	secrets     *vault.Vault                // Encrypted credentials, typed into pages as {{secret:site.key}}
+	harDir      string                      // If set, each task's network traffic is recorded to a HAR file here
+	recorder    *logger.FlightRecorder      // The black box: every step of every task
+	traces      func(context.Context) error // Flushes buffered trace spans on shutdown
+	records     *sqlite.RecordIndex         // Searchable copy of the flight recorder, for browsing past tasks
+	sessionID   string                      // Every task of this app run shares one session, so their cost adds up
 	mu          sync.Mutex
 }
 
@@ -40,9 +57,10 @@ func (a *App) startup(ctx context.Context) {
 		log.Println("No .env file found, using system environment variables")
 	}
 
-	apiKey := os.Getenv("GOOGLE_API_KEY")
-	if apiKey == "" {
-		a.emitLog("ERROR", "GOOGLE_API_KEY not set. Please create a .env file with your API key.")
+	// Gemini needs an API key; an OpenAI-compatible server is configured with OPENAI_* instead
+	apiKey, err := config.APIKey()
+	if err != nil {
+		a.emitLog("ERROR", err.Error())
 		return
 	}
 
@@ -51,6 +69,18 @@ func (a *App) startup(ctx context.Context) {
 	// This lets the user see exactly what the agent is doing.
 	a.emitLog("INIT", "Initializing Playwright browser...")
 	browserInstance := browser.NewPlaywrightBrowser()
+	if err := config.Browser(browserInstance); err != nil {
+		a.emitLog("ERROR", err.Error())
+		return
+	}
+
+	// URL policy: every navigation (and every request the page makes) is checked against it.
+	guard, err := urlpolicy.NewGuardedBrowser(browserInstance, config.URLPolicy())
+	if err != nil {
+		a.emitLog("ERROR", fmt.Sprintf("Invalid URL policy: %v", err))
+		return
+	}
+
 	if err := browserInstance.Init(false); err != nil {
 		a.emitLog("ERROR", fmt.Sprintf("Failed to initialize browser: %v", err))
 		return
@@ -58,12 +88,20 @@ func (a *App) startup(ctx context.Context) {
 	a.browser = browserInstance
 	a.emitLog("INIT", "Browser initialized successfully ✓")
 
+	// Optional: serve every page from a previously recorded HAR instead of the network.
+	if harReplay := os.Getenv("HAR_REPLAY"); harReplay != "" {
+		if err := a.browser.StartReplay(harReplay); err != nil {
+			a.emitLog("ERROR", fmt.Sprintf("Failed to start HAR replay: %v", err))
+			return
+		}
+		a.emitLog("INIT", fmt.Sprintf("Replaying network traffic from %s (offline) ✓", harReplay))
+	} else {
+		a.harDir = os.Getenv("HAR_DIR")
+	}
+
 	// 3. Initialize Vector Store
 	a.emitLog("INIT", "Initializing vector store...")
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./kortex.db"
-	}
+	dbPath := config.DBPath()
 	vectorStore, err := sqlite.NewSQLiteVectorStore(dbPath)
 	if err != nil {
 		a.emitLog("ERROR", fmt.Sprintf("Failed to initialize vector store: %v", err))
@@ -72,9 +110,73 @@ func (a *App) startup(ctx context.Context) {
 	a.vectorStore = vectorStore
 	a.emitLog("INIT", "Vector store initialized successfully ✓")
 
+	// Personal data is scrubbed from the flight recorder and memory (and optionally from pages)
+	redactor, err := redact.NewFromFile(os.Getenv("REDACT_PATTERNS_FILE"))
+	if err != nil {
+		a.emitLog("ERROR", fmt.Sprintf("Invalid redaction patterns: %v", err))
+		return
+	}
+	redact.SetDefault(redactor)
+	a.vectorStore.SetRedactor(redactor)
+
+	// Tracing: spans for every task, model turn and tool call (off unless OTEL_TRACES_EXPORTER is set)
+	a.traces, err = tracing.Setup(context.Background(), tracing.Options{
+		Exporter: os.Getenv("OTEL_TRACES_EXPORTER"),
+		File:     os.Getenv("OTEL_TRACES_FILE"),
+	})
+	if err != nil {
+		a.emitLog("ERROR", fmt.Sprintf("Failed to set up tracing: %v", err))
+		return
+	}
+
+	// Flight recorder (The Black Box), indexed into SQLite so past tasks can be browsed
+	records, err := sqlite.NewRecordIndex(dbPath)
+	if err != nil {
+		a.emitLog("ERROR", fmt.Sprintf("Failed to open flight recorder index: %v", err))
+		return
+	}
+	a.records = records
+	recorder, err := config.FlightRecorder(redactor, records)
+	if err != nil {
+		a.emitLog("ERROR", fmt.Sprintf("Failed to open flight recorder: %v", err))
+		return
+	}
+	a.recorder = recorder
+
 	// 4. Initialize Agent
 	a.emitLog("INIT", "Initializing Kortex agent...")
-	a.agent = agent.NewAgent(a.browser, a.vectorStore, apiKey)
+	a.approvals = config.Broker()
+	a.approvals.SetNotifier(func(req domain.HumanRequest) error {
+		if req.Kind == "plan" {
+			a.emitLog("PLANNING", "📋 Plan ready for review")
+			if a.ctx != nil {
+				runtime.EventsEmit(a.ctx, "kortex:plan-review", req)
+			}
+			return nil
+		}
+		if req.Kind == "question" {
+			a.emitLog("QUESTION", fmt.Sprintf("❓ %s", req.Message))
+			if a.ctx != nil {
+				runtime.EventsEmit(a.ctx, "kortex:question", req)
+			}
+			return nil
+		}
+		a.emitLog("APPROVAL", fmt.Sprintf("✋ Approval needed: %s (%s)", req.Message, req.Reason))
+		if a.ctx != nil {
+			runtime.EventsEmit(a.ctx, "kortex:approval", req)
+		}
+		return nil
+	})
+	// Approvals, secrets, budgets, the model, limits, retries, the context window and planning
+	// Plan updates are also sent to the UI as they happen, so it can tick off the steps
+	setup, err := config.AgentOptions(a.approvals, logger.Tee(a.recorder, planEvents{a}), redactor, dbPath)
+	if err != nil {
+		a.emitLog("ERROR", err.Error())
+		return
+	}
+	a.secrets = setup.Secrets
+	a.sessionID = uuid.New().String()
+	a.agent = agent.NewAgent(guard, a.vectorStore, apiKey, setup.Options...)
 	a.emitLog("INIT", "🚀 Kortex agent ready! Awaiting your command...")
 }
 
@@ -83,7 +185,18 @@ func (a *App) startup(ctx context.Context) {
 func (a *App) shutdown(ctx context.Context) {
 	if a.browser != nil {
 		a.emitLog("SHUTDOWN", "Closing browser...")
-		// Browser cleanup would go here if needed
+		// Closing also flushes any HAR recording that is still in progress
+		if err := a.browser.Close(); err != nil {
+			log.Printf("Error closing browser: %v", err)
+		}
+	}
+	if a.recorder != nil {
+		a.recorder.Close()
+	}
+	if a.traces != nil {
+		if err := a.traces(ctx); err != nil {
+			log.Printf("Error flushing traces: %v", err)
+		}
 	}
 }
 
@@ -104,11 +217,42 @@ func (a *App) SendPrompt(prompt string) string {
 
 		a.emitLog("PLANNING", "🧠 Analyzing task and preparing execution plan...")
 
+		// One ID ties together this task's flight recorder entries and HAR file
+		taskID := uuid.New().String()
+
+		// Record the task's network traffic so a failure can be replayed offline later
+		if a.harDir != "" {
+			harPath := filepath.Join(a.harDir, taskID+".har")
+			if err := a.browser.StartRecording(harPath); err != nil {
+				a.emitLog("ERROR", fmt.Sprintf("Failed to start HAR recording: %v", err))
+			} else {
+				defer func() {
+					if err := a.browser.StopRecording(); err != nil {
+						a.emitLog("ERROR", fmt.Sprintf("Failed to save HAR recording: %v", err))
+						return
+					}
+					a.emitLog("INFO", fmt.Sprintf("Network traffic saved to %s", harPath))
+				}()
+			}
+		}
+
+		// Start counting blocked/mocked requests afresh for this task
+		a.browser.NetworkStats(true)
+		defer func() {
+			a.emitLog("INFO", fmt.Sprintf("🌐 Network: %s", a.browser.NetworkStats(false)))
+		}()
+
 		// Create a custom context for the agent execution
-		agentCtx := context.Background()
+		agentCtx := logger.WithSessionID(logger.WithTaskID(context.Background(), taskID), a.sessionID)
+		// Model retries and fallbacks show up in Mission Control as they happen
+		agentCtx = agent.WithTaskEvents(agentCtx, func(rec domain.FlightRecord) {
+			a.emitLog("MODEL", agent.DescribeRecovery(rec))
+		})
 
 		// Execute the task
-		err := a.agent.ExecuteTask(agentCtx, prompt)
+		result, err := a.agent.Execute(agentCtx, prompt)
+		a.emitLog("INFO", fmt.Sprintf("🪙 Usage: %d tokens in %d model calls, $%.4f",
+			result.Usage.TotalTokens, result.Usage.ModelCalls, result.Usage.CostUSD))
 		if err != nil {
 			a.emitLog("ERROR", fmt.Sprintf("❌ Task execution failed: %v", err))
 			return
@@ -120,6 +264,132 @@ func (a *App) SendPrompt(prompt string) string {
 	return "Task started. Watch the Mission Control for updates."
 }
 
+// RespondApproval is exposed to the frontend.
+// It answers an approval request previously sent as a "kortex:approval" event.
+func (a *App) RespondApproval(id string, approved bool) string {
+	if a.approvals == nil {
+		return "Error: Agent not initialized."
+	}
+	if err := a.approvals.Respond(domain.HumanResponse{ID: id, Kind: "approval", Approved: approved}); err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	if approved {
+		a.emitLog("APPROVAL", "👍 Action approved")
+	} else {
+		a.emitLog("APPROVAL", "🛑 Action declined")
+	}
+	return "OK"
+}
+
+// AnswerQuestion is exposed to the frontend.
+// It answers a clarifying question previously sent as a "kortex:question" event.
+func (a *App) AnswerQuestion(id string, answer string) string {
+	if a.approvals == nil {
+		return "Error: Agent not initialized."
+	}
+	if err := a.approvals.Respond(domain.HumanResponse{ID: id, Kind: "question", Answer: answer}); err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	a.emitLog("USER", fmt.Sprintf("💬 %s", answer))
+	return "OK"
+}
+
+// RespondPlan is exposed to the frontend.
+// It approves or rejects the plan previously sent as a "kortex:plan-review" event.
+// steps is the user's edited list of steps; empty keeps the plan as it is.
+func (a *App) RespondPlan(id string, approved bool, steps []string) string {
+	if a.approvals == nil {
+		return "Error: Agent not initialized."
+	}
+	resp := domain.HumanResponse{ID: id, Kind: "plan", Approved: approved}
+	if len(steps) > 0 {
+		plan := domain.Plan{}
+		for i, step := range steps {
+			plan.Steps = append(plan.Steps, domain.PlanStep{Number: i + 1, Description: step, Status: agent.StepPending})
+		}
+		resp.Plan = &plan
+	}
+	if err := a.approvals.Respond(resp); err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	if approved {
+		a.emitLog("PLANNING", "👍 Plan approved")
+	} else {
+		a.emitLog("PLANNING", "🛑 Plan rejected")
+	}
+	return "OK"
+}
+
+// planEvents forwards the agent's "plan" flight records to the frontend as
+// "kortex:plan" events, so the plan's progress can be shown live.
+type planEvents struct{ app *App }
+
+func (p planEvents) Record(ctx context.Context, rec domain.FlightRecord) error {
+	if rec.Kind == "plan" && p.app.ctx != nil {
+		runtime.EventsEmit(p.app.ctx, "kortex:plan", rec.Details)
+	}
+	return nil
+}
+
+// ListSecrets is exposed to the frontend.
+// It returns the names of stored secrets; values never leave the Go side.
+func (a *App) ListSecrets() []domain.SecretRef {
+	if a.secrets == nil {
+		return nil
+	}
+	return a.secrets.List()
+}
+
+// SetSecret is exposed to the frontend. It adds or replaces a secret in the vault.
+func (a *App) SetSecret(site, key, value string) string {
+	if a.secrets == nil {
+		return "Error: Secrets vault not initialized."
+	}
+	if err := a.secrets.Set(site, key, value); err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	a.emitLog("INIT", fmt.Sprintf("🔐 Saved secret {{secret:%s.%s}}", site, key))
+	return "OK"
+}
+
+// DeleteSecret is exposed to the frontend. It removes a secret from the vault.
+func (a *App) DeleteSecret(site, key string) string {
+	if a.secrets == nil {
+		return "Error: Secrets vault not initialized."
+	}
+	if err := a.secrets.Delete(site, key); err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	a.emitLog("INIT", fmt.Sprintf("🗑️ Deleted secret {{secret:%s.%s}}", site, key))
+	return "OK"
+}
+
+// ListTasks is exposed to the frontend. It returns the most recent tasks from the flight recorder index.
+func (a *App) ListTasks(limit int) []domain.TaskSummary {
+	if a.records == nil {
+		return nil
+	}
+	tasks, err := a.records.Tasks(context.Background(), limit)
+	if err != nil {
+		log.Printf("Failed to list tasks: %v", err)
+		return nil
+	}
+	return tasks
+}
+
+// GetTaskTimeline is exposed to the frontend. It returns every recorded step of one task, in order.
+func (a *App) GetTaskTimeline(taskID string) []domain.FlightRecord {
+	if a.records == nil {
+		return nil
+	}
+	timeline, err := a.records.Timeline(context.Background(), taskID)
+	if err != nil {
+		log.Printf("Failed to load task %s: %v", taskID, err)
+		return nil
+	}
+	return timeline
+}
+
 // emitLog sends a log event to the frontend.
 // The React frontend listens for "kortex:log" events and updates the terminal.
 func (a *App) emitLog(level, message string) {
@@ -0,0 +1,244 @@
+// Command kortex is the command-line companion to the Kortex desktop app and web server.
+//
+// Usage:
+//
+//	kortex secrets list
+//	kortex secrets set <site> <key>      (the value is read from stdin, so it stays out of shell history)
+//	kortex secrets get <site> <key>
+//	kortex secrets delete <site> <key>
+//	kortex secrets otp <site>            (prints the current 2FA code from the site's "totp" seed)
+//	kortex index <file>...               (adds flight recorder files to the searchable index in DB_PATH)
+//	kortex replay <file>                 (lists the tasks in a flight recorder file)
+//	kortex replay <file> --task <id> [--headless] [--har <file>] [--stop-on-diverge]
+//
+// replay re-runs a recorded task's tool calls in a real browser, without the LLM,
+// and reports the first step where the page no longer behaves like it did.
+//
+// The vault location and passphrase come from VAULT_PATH and VAULT_PASSPHRASE,
+// the same variables the app reads, so both always see the same secrets.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/adapters/replay"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/browser"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/logger"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/sqlite"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/vault"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	godotenv.Load()
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "secrets":
+		err = runSecrets(os.Args[2:])
+	case "index":
+		err = runIndex(os.Args[2:])
+	case "replay":
+		err = runReplay(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage:
+  kortex secrets list
+  kortex secrets set <site> <key>
+  kortex secrets get <site> <key>
+  kortex secrets delete <site> <key>
+  kortex secrets otp <site>
+  kortex index <file>...
+  kortex replay <file> [--task <id>] [--headless] [--har <file>] [--stop-on-diverge]`)
+	os.Exit(2)
+}
+
+// runSecrets manages the encrypted secrets vault.
+func runSecrets(args []string) error {
+	if len(args) == 0 {
+		usage()
+	}
+	v, err := vault.Open(os.Getenv("VAULT_PATH"), os.Getenv("VAULT_PASSPHRASE"))
+	if err != nil {
+		return err
+	}
+
+	cmd, rest := args[0], args[1:]
+	switch {
+	case cmd == "list":
+	case cmd == "otp" && len(rest) == 1:
+	case len(rest) != 2:
+		usage()
+	}
+
+	switch cmd {
+	case "list":
+		for _, ref := range v.List() {
+			fmt.Printf("{{secret:%s.%s}}\n", ref.Site, ref.Key)
+		}
+		return nil
+	case "set":
+		fmt.Fprintf(os.Stderr, "Value for %s.%s: ", rest[0], rest[1])
+		value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && value == "" {
+			return fmt.Errorf("could not read value: %w", err)
+		}
+		if err := v.Set(rest[0], rest[1], strings.TrimRight(value, "\r\n")); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "✓ Saved. Use it as {{secret:%s.%s}}\n", rest[0], rest[1])
+		return nil
+	case "get":
+		value, err := v.Get(rest[0], rest[1])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	case "otp":
+		code, err := v.OTP(rest[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(code)
+		return nil
+	case "delete":
+		if err := v.Delete(rest[0], rest[1]); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "✓ Deleted")
+		return nil
+	default:
+		usage()
+		return nil
+	}
+}
+
+// runIndex loads flight recorder files (including rotated .gz ones) into the
+// SQLite index, so tasks recorded before indexing existed can be searched too.
+// Records already in the index are skipped, so running it twice is harmless.
+func runIndex(files []string) error {
+	if len(files) == 0 {
+		usage()
+	}
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./kortex.db"
+	}
+	index, err := sqlite.NewRecordIndex(dbPath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		records, err := logger.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := index.Index(context.Background(), records); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "✓ %s: %d records\n", file, len(records))
+	}
+	return nil
+}
+
+// runReplay re-executes a recorded task against a fresh browser.
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	taskID := fs.String("task", "", "ID of the task to replay (omit to list tasks)")
+	headless := fs.Bool("headless", false, "Run the browser without a window")
+	har := fs.String("har", "", "Serve network traffic from this HAR file instead of the live site")
+	stop := fs.Bool("stop-on-diverge", false, "Stop at the first step that doesn't match the recording")
+
+	// Allow flags before or after the file name
+	var file string
+	for len(args) > 0 {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			break
+		}
+		if file != "" {
+			usage()
+		}
+		file, args = fs.Arg(0), fs.Args()[1:]
+	}
+	if file == "" {
+		usage()
+	}
+
+	records, err := logger.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	if *taskID == "" {
+		for _, t := range replay.Tasks(records) {
+			status := "✓"
+			if t.Error != "" {
+				status = "✗"
+			} else if !t.Done {
+				status = "…"
+			}
+			fmt.Printf("%s %s  %3d steps  %s\n", status, t.TaskID, t.Steps, t.Goal)
+		}
+		return nil
+	}
+
+	opts := replay.Options{StopOnDivergence: *stop}
+	v, err := vault.Open(os.Getenv("VAULT_PATH"), os.Getenv("VAULT_PASSPHRASE"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Vault unavailable, steps that type secrets will fail: %v\n", err)
+	} else {
+		opts.Secrets, opts.OTP = v, v
+	}
+
+	b := browser.NewPlaywrightBrowser()
+	if err := b.Init(*headless); err != nil {
+		return fmt.Errorf("could not start browser: %w", err)
+	}
+	defer b.Close()
+	if *har != "" {
+		if err := b.StartReplay(*har); err != nil {
+			return err
+		}
+	}
+
+	report, err := replay.Run(context.Background(), b, records, *taskID, opts)
+	if report != nil {
+		for _, s := range report.Steps {
+			icon := map[string]string{replay.StatusOK: "✓", replay.StatusDiverged: "✗", replay.StatusSkipped: "–"}[s.Status]
+			fmt.Printf("%s step %d %s %v\n", icon, s.Step, s.Tool, s.Args)
+			if s.Reason != "" {
+				fmt.Printf("    %s\n", s.Reason)
+			}
+			if s.Status == replay.StatusDiverged {
+				fmt.Printf("    expected: %s\n    got:      %s\n", s.Expected, s.Got)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if d := report.Diverged(); d != nil {
+		return fmt.Errorf("replay diverged at step %d (%s)", d.Step, d.Tool)
+	}
+	fmt.Fprintln(os.Stderr, "✓ Replay matched the recording")
+	return nil
+}
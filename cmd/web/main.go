@@ -4,20 +4,38 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/PundarikakshNTripathi/Kortex/internal/adapters/agent"
+	"github.com/PundarikakshNTripathi/Kortex/internal/config"
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
 	"github.com/PundarikakshNTripathi/Kortex/internal/infra/browser"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/hitl"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/logger"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/metrics"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/redact"
 	"github.com/PundarikakshNTripathi/Kortex/internal/infra/sqlite"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/tracing"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/urlpolicy"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
+	fiberlogger "github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // KortexCore holds the initialized components of the system.
@@ -26,12 +44,50 @@ type KortexCore struct {
 	agent       *agent.AgentAdapter
 	browser     *browser.PlaywrightBrowser
 	vectorStore *sqlite.SQLiteVectorStore
-	mu          sync.Mutex // Mutex to prevent race conditions if multiple requests come in
+	guard       *urlpolicy.GuardedBrowser // The browser as the agent sees it: every URL checked against policy
+	approvals   *hitl.Broker              // Routes approval requests and questions to the client and answers back to the agent
+	harDir      string                    // If set, each task's network traffic is recorded to a HAR file here
+	recorder    *logger.FlightRecorder    // The black box: every step of every task
+	records     *sqlite.RecordIndex       // Searchable copy of the flight recorder, for the timeline API
+	metrics     *metrics.Metrics          // Prometheus counters served on /metrics
+	usage       *sqlite.UsageStore        // Token usage and cost of every task
+	mu          sync.Mutex                // Mutex to prevent race conditions if multiple requests come in
 }
 
 // WebSocketMessage defines the structure of JSON messages sent by the client.
+// Messages without a type start a new task; "approval_response" answers a pending approval
+// request, "question_response" answers a question the agent asked and "plan_response"
+// approves (possibly edited) or rejects the plan of a task.
 type WebSocketMessage struct {
-	Goal string `json:"goal"` // The user's instruction, e.g., "Find flights to Tokyo"
+	Type     string              `json:"type,omitempty"`     // "", "approval_response", "question_response" or "plan_response"
+	Goal     string              `json:"goal"`               // The user's instruction, e.g., "Find flights to Tokyo"
+	Policy   *urlpolicy.Policy   `json:"policy,omitempty"`   // Optional extra URL restrictions for this task only
+	Model    *domain.ModelConfig `json:"model,omitempty"`    // Optional model for this task only (provider, model, temperature, max_tokens)
+	ID       string              `json:"id,omitempty"`       // Which request is being answered
+	Approved bool                `json:"approved,omitempty"` // The user's decision (approval_response, plan_response)
+	Answer   string              `json:"answer,omitempty"`   // The user's answer (question_response)
+	Plan     *domain.Plan        `json:"plan,omitempty"`     // The user's edited plan (plan_response; omit to keep it as it is)
+	Planning *bool               `json:"planning,omitempty"` // Plan this task first, or not, whatever PLAN_MODE says
+
+	// Optional W3C trace context for this task. Without it the task joins the trace
+	// from the WebSocket upgrade request's headers, if there was one.
+	TraceParent string `json:"traceparent,omitempty"`
+	TraceState  string `json:"tracestate,omitempty"`
+}
+
+// wsSender writes JSON messages to one WebSocket connection.
+// The read loop, the task goroutine, approval requests and task events all talk to the
+// same client, but a connection only supports one writer at a time, so they take turns.
+type wsSender struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+// WriteJSON sends v to the client once no one else is writing.
+func (s *wsSender) WriteJSON(v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.WriteJSON(v)
 }
 
 func main() {
@@ -43,22 +99,18 @@ func main() {
 	}
 
 	// 2. Configuration
-	apiKey := os.Getenv("GOOGLE_API_KEY")
-	if apiKey == "" {
-		log.Fatal("GOOGLE_API_KEY not set. Please create a .env file with your API key.")
-	}
-
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./kortex.db" // Default to local file
+	// Gemini needs an API key; an OpenAI-compatible server is configured with OPENAI_* instead
+	apiKey, err := config.APIKey()
+	if err != nil {
+		log.Fatal(err)
 	}
+	dbPath := config.DBPath()
 
 	// Headless mode: Should the browser be invisible?
 	// Default is false (visible) for desktop, but true (invisible) for Docker.
 	headlessStr := os.Getenv("HEADLESS")
 	headless := false
 	if headlessStr != "" {
-		var err error
 		headless, err = strconv.ParseBool(headlessStr)
 		if err != nil {
 			log.Printf("Invalid HEADLESS value '%s', defaulting to false", headlessStr)
@@ -76,11 +128,34 @@ func main() {
 	// Browser (The Hands)
 	log.Printf("📱 Initializing Playwright browser (headless: %v)...", headless)
 	browserInstance := browser.NewPlaywrightBrowser()
+	// Dialog and permission policy, and the network profile
+	if err := config.Browser(browserInstance); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	// URL policy: every navigation (and every request the page makes) is checked against it.
+	guard, err := urlpolicy.NewGuardedBrowser(browserInstance, config.URLPolicy())
+	if err != nil {
+		log.Fatalf("❌ Invalid URL policy: %v", err)
+	}
+
 	if err := browserInstance.Init(headless); err != nil {
 		log.Fatalf("❌ Failed to initialize browser: %v", err)
 	}
 	log.Println("✓ Browser initialized successfully")
 
+	// HAR replay: serve every page from a previously recorded task instead of the network.
+	// HAR recording: save each task's traffic so failures can be replayed later.
+	harDir := ""
+	if harReplay := os.Getenv("HAR_REPLAY"); harReplay != "" {
+		if err := browserInstance.StartReplay(harReplay); err != nil {
+			log.Fatalf("❌ Failed to start HAR replay: %v", err)
+		}
+		log.Printf("✓ Replaying network traffic from %s (offline)", harReplay)
+	} else {
+		harDir = os.Getenv("HAR_DIR")
+	}
+
 	// Vector Store (The Memory)
 	log.Println("💾 Initializing vector store...")
 	vectorStore, err := sqlite.NewSQLiteVectorStore(dbPath)
@@ -89,15 +164,60 @@ func main() {
 	}
 	log.Println("✓ Vector store initialized successfully")
 
+	// Personal data is scrubbed from the flight recorder and memory (and optionally from pages)
+	redactor, err := redact.NewFromFile(os.Getenv("REDACT_PATTERNS_FILE"))
+	if err != nil {
+		log.Fatalf("❌ Invalid redaction patterns: %v", err)
+	}
+	redact.SetDefault(redactor)
+	vectorStore.SetRedactor(redactor)
+
+	// Tracing: spans for every task, model turn and tool call (off unless OTEL_TRACES_EXPORTER is set)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter: os.Getenv("OTEL_TRACES_EXPORTER"),
+		File:     os.Getenv("OTEL_TRACES_FILE"),
+	})
+	if err != nil {
+		log.Fatalf("❌ Failed to set up tracing: %v", err)
+	}
+
+	// Flight recorder (The Black Box), indexed into SQLite so past tasks can be searched
+	records, err := sqlite.NewRecordIndex(dbPath)
+	if err != nil {
+		log.Fatalf("❌ Failed to open flight recorder index: %v", err)
+	}
+	recorder, err := config.FlightRecorder(redactor, records)
+	if err != nil {
+		log.Fatalf("❌ Failed to open flight recorder: %v", err)
+	}
+
 	// Agent (The Brain)
 	log.Println("🧠 Initializing Kortex agent...")
-	agentAdapter := agent.NewAgent(browserInstance, vectorStore, apiKey)
+	approvals := config.Broker()
+	// Metrics read the same step-by-step records as the flight recorder
+	stats := metrics.New()
+	stats.WatchBrowserContexts(browserInstance.OpenContexts)
+	// Approvals, secrets, budgets, the model, limits, retries, the context window and planning
+	setup, err := config.AgentOptions(approvals, logger.Tee(recorder, stats), redactor, dbPath)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	log.Printf("✓ Secrets vault loaded (%d secrets)", len(setup.Secrets.List()))
+	usage := setup.Usage
+	agentAdapter := agent.NewAgent(guard, stats.InstrumentVectorStore(vectorStore), apiKey, setup.Options...)
 	log.Println("✓ Kortex agent ready!")
 
 	core := &KortexCore{
 		agent:       agentAdapter,
 		browser:     browserInstance,
 		vectorStore: vectorStore,
+		guard:       guard,
+		approvals:   approvals,
+		harDir:      harDir,
+		recorder:    recorder,
+		records:     records,
+		metrics:     stats,
+		usage:       usage,
 	}
 
 	// 4. Setup Web Server (Fiber)
@@ -108,23 +228,81 @@ func main() {
 	})
 
 	// Middleware: Logging and CORS (Cross-Origin Resource Sharing)
-	app.Use(logger.New())
+	app.Use(fiberlogger.New())
 	app.Use(cors.New())
 
 	// Health Check Endpoint
 	// Used by Docker/Kubernetes to check if the container is alive.
+	// Answers 503 if the browser, the database or the model configuration is broken.
 	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"status": "ok",
-			"agent":  "ready",
+		ctx, cancel := context.WithTimeout(c.UserContext(), 2*time.Second)
+		defer cancel()
+		checks := map[string]error{
+			"browser":  core.browser.Ping(),
+			"database": core.vectorStore.Ping(ctx),
+			"model":    core.agent.CheckConfig(),
+		}
+
+		status, code := "ok", fiber.StatusOK
+		results := fiber.Map{}
+		for name, err := range checks {
+			results[name] = "ok"
+			if err != nil {
+				results[name] = err.Error()
+				status, code = "unhealthy", fiber.StatusServiceUnavailable
+			}
+		}
+		return c.Status(code).JSON(fiber.Map{
+			"status": status,
+			"checks": results,
 		})
 	})
 
+	// Prometheus metrics: tasks, tool calls, model tokens and latency, browser and vector store
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.HandlerFor(core.metrics.Registry, promhttp.HandlerOpts{})))
+
+	// Every API request is a span, continuing the caller's trace if it sent one
+	app.Use("/api", traceRequests)
+
+	// Flight Recorder API
+	// Past tasks and their steps, so nobody has to grep the JSONL file.
+	app.Get("/api/tasks", func(c *fiber.Ctx) error {
+		tasks, err := core.records.Tasks(c.UserContext(), c.QueryInt("limit"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(tasks)
+	})
+	app.Get("/api/tasks/:id/timeline", func(c *fiber.Ctx) error {
+		timeline, err := core.records.Timeline(c.UserContext(), c.Params("id"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		if len(timeline) == 0 {
+			return fiber.NewError(fiber.StatusNotFound, "no such task")
+		}
+		return c.JSON(timeline)
+	})
+	// e.g. /api/records/search?tool=click&errors=true&since=2024-01-02T00:00:00Z
+	app.Get("/api/records/search", func(c *fiber.Ctx) error {
+		query, err := parseRecordQuery(c)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		found, err := core.records.Search(c.UserContext(), query)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(found)
+	})
+
 	// WebSocket Upgrade Middleware
 	// Checks if the request is a WebSocket connection request.
 	app.Use("/ws", func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
 			c.Locals("allowed", true)
+			// Keep the caller's trace context; tasks started over this connection join that trace
+			c.Locals("trace", requestTraceHeaders(c))
 			return c.Next()
 		}
 		return fiber.ErrUpgradeRequired
@@ -135,9 +313,17 @@ func main() {
 	// Clients connect here to send goals and receive real-time logs.
 	app.Get("/ws/chat", websocket.New(func(c *websocket.Conn) {
 		log.Printf("🔌 New WebSocket connection from %s", c.RemoteAddr())
+		connTrace, _ := c.Locals("trace").(map[string]string)
+		// All tasks sent over this connection form one session, so their cost adds up
+		sessionID := uuid.New().String()
+		// Every message to this client goes through out, never straight to c
+		out := &wsSender{conn: c}
+		// Tasks started here stop when the client goes away (when this handler returns)
+		connCtx, disconnect := context.WithCancel(context.Background())
+		defer disconnect()
 
 		// Send welcome message
-		if err := c.WriteJSON(fiber.Map{
+		if err := out.WriteJSON(fiber.Map{
 			"type":    "log",
 			"level":   "INIT",
 			"message": "🚀 Connected to Kortex! Send your goal to begin.",
@@ -163,8 +349,41 @@ func main() {
 				break
 			}
 
+			// The user answered an approval request from a running task
+			if msg.Type == "approval_response" {
+				if err := core.approvals.Respond(domain.HumanResponse{ID: msg.ID, Kind: "approval", Approved: msg.Approved}); err != nil {
+					out.WriteJSON(fiber.Map{
+						"type":    "error",
+						"message": err.Error(),
+					})
+				}
+				continue
+			}
+
+			// The user answered a clarifying question from a running task
+			if msg.Type == "question_response" {
+				if err := core.approvals.Respond(domain.HumanResponse{ID: msg.ID, Kind: "question", Answer: msg.Answer}); err != nil {
+					out.WriteJSON(fiber.Map{
+						"type":    "error",
+						"message": err.Error(),
+					})
+				}
+				continue
+			}
+
+			// The user approved, edited or rejected the plan of a task
+			if msg.Type == "plan_response" {
+				if err := core.approvals.Respond(domain.HumanResponse{ID: msg.ID, Kind: "plan", Approved: msg.Approved, Plan: msg.Plan}); err != nil {
+					out.WriteJSON(fiber.Map{
+						"type":    "error",
+						"message": err.Error(),
+					})
+				}
+				continue
+			}
+
 			if msg.Goal == "" {
-				c.WriteJSON(fiber.Map{
+				out.WriteJSON(fiber.Map{
 					"type":    "error",
 					"message": "Goal cannot be empty",
 				})
@@ -172,45 +391,167 @@ func main() {
 			}
 
 			// Acknowledge receipt
-			c.WriteJSON(fiber.Map{
+			out.WriteJSON(fiber.Map{
 				"type":    "log",
 				"level":   "USER",
 				"message": fmt.Sprintf("📝 %s", msg.Goal),
 			})
 
+			// The task's trace: the one named in the message, else the connection's
+			traceHeaders := map[string]string{}
+			for k, v := range connTrace {
+				traceHeaders[k] = v
+			}
+			if msg.TraceParent != "" {
+				traceHeaders["traceparent"], traceHeaders["tracestate"] = msg.TraceParent, msg.TraceState
+			}
+			parent := tracing.Extract(connCtx, traceHeaders)
+
 			// Execute task in a separate goroutine so we don't block the WebSocket loop
-			go func(goal string) {
+			go func(goal string, policy *urlpolicy.Policy, taskModel *domain.ModelConfig, planning *bool, parent context.Context) {
 				core.mu.Lock()
 				defer core.mu.Unlock()
 
-				c.WriteJSON(fiber.Map{
-					"type":    "log",
-					"level":   "PLANNING",
-					"message": "🧠 Analyzing task and preparing execution plan...",
+				// Apply the task's own URL restrictions (on top of the global ones) for this run only
+				if err := core.guard.SetTaskPolicy(policy); err != nil {
+					out.WriteJSON(fiber.Map{
+						"type":    "error",
+						"message": fmt.Sprintf("Invalid task policy: %v", err),
+					})
+					return
+				}
+				defer core.guard.SetTaskPolicy(nil)
+
+				// Sensitive actions, questions and the plan of this task are sent to this client
+				core.approvals.SetNotifier(func(req domain.HumanRequest) error {
+					if req.Kind == "plan" {
+						return out.WriteJSON(fiber.Map{
+							"type":    "plan_request",
+							"id":      req.ID,
+							"message": req.Message,
+							"plan":    req.Plan,
+						})
+					}
+					if req.Kind == "question" {
+						return out.WriteJSON(fiber.Map{
+							"type":     "question_request",
+							"id":       req.ID,
+							"question": req.Message,
+						})
+					}
+					return out.WriteJSON(fiber.Map{
+						"type":    "approval_request",
+						"id":      req.ID,
+						"tool":    req.Tool,
+						"args":    req.Args,
+						"message": req.Message,
+						"reason":  req.Reason,
+					})
+				})
+				defer core.approvals.SetNotifier(nil)
+
+				// One ID ties together this task's flight recorder entries and HAR file
+				taskID := uuid.New().String()
+				ctx, span := otel.Tracer("kortex/web").Start(parent, "kortex.ws.task",
+					trace.WithSpanKind(trace.SpanKindServer),
+					trace.WithAttributes(attribute.String("kortex.task_id", taskID)),
+				)
+				defer span.End()
+				out.WriteJSON(fiber.Map{
+					"type":     "log",
+					"level":    "PLANNING",
+					"message":  "🧠 Analyzing task and preparing execution plan...",
+					"task_id":  taskID,
+					"trace_id": tracing.TraceID(ctx),
 				})
 
+				// Record the task's network traffic so a failure can be replayed offline later
+				if core.harDir != "" {
+					harPath := filepath.Join(core.harDir, taskID+".har")
+					if err := core.browser.StartRecording(harPath); err != nil {
+						log.Printf("Failed to start HAR recording: %v", err)
+					} else {
+						defer func() {
+							if err := core.browser.StopRecording(); err != nil {
+								log.Printf("Failed to save HAR recording: %v", err)
+								return
+							}
+							log.Printf("Network traffic saved to %s", harPath)
+						}()
+					}
+				}
+
+				// Start counting blocked/mocked requests afresh for this task
+				core.browser.NetworkStats(true)
+
 				// Run the agent!
-				ctx := context.Background()
-				err := core.agent.ExecuteTask(ctx, goal)
+				taskCtx := logger.WithSessionID(logger.WithTaskID(ctx, taskID), sessionID)
+				if taskModel != nil {
+					taskCtx = agent.WithTaskModel(taskCtx, *taskModel)
+				}
+				if planning != nil {
+					taskCtx = agent.WithTaskPlanning(taskCtx, *planning)
+				}
+				// Model retries and fallbacks are sent as they happen, so a slow task isn't a silent one
+				taskCtx = agent.WithTaskEvents(taskCtx, func(rec domain.FlightRecord) {
+					out.WriteJSON(fiber.Map{
+						"type":    "log",
+						"level":   "MODEL",
+						"message": agent.DescribeRecovery(rec),
+						"task_id": taskID,
+						"event":   rec.Kind,
+						"details": rec.Details,
+					})
+				})
+				result, err := core.agent.Execute(taskCtx, goal)
+				sessionUsage, usageErr := core.usage.SessionUsage(context.Background(), sessionID)
+				if usageErr != nil {
+					log.Printf("Failed to total session usage: %v", usageErr)
+				}
 
 				if err != nil {
-					c.WriteJSON(fiber.Map{
-						"type":    "log",
-						"level":   "ERROR",
-						"message": fmt.Sprintf("❌ Task execution failed: %v", err),
+					out.WriteJSON(fiber.Map{
+						"type":          "log",
+						"level":         "ERROR",
+						"message":       fmt.Sprintf("❌ Task execution failed: %v", err),
+						"task_id":       taskID,
+						"outcome":       result.Outcome,
+						"usage":         result.Usage,
+						"session_usage": sessionUsage,
+						"network":       core.browser.NetworkStats(false),
+						"plan":          result.Plan,
 					})
 					return
 				}
 
-				c.WriteJSON(fiber.Map{
-					"type":    "log",
-					"level":   "COMPLETE",
-					"message": "✅ Task completed successfully!",
+				out.WriteJSON(fiber.Map{
+					"type":          "log",
+					"level":         "COMPLETE",
+					"message":       fmt.Sprintf("✅ Task completed successfully! (%d tokens, $%.4f)", result.Usage.TotalTokens, result.Usage.CostUSD),
+					"task_id":       taskID,
+					"outcome":       result.Outcome,
+					"usage":         result.Usage,
+					"session_usage": sessionUsage,
+					"network":       core.browser.NetworkStats(false),
+					"plan":          result.Plan,
 				})
-			}(msg.Goal)
+			}(msg.Goal, msg.Policy, msg.Model, msg.Planning, parent)
 		}
 	}))
 
+	// Reopen the flight recorder on SIGHUP, so external tools like logrotate can move it away
+	go func() {
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+		for range hupChan {
+			if err := core.recorder.Reopen(); err != nil {
+				log.Printf("Failed to reopen flight recorder: %v", err)
+				continue
+			}
+			log.Println("🔄 Flight recorder reopened")
+		}
+	}()
+
 	// 6. Graceful Shutdown
 	// Listen for Ctrl+C (SIGINT) or Docker stop (SIGTERM)
 	go func() {
@@ -227,8 +568,18 @@ func main() {
 		// Cleanup browser resources
 		if core.browser != nil {
 			log.Println("Closing browser...")
-			// In a real app, we'd call core.browser.Close() here
+			// Closing also flushes any HAR recording that is still in progress
+			if err := core.browser.Close(); err != nil {
+				log.Printf("Error closing browser: %v", err)
+			}
 		}
+		core.recorder.Close()
+		// Flush spans that haven't been exported yet
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := shutdownTracing(flushCtx); err != nil {
+			log.Printf("Error flushing traces: %v", err)
+		}
+		cancel()
 
 		os.Exit(0)
 	}()
@@ -241,3 +592,61 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// requestTraceHeaders collects the trace context headers a client sent.
+func requestTraceHeaders(c *fiber.Ctx) map[string]string {
+	headers := map[string]string{}
+	for _, name := range tracing.Headers {
+		headers[name] = c.Get(name)
+	}
+	return headers
+}
+
+// traceRequests wraps each HTTP request in a server span.
+func traceRequests(c *fiber.Ctx) error {
+	ctx := tracing.Extract(c.UserContext(), requestTraceHeaders(c))
+	ctx, span := otel.Tracer("kortex/web").Start(ctx, c.Method()+" "+c.Path(), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	c.SetUserContext(ctx)
+
+	err := c.Next()
+	span.SetName(c.Method() + " " + c.Route().Path) // "/api/tasks/:id/timeline", not one name per task
+	status := c.Response().StatusCode()
+	if e, ok := err.(*fiber.Error); ok {
+		status = e.Code
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	return err
+}
+
+// parseRecordQuery reads search filters from the query string.
+// Times are RFC 3339 ("2024-01-02T15:04:05Z") or a duration meaning "that long ago" ("1h").
+func parseRecordQuery(c *fiber.Ctx) (domain.RecordQuery, error) {
+	query := domain.RecordQuery{
+		TaskID:     c.Query("task"),
+		SessionID:  c.Query("session"),
+		Kind:       c.Query("kind"),
+		Tool:       c.Query("tool"),
+		ErrorsOnly: c.QueryBool("errors"),
+		Limit:      c.QueryInt("limit"),
+	}
+	for name, dst := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		if ago, err := time.ParseDuration(value); err == nil {
+			*dst = time.Now().Add(-ago)
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, fmt.Errorf("invalid %s %q: use RFC 3339 or a duration like 1h", name, value)
+		}
+		*dst = t
+	}
+	return query, nil
+}
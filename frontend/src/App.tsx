@@ -1,7 +1,8 @@
 import { useState, useEffect } from 'react';
-import { SendPrompt } from '../wailsjs/go/main/App';
+import { AnswerQuestion, RespondApproval, RespondPlan, SendPrompt } from '../wailsjs/go/main/App';
 import { EventsOn } from '../wailsjs/runtime/runtime';
 import FlightRecorder from './components/FlightRecorder';
+import SecretsPanel from './components/SecretsPanel';
 import './App.css';
 
 interface LogEntry {
@@ -10,11 +11,57 @@ interface LogEntry {
     timestamp: number;
 }
 
+interface ApprovalRequest {
+    id: string;
+    tool: string;
+    message: string;
+    reason: string;
+}
+
+interface QuestionRequest {
+    id: string;
+    message: string;
+}
+
+interface PlanStep {
+    number: number;
+    description: string;
+    status: string; // pending, in_progress, done, failed or skipped
+    note?: string;
+}
+
+interface Plan {
+    goal: string;
+    version: number;
+    steps: PlanStep[];
+}
+
+interface PlanReview {
+    id: string;
+    message: string;
+    plan: Plan;
+}
+
+const stepIcons: Record<string, string> = {
+    pending: '○',
+    in_progress: '◐',
+    done: '✓',
+    failed: '✗',
+    skipped: '↷',
+};
+
 function App() {
     const [prompt, setPrompt] = useState('');
     const [messages, setMessages] = useState<Array<{ role: string; content: string }>>([]);
     const [logs, setLogs] = useState<LogEntry[]>([]);
     const [isProcessing, setIsProcessing] = useState(false);
+    const [approvals, setApprovals] = useState<ApprovalRequest[]>([]);
+    const [questions, setQuestions] = useState<QuestionRequest[]>([]);
+    const [answers, setAnswers] = useState<Record<string, string>>({});
+    const [showSecrets, setShowSecrets] = useState(false);
+    const [planReview, setPlanReview] = useState<PlanReview | null>(null);
+    const [planDraft, setPlanDraft] = useState<string[]>([]);
+    const [plan, setPlan] = useState<Plan | null>(null);
 
     useEffect(() => {
         // Listen for log events from the backend
@@ -29,10 +76,71 @@ function App() {
             // If it's a completion or error, stop processing
             if (data.level === 'COMPLETE' || data.level === 'ERROR') {
                 setIsProcessing(false);
+                setApprovals([]);
+                setQuestions([]);
+                setPlanReview(null);
             }
         });
+
+        // Planner–executor mode: the agent wrote a plan and waits for the user to check it
+        EventsOn('kortex:plan-review', (req: PlanReview) => {
+            setPlanReview(req);
+            setPlanDraft(req.plan.steps.map((step) => step.description));
+        });
+
+        // The plan changed: a step started or finished, or the agent made a new plan
+        EventsOn('kortex:plan', (data: { event: string; plan: Plan }) => {
+            setPlan(data.plan);
+        });
+
+        // The agent wants to do something sensitive and is waiting for the user's OK
+        EventsOn('kortex:approval', (req: ApprovalRequest) => {
+            setApprovals((prev) => [...prev, req]);
+        });
+
+        // The agent needs more information and is waiting for the user's answer
+        EventsOn('kortex:question', (req: QuestionRequest) => {
+            setQuestions((prev) => [...prev, req]);
+        });
     }, []);
 
+    const handleApproval = async (id: string, approved: boolean) => {
+        setApprovals((prev) => prev.filter((req) => req.id !== id));
+        try {
+            await RespondApproval(id, approved);
+        } catch (error) {
+            console.error('Failed to answer approval request:', error);
+        }
+    };
+
+    const handleAnswer = async (e: React.FormEvent, id: string) => {
+        e.preventDefault();
+        const answer = (answers[id] || '').trim();
+        if (!answer) return;
+
+        setQuestions((prev) => prev.filter((req) => req.id !== id));
+        try {
+            await AnswerQuestion(id, answer);
+        } catch (error) {
+            console.error('Failed to answer question:', error);
+        }
+    };
+
+    const handlePlan = async (approved: boolean) => {
+        if (!planReview) return;
+        const id = planReview.id;
+        setPlanReview(null);
+        try {
+            await RespondPlan(id, approved, planDraft.map((step) => step.trim()).filter((step) => step !== ''));
+        } catch (error) {
+            console.error('Failed to answer plan review:', error);
+        }
+    };
+
+    const editStep = (idx: number, description: string) => {
+        setPlanDraft((prev) => prev.map((step, i) => (i === idx ? description : step)));
+    };
+
     const handleSubmit = async (e: React.FormEvent) => {
         e.preventDefault();
         if (!prompt.trim() || isProcessing) return;
@@ -40,6 +148,7 @@ function App() {
         // Add user message to chat
         setMessages((prev) => [...prev, { role: 'user', content: prompt }]);
         setIsProcessing(true);
+        setPlan(null);
 
         try {
             const response = await SendPrompt(prompt);
@@ -61,8 +170,13 @@ function App() {
                         KORTEX
                     </h1>
                     <p className="subtitle">Autonomous Interface Layer</p>
+                    <button className="secrets-toggle" onClick={() => setShowSecrets((prev) => !prev)}>
+                        🔐 Secrets
+                    </button>
                 </div>
 
+                {showSecrets && <SecretsPanel />}
+
                 <div className="messages-container">
                     {messages.length === 0 ? (
                         <div className="welcome-message">
@@ -86,6 +200,104 @@ function App() {
                     )}
                 </div>
 
+                {planReview && (
+                    <div className="plan-card">
+                        <div className="plan-text">
+                            <strong>📋 {planReview.message}</strong>
+                        </div>
+                        <ol className="plan-edit">
+                            {planDraft.map((step, idx) => (
+                                <li key={idx}>
+                                    <input
+                                        type="text"
+                                        value={step}
+                                        onChange={(e) => editStep(idx, e.target.value)}
+                                        className="prompt-input"
+                                    />
+                                    <button
+                                        className="decline-button"
+                                        onClick={() => setPlanDraft((prev) => prev.filter((_, i) => i !== idx))}
+                                        title="Remove step"
+                                    >
+                                        ✕
+                                    </button>
+                                </li>
+                            ))}
+                        </ol>
+                        <div className="plan-actions">
+                            <button className="secrets-toggle" onClick={() => setPlanDraft((prev) => [...prev, ''])}>
+                                + Add step
+                            </button>
+                            <button
+                                className="approve-button"
+                                onClick={() => handlePlan(true)}
+                                disabled={!planDraft.some((step) => step.trim())}
+                            >
+                                Run plan
+                            </button>
+                            <button className="decline-button" onClick={() => handlePlan(false)}>
+                                Cancel task
+                            </button>
+                        </div>
+                    </div>
+                )}
+
+                {plan && !planReview && (
+                    <div className="plan-card plan-progress">
+                        <div className="plan-text">
+                            <strong>📋 Plan</strong>
+                            {plan.version > 1 && <span className="plan-version"> (revised, v{plan.version})</span>}
+                        </div>
+                        <ol className="plan-steps">
+                            {plan.steps.map((step) => (
+                                <li key={step.number} className={`plan-step ${step.status}`}>
+                                    <span className="plan-step-icon">{stepIcons[step.status] || '○'}</span>
+                                    {step.description}
+                                    {step.note && <span className="plan-step-note"> — {step.note}</span>}
+                                </li>
+                            ))}
+                        </ol>
+                    </div>
+                )}
+
+                {approvals.map((req) => (
+                    <div key={req.id} className="approval-card">
+                        <div className="approval-text">
+                            <strong>✋ Approval needed:</strong> {req.message}
+                            <span className="approval-reason">{req.reason}</span>
+                        </div>
+                        <div className="approval-actions">
+                            <button className="approve-button" onClick={() => handleApproval(req.id, true)}>
+                                Approve
+                            </button>
+                            <button className="decline-button" onClick={() => handleApproval(req.id, false)}>
+                                Decline
+                            </button>
+                        </div>
+                    </div>
+                ))}
+
+                {questions.map((req) => (
+                    <form key={req.id} className="question-card" onSubmit={(e) => handleAnswer(e, req.id)}>
+                        <div className="question-text">
+                            <strong>❓ Kortex asks:</strong> {req.message}
+                        </div>
+                        <div className="question-actions">
+                            <input
+                                type="text"
+                                value={answers[req.id] || ''}
+                                onChange={(e) => setAnswers((prev) => ({ ...prev, [req.id]: e.target.value }))}
+                                placeholder="Type your answer..."
+                                className="prompt-input"
+                                autoFocus
+                            />
+                            <button type="submit" className="approve-button" disabled={!(answers[req.id] || '').trim()}>
+                                Answer
+                            </button>
+                        </div>
+                    </form>
+                ))}
+
                 <form onSubmit={handleSubmit} className="input-form">
                     <input
                         type="text"
@@ -1,4 +1,6 @@
-import { useEffect, useRef } from 'react';
+import { useEffect, useRef, useState } from 'react';
+import { GetTaskTimeline, ListTasks } from '../../wailsjs/go/main/App';
+import { domain } from '../../wailsjs/go/models';
 import './FlightRecorder.css';
 
 interface LogEntry {
@@ -11,15 +13,65 @@ interface FlightRecorderProps {
     logs: LogEntry[];
 }
 
+// toLogEntry turns a stored flight record into a terminal line, so past tasks
+// read the same way as live ones.
+function toLogEntry(rec: domain.FlightRecord): LogEntry {
+    const timestamp = new Date(rec.time).getTime();
+    const json = (v: any) => (v === undefined || v === null ? '' : JSON.stringify(v));
+    switch (rec.kind) {
+        case 'task_start':
+            return { level: 'PLANNING', message: `🎯 ${rec.details?.goal ?? ''}`, timestamp };
+        case 'task_end':
+            return rec.error
+                ? { level: 'ERROR', message: rec.error, timestamp }
+                : { level: 'COMPLETE', message: `Task finished in ${rec.duration_ms ?? 0}ms`, timestamp };
+        case 'tool': {
+            const outcome = rec.error ? `✗ ${rec.error}` : `✓ ${rec.duration_ms ?? 0}ms`;
+            return { level: (rec.tool ?? 'tool').toUpperCase(), message: `#${rec.step} ${json(rec.args)} ${outcome}`, timestamp };
+        }
+        case 'model':
+            return { level: 'MODEL', message: `${rec.usage?.total_tokens ?? 0} tokens, ${rec.duration_ms ?? 0}ms`, timestamp };
+        case 'approval':
+            return { level: 'APPROVAL', message: `${rec.tool}: ${json(rec.details)}`, timestamp };
+        case 'page_errors':
+            return { level: 'ERROR', message: json(rec.details), timestamp };
+        default:
+            return { level: rec.kind.toUpperCase(), message: json(rec.details), timestamp };
+    }
+}
+
 function FlightRecorder({ logs }: FlightRecorderProps) {
     const terminalRef = useRef<HTMLDivElement>(null);
+    const [tasks, setTasks] = useState<domain.TaskSummary[]>([]);
+    const [selectedTask, setSelectedTask] = useState(''); // '' = live view
+    const [history, setHistory] = useState<LogEntry[]>([]);
+
+    const shown = selectedTask ? history : logs;
+
+    const refreshTasks = async () => {
+        setTasks((await ListTasks(50)) || []);
+    };
+
+    useEffect(() => {
+        refreshTasks();
+    }, []);
+
+    // Load the chosen task's timeline from the flight recorder index
+    useEffect(() => {
+        if (!selectedTask) {
+            return;
+        }
+        GetTaskTimeline(selectedTask).then((records) => {
+            setHistory((records || []).map(toLogEntry));
+        });
+    }, [selectedTask]);
 
     // Auto-scroll to bottom when new logs arrive
     useEffect(() => {
         if (terminalRef.current) {
             terminalRef.current.scrollTop = terminalRef.current.scrollHeight;
         }
-    }, [logs]);
+    }, [shown]);
 
     const getLogColor = (level: string): string => {
         switch (level.toUpperCase()) {
@@ -45,6 +97,12 @@ function FlightRecorder({ logs }: FlightRecorderProps) {
                 return 'log-complete';
             case 'SHUTDOWN':
                 return 'log-shutdown';
+            case 'APPROVAL':
+                return 'log-approval';
+            case 'MODEL':
+                return 'log-model';
+            case 'QUESTION':
+                return 'log-question';
             default:
                 return 'log-default';
         }
@@ -65,19 +123,33 @@ function FlightRecorder({ logs }: FlightRecorderProps) {
             <div className="terminal-header">
                 <span className="terminal-title">⚙ MISSION CONTROL</span>
                 <div className="terminal-indicators">
-                    <span className="indicator active"></span>
-                    <span className="indicator-label">LIVE</span>
+                    <select
+                        className="task-picker"
+                        value={selectedTask}
+                        onFocus={refreshTasks}
+                        onChange={(e) => setSelectedTask(e.target.value)}
+                    >
+                        <option value="">Live</option>
+                        {tasks.map((task) => (
+                            <option key={task.task_id} value={task.task_id}>
+                                {task.error ? '✗' : task.done ? '✓' : '…'}{' '}
+                                {new Date(task.started_at).toLocaleString()} — {task.goal || task.task_id}
+                            </option>
+                        ))}
+                    </select>
+                    <span className={`indicator ${selectedTask ? '' : 'active'}`}></span>
+                    <span className="indicator-label">{selectedTask ? 'HISTORY' : 'LIVE'}</span>
                 </div>
             </div>
 
             <div className="terminal-body" ref={terminalRef}>
-                {logs.length === 0 ? (
+                {shown.length === 0 ? (
                     <div className="terminal-empty">
                         <p>Awaiting agent activity...</p>
                         <p className="terminal-hint">Logs will appear here in real-time</p>
                     </div>
                 ) : (
-                    logs.map((log, idx) => (
+                    shown.map((log, idx) => (
                         <div key={idx} className={`terminal-line ${getLogColor(log.level)}`}>
                             <span className="log-timestamp">[{formatTimestamp(log.timestamp)}]</span>
                             <span className="log-level">[{log.level}]</span>
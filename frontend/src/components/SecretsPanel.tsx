@@ -0,0 +1,69 @@
+import { useEffect, useState } from 'react';
+import { DeleteSecret, ListSecrets, SetSecret } from '../../wailsjs/go/main/App';
+import { domain } from '../../wailsjs/go/models';
+import './SecretsPanel.css';
+
+// SecretsPanel manages the encrypted vault. Values are write-only:
+// the Go side never sends them back, so they can't leak into the UI.
+function SecretsPanel() {
+    const [secrets, setSecrets] = useState<domain.SecretRef[]>([]);
+    const [site, setSite] = useState('');
+    const [key, setKey] = useState('');
+    const [value, setValue] = useState('');
+    const [status, setStatus] = useState('');
+
+    const refresh = async () => {
+        setSecrets((await ListSecrets()) || []);
+    };
+
+    useEffect(() => {
+        refresh();
+    }, []);
+
+    const handleSave = async (e: React.FormEvent) => {
+        e.preventDefault();
+        const result = await SetSecret(site.trim(), key.trim(), value);
+        setStatus(result === 'OK' ? `Saved {{secret:${site.trim()}.${key.trim()}}}` : result);
+        if (result === 'OK') {
+            setKey('');
+            setValue('');
+            refresh();
+        }
+    };
+
+    const handleDelete = async (ref: domain.SecretRef) => {
+        const result = await DeleteSecret(ref.site, ref.key);
+        setStatus(result === 'OK' ? '' : result);
+        refresh();
+    };
+
+    return (
+        <div className="secrets-panel">
+            <h3>🔐 Secrets Vault</h3>
+            <p className="secrets-hint">Use a secret in a goal as {'{{secret:site.key}}'}. The AI never sees the value.</p>
+
+            <ul className="secrets-list">
+                {secrets.map((ref) => (
+                    <li key={`${ref.site}.${ref.key}`}>
+                        <code>{`{{secret:${ref.site}.${ref.key}}}`}</code>
+                        <button className="decline-button" onClick={() => handleDelete(ref)}>
+                            Delete
+                        </button>
+                    </li>
+                ))}
+            </ul>
+
+            <form className="secrets-form" onSubmit={handleSave}>
+                <input type="text" value={site} onChange={(e) => setSite(e.target.value)} placeholder="site (github.com)" />
+                <input type="text" value={key} onChange={(e) => setKey(e.target.value)} placeholder="key (password)" />
+                <input type="password" value={value} onChange={(e) => setValue(e.target.value)} placeholder="value" />
+                <button type="submit" className="approve-button" disabled={!site.trim() || !key.trim() || !value}>
+                    Save
+                </button>
+            </form>
+            {status && <p className="secrets-status">{status}</p>}
+        </div>
+    );
+}
+
+export default SecretsPanel;
@@ -1,6 +1,23 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {domain} from '../models';
+
+export function AnswerQuestion(arg1:string,arg2:string):Promise<string>;
+
+export function DeleteSecret(arg1:string,arg2:string):Promise<string>;
 
 export function GetStatus():Promise<string>;
 
+export function GetTaskTimeline(arg1:string):Promise<Array<domain.FlightRecord>>;
+
+export function ListSecrets():Promise<Array<domain.SecretRef>>;
+
+export function ListTasks(arg1:number):Promise<Array<domain.TaskSummary>>;
+
+export function RespondApproval(arg1:string,arg2:boolean):Promise<string>;
+
+export function RespondPlan(arg1:string,arg2:boolean,arg3:Array<string>):Promise<string>;
+
 export function SendPrompt(arg1:string):Promise<string>;
+
+export function SetSecret(arg1:string,arg2:string,arg3:string):Promise<string>;
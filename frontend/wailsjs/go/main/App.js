@@ -2,10 +2,42 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AnswerQuestion(arg1, arg2) {
+  return window['go']['main']['App']['AnswerQuestion'](arg1, arg2);
+}
+
+export function DeleteSecret(arg1, arg2) {
+  return window['go']['main']['App']['DeleteSecret'](arg1, arg2);
+}
+
 export function GetStatus() {
   return window['go']['main']['App']['GetStatus']();
 }
 
+export function GetTaskTimeline(arg1) {
+  return window['go']['main']['App']['GetTaskTimeline'](arg1);
+}
+
+export function ListSecrets() {
+  return window['go']['main']['App']['ListSecrets']();
+}
+
+export function ListTasks(arg1) {
+  return window['go']['main']['App']['ListTasks'](arg1);
+}
+
+export function RespondApproval(arg1, arg2) {
+  return window['go']['main']['App']['RespondApproval'](arg1, arg2);
+}
+
+export function RespondPlan(arg1, arg2, arg3) {
+  return window['go']['main']['App']['RespondPlan'](arg1, arg2, arg3);
+}
+
 export function SendPrompt(arg1) {
   return window['go']['main']['App']['SendPrompt'](arg1);
 }
+
+export function SetSecret(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SetSecret'](arg1, arg2, arg3);
+}
@@ -0,0 +1,131 @@
+export namespace domain {
+	
+	export class TokenUsage {
+	    prompt_tokens: number;
+	    completion_tokens: number;
+	    total_tokens: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new TokenUsage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.prompt_tokens = source["prompt_tokens"];
+	        this.completion_tokens = source["completion_tokens"];
+	        this.total_tokens = source["total_tokens"];
+	    }
+	}
+	export class FlightRecord {
+	    // Go type: time
+	    time: any;
+	    task_id?: string;
+	    session_id?: string;
+	    trace_id?: string;
+	    step?: number;
+	    kind: string;
+	    tool?: string;
+	    args?: any;
+	    result?: any;
+	    error?: string;
+	    duration_ms?: number;
+	    usage?: TokenUsage;
+	    details?: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new FlightRecord(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.time = this.convertValues(source["time"], null);
+	        this.task_id = source["task_id"];
+	        this.session_id = source["session_id"];
+	        this.trace_id = source["trace_id"];
+	        this.step = source["step"];
+	        this.kind = source["kind"];
+	        this.tool = source["tool"];
+	        this.args = source["args"];
+	        this.result = source["result"];
+	        this.error = source["error"];
+	        this.duration_ms = source["duration_ms"];
+	        this.usage = this.convertValues(source["usage"], TokenUsage);
+	        this.details = source["details"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SecretRef {
+	    site: string;
+	    key: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SecretRef(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.site = source["site"];
+	        this.key = source["key"];
+	    }
+	}
+	export class TaskSummary {
+	    task_id: string;
+	    goal?: string;
+	    // Go type: time
+	    started_at: any;
+	    steps: number;
+	    done: boolean;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TaskSummary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.task_id = source["task_id"];
+	        this.goal = source["goal"];
+	        this.started_at = this.convertValues(source["started_at"], null);
+	        this.steps = source["steps"];
+	        this.done = source["done"];
+	        this.error = source["error"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
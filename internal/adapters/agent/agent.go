@@ -3,83 +3,360 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
 	"github.com/PundarikakshNTripathi/Kortex/internal/core/ports"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/llm"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/logger"
 	"github.com/google/uuid"
 	"google.golang.org/adk/agent"
 	"google.golang.org/adk/agent/llmagent"
-	"google.golang.org/adk/model/gemini"
 	"google.golang.org/adk/runner"
 	"google.golang.org/adk/session"
 	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/functiontool"
 	"google.golang.org/genai"
 )
 
 // AgentAdapter implements the "Brain" of Kortex.
-// It uses Google Gemini (via the ADK) to understand user goals and decide which tools to use.
+// It uses an LLM (Google Gemini by default, via the ADK) to understand user goals and decide which tools to use.
 type AgentAdapter struct {
-	browser     ports.Browser     // The "Hands" and "Eyes"
-	vectorStore ports.VectorStore // The "Memory"
-	apiKey      string            // Google Gemini API Key
-	modelName   string            // e.g., "gemini-3-pro-preview"
+	browser     ports.Browser               // The "Hands" and "Eyes"
+	vectorStore ports.VectorStore           // The "Memory"
+	providers   map[string]ports.AIProvider // Where models come from, by name ("gemini", "openai")
+	model       domain.ModelConfig          // Default model; tasks can override it with WithTaskModel
+	cache       *llm.Cache                  // Records or replays model responses (nil = off)
+
+	approver       ports.Approver     // Asks the user before sensitive actions (nil = never ask)
+	approvalPolicy approvalRules      // Which actions count as sensitive
+	asker          ports.Asker        // Answers clarifying questions (nil = the agent can't ask)
+	secrets        ports.SecretStore  // Resolves {{secret:...}} placeholders when typing (nil = none)
+	otp            ports.OTPGenerator // Generates 2FA codes from stored TOTP seeds (nil = ask the user)
+	pageRedactor   ports.Redactor     // Scrubs page content before the model sees it (nil = off)
+	recorder       ports.Recorder     // The flight recorder (nil = don't record)
+	usage          ports.UsageStore   // Where token usage and cost are saved (nil = not saved, no daily budget)
+	budget         domain.Budget      // Spending limits (zero = unlimited)
+	prices         *Pricing           // Overrides DefaultPricing for the model (nil = list price)
+	limits         Limits             // Caps on tool calls, time and repetition
+	retry          RetryPolicy        // Retries, fallback models and the circuit breaker
+	contextPolicy  ContextPolicy      // How much history the model sees
+	planning       bool               // Plan each task before running it (see plan.go)
+	planReviewer   ports.PlanReviewer // Shows the plan to the user before it runs (nil = run it straight away)
+
+	breakersMu sync.Mutex
+	breakers   map[string]*breaker // One per model, shared by all tasks (see resilience.go)
+	unpriced   sync.Map            // Models already logged as having no known price
+}
+
+// Option customises an AgentAdapter when it is created.
+type Option func(*AgentAdapter)
+
+// WithApprover makes the agent pause and ask the user before sensitive actions.
+func WithApprover(approver ports.Approver) Option {
+	return func(a *AgentAdapter) { a.approver = approver }
+}
+
+// WithAsker gives the agent an ask_user tool for clarifying questions.
+func WithAsker(asker ports.Asker) Option {
+	return func(a *AgentAdapter) { a.asker = asker }
+}
+
+// WithSecrets lets the type tool fill in {{secret:site.key}} placeholders from a vault.
+func WithSecrets(secrets ports.SecretStore) Option {
+	return func(a *AgentAdapter) { a.secrets = secrets }
+}
+
+// WithOTP lets the fill_otp tool generate two-factor codes locally.
+func WithOTP(otp ports.OTPGenerator) Option {
+	return func(a *AgentAdapter) { a.otp = otp }
+}
+
+// WithPageRedactor scrubs personal data out of snapshots and page text before
+// they are sent to the model. Off by default because it can hide details the task needs.
+func WithPageRedactor(r ports.Redactor) Option {
+	return func(a *AgentAdapter) { a.pageRedactor = r }
+}
+
+// WithRecorder writes every step of every task to a flight recorder.
+func WithRecorder(recorder ports.Recorder) Option {
+	return func(a *AgentAdapter) { a.recorder = recorder }
+}
+
+// WithUsageStore saves each task's token usage and cost, which also enables daily budgets.
+func WithUsageStore(store ports.UsageStore) Option {
+	return func(a *AgentAdapter) { a.usage = store }
+}
+
+// WithBudget stops tasks that spend more than the given tokens or dollars.
+func WithBudget(budget domain.Budget) Option {
+	return func(a *AgentAdapter) { a.budget = budget }
+}
+
+// WithPricing sets the price of the default model (see WithModelConfig) instead of
+// looking it up in DefaultPricing. Other models, like fallbacks, keep their list price.
+func WithPricing(p Pricing) Option {
+	return func(a *AgentAdapter) { a.prices = &p }
+}
+
+// WithLimits replaces DefaultLimits.
+func WithLimits(limits Limits) Option {
+	return func(a *AgentAdapter) { a.limits = limits }
+}
+
+// WithApprovalPolicy replaces DefaultApprovalPolicy.
+func WithApprovalPolicy(policy ApprovalPolicy) Option {
+	rules := policy.compile()
+	return func(a *AgentAdapter) { a.approvalPolicy = rules }
 }
 
 // NewAgent creates a new AgentAdapter.
-// It connects the core logic to the browser and database.
-func NewAgent(browser ports.Browser, vectorStore ports.VectorStore, apiKey string) *AgentAdapter {
-	return &AgentAdapter{
-		browser:     browser,
-		vectorStore: vectorStore,
-		apiKey:      apiKey,
-		modelName:   "gemini-3-pro-preview", // Using Gemini 3 Pro for advanced reasoning
+// It connects the core logic to the browser and database. apiKey is for Gemini,
+// the default provider; use WithProvider and WithModelConfig for other models.
+func NewAgent(browser ports.Browser, vectorStore ports.VectorStore, apiKey string, opts ...Option) *AgentAdapter {
+	a := &AgentAdapter{
+		browser:        browser,
+		vectorStore:    vectorStore,
+		providers:      map[string]ports.AIProvider{llm.ProviderGemini: &llm.Gemini{APIKey: apiKey}},
+		model:          domain.ModelConfig{Provider: llm.ProviderGemini, Model: llm.DefaultGeminiModel},
+		approvalPolicy: DefaultApprovalPolicy.compile(),
+		limits:         DefaultLimits,
+		retry:          DefaultRetryPolicy,
+		contextPolicy:  DefaultContextPolicy,
+		breakers:       map[string]*breaker{},
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 // ExecuteTask is the main entry point for the agent.
 // It takes a user's goal (e.g., "Find cheap flights to Tokyo") and runs the ReAct loop.
+// Use Execute instead to also get the task's token usage and cost.
 func (a *AgentAdapter) ExecuteTask(ctx context.Context, goal string) error {
+	_, err := a.Execute(ctx, goal)
+	return err
+}
+
+// Execute runs a task like ExecuteTask and reports how it went and what it cost.
+// Tag ctx with logger.WithTaskID / logger.WithSessionID to choose the IDs used in the
+// flight recorder; tasks of one session have their usage totalled together.
+// Use WithTaskModel to run this task on a different model.
+func (a *AgentAdapter) Execute(ctx context.Context, goal string) (*domain.TaskResult, error) {
+	// Every record written during this task carries its ID, session and step number.
+	taskID := logger.TaskIDFrom(ctx)
+	if taskID == "" {
+		taskID = uuid.New().String()
+		ctx = logger.WithTaskID(ctx, taskID)
+	}
+	sessionID := logger.SessionIDFrom(ctx)
+	if sessionID == "" {
+		sessionID = uuid.New().String()
+	}
+	start := time.Now()
+	run := &taskRun{id: taskID, sessionID: sessionID, lastErrorSeq: a.lastPageErrorSeq()}
+	run.usage = domain.TaskUsage{TaskID: taskID, SessionID: sessionID, Model: a.modelConfig(ctx).Model, StartedAt: start}
+	ctx = withTaskRun(ctx, run)
+	ctx, span := startTaskSpan(ctx, run)
+
+	a.record(ctx, domain.FlightRecord{Kind: "task_start", Details: map[string]any{"goal": goal}})
+
+	// Don't even start if today's budget is already spent, or the model's cost can't be counted
+	err := a.checkBudget(ctx, run.usage)
+	if err == nil {
+		err = a.checkPriced(run.usage.Model)
+	}
+	if err == nil {
+		a.saveUsage(ctx, run.usage)
+		runCtx, cancel := a.withTimeout(ctx)
+		err = a.runTask(runCtx, goal, run.sessionID)
+		if cause := context.Cause(runCtx); err != nil && errors.Is(cause, ErrLimitReached) {
+			err = cause // Report "timeout" rather than "context deadline exceeded"
+		}
+		cancel()
+	}
+	a.finishOpenToolCalls(ctx)
+	run.mu.Lock()
+	if err == nil && run.stopErr != nil {
+		err = run.stopErr // The model was stopped politely, but the task didn't finish
+	}
+	usage, plan := run.usage, run.plan
+	run.mu.Unlock()
+
+	result := &domain.TaskResult{TaskID: taskID, SessionID: sessionID, Outcome: taskOutcome(ctx, err), Usage: usage, Plan: plan}
+	end := domain.FlightRecord{
+		Kind:       "task_end",
+		DurationMs: time.Since(start).Milliseconds(),
+		Usage: &domain.TokenUsage{
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			TotalTokens:      usage.TotalTokens,
+		},
+		Details: map[string]any{"outcome": result.Outcome, "cost_usd": usage.CostUSD, "model_calls": usage.ModelCalls},
+	}
+	if err != nil {
+		end.Error = err.Error()
+	}
+	a.record(ctx, end)
+	endSpan(span, time.Since(start), err)
+	return result, err
+}
+
+// taskOutcome sums up how a task ended: "completed", "cancelled" (the user or a shutdown
+// stopped it, or the user rejected the plan or an action), "budget_exceeded", the Reason of a LimitError
+// ("max_tool_calls", "timeout", "stuck") or "failed".
+func taskOutcome(ctx context.Context, err error) string {
+	var limit *LimitError
+	switch {
+	case err == nil:
+		return "completed"
+	case errors.Is(err, ErrBudgetExceeded):
+		return "budget_exceeded"
+	case errors.As(err, &limit):
+		return limit.Reason
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) || errors.Is(err, ErrPlanRejected) || errors.Is(err, ErrDeclined):
+		return "cancelled"
+	default:
+		return "failed"
+	}
+}
+
+// CheckConfig reports whether the agent has what it needs to reach the model.
+// It doesn't call the model, so it is cheap enough for a health check.
+func (a *AgentAdapter) CheckConfig() error {
+	provider, ok := a.providers[a.model.Provider]
+	if !ok {
+		return fmt.Errorf("unknown model provider %q", a.model.Provider)
+	}
+	// Replaying from a cassette never reaches the provider, so it needs no API key
+	replaying := a.cache != nil && a.cache.Mode == llm.CacheReplay
+	if err := provider.Check(); err != nil && !replaying {
+		return err
+	}
+	if a.model.Model == "" {
+		return fmt.Errorf("no model configured")
+	}
+	return nil
+}
+
+// appName is how the ADK runner and its session store know us.
+const appName = "kortex"
+
+// runTask builds the model, tools and ADK agent and runs the ReAct loop until the model is done.
+func (a *AgentAdapter) runTask(ctx context.Context, goal, sessionID string) error {
 	// 1. RAG: Search for context (Placeholder)
 	// In the future, this will look up past conversations to understand preferences.
 	ragContext := ""
 	// TODO: Implement actual embedding and search
 
-	// 2. Initialize Gemini Model
-	// We create a client to talk to Google's AI servers.
-	model, err := gemini.NewModel(ctx, a.modelName, &genai.ClientConfig{
-		APIKey: a.apiKey,
-	})
+	// 2. Initialize the Model
+	// The provider (Gemini, or any OpenAI-compatible server) gives us a client for the chosen model.
+	cfg := a.modelConfig(ctx)
+	model, err := a.newResilientModel(ctx, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create model: %w", err)
 	}
 
+	// 2b. Plan (optional)
+	// In planner–executor mode the model first breaks the goal into steps, and the user may edit them.
+	planning := a.planningEnabled(ctx)
+	if planning {
+		if err := a.startPlan(ctx, model, goal); err != nil {
+			return err
+		}
+	}
+
 	// 3. Define Tools
 	// These are the capabilities we give the AI. It can't do anything else.
 	tools := []tool.Tool{
-		&NavigateTool{Browser: a.browser},    // Go to a URL
-		&ClickTool{Browser: a.browser},       // Click something
-		&TypeTool{Browser: a.browser},        // Type text
-		&HighlightTool{Browser: a.browser},   // Show the user what you're looking at
-		&GetSnapshotTool{Browser: a.browser}, // Read the page
+		&NavigateTool{Browser: a.browser},                              // Go to a URL
+		&ClickTool{Browser: a.browser},                                 // Click something
+		&TypeTool{Browser: a.browser, Secrets: a.secrets},              // Type text (secrets are filled in here)
+		&HighlightTool{Browser: a.browser},                             // Show the user what you're looking at
+		&GetSnapshotTool{Browser: a.browser, Redactor: a.pageRedactor}, // Read the page
+		&ReadPageTool{Browser: a.browser, Redactor: a.pageRedactor},    // Read the article text
+		&HandleDialogTool{Browser: a.browser},                          // Answer alert/confirm/prompt popups
+		&GetPageErrorsTool{Browser: a.browser},                         // See console errors and failed requests
+	}
+	if a.asker != nil {
+		tools = append(tools, &AskUserTool{Asker: a.asker}) // Ask the user when the goal is ambiguous
+	}
+	if a.otp != nil || a.asker != nil {
+		tools = append(tools, &FillOTPTool{Browser: a.browser, OTP: a.otp, Asker: a.asker}) // Get past 2FA prompts
+	}
+	if planning {
+		tools = append(tools, &UpdatePlanTool{Agent: a, Model: model}) // Tick off plan steps
+	}
+	tools, err = functionTools(tools)
+	if err != nil {
+		return fmt.Errorf("failed to create tools: %w", err)
 	}
 
 	// 4. Create ADK Agent
 	// We give the AI a persona and instructions.
 	systemInstruction := `You are Kortex, the Autonomous Interface Layer. Your goal is to navigate websites for users. 
-You MUST use the Highlight tool to show the user where you are looking before you click. Speak simply.`
+You MUST use the Highlight tool to show the user where you are looking before you click. Speak simply.
+If a snapshot reports an open dialog, use the handle_dialog tool before doing anything else.
+If an action seems to have no effect, use get_page_errors to check for JavaScript or network failures.`
+	if a.otp != nil || a.asker != nil {
+		systemInstruction += "\nWhen a site asks for a two-factor or one-time code, use fill_otp with the site name."
+	}
+	if a.asker != nil {
+		systemInstruction += "\nIf the goal is ambiguous or you need information only the user has, use ask_user instead of guessing."
+	}
+	if a.secrets != nil {
+		if refs := a.secrets.List(); len(refs) > 0 {
+			systemInstruction += "\nNever ask for passwords. To type a stored credential, pass its placeholder as the text, e.g. {{secret:site.key}}. Available:"
+			for _, ref := range refs {
+				systemInstruction += fmt.Sprintf(" {{secret:%s.%s}}", ref.Site, ref.Key)
+			}
+		}
+	}
 	if ragContext != "" {
 		systemInstruction += "\n\nContext from memory:\n" + ragContext
 	}
 
-	adkAgent, err := llmagent.New(llmagent.Config{
+	agentCfg := llmagent.Config{
 		Name:        "kortex_agent",
 		Model:       model,
 		Description: "An autonomous agent that navigates the web.",
 		Instruction: systemInstruction,
 		Tools:       tools,
-	})
+		GenerateContentConfig: &genai.GenerateContentConfig{
+			Temperature:     cfg.Temperature, // nil = the model's default
+			MaxOutputTokens: cfg.MaxTokens,   // 0 = the model's default
+		},
+		BeforeModelCallbacks: []llmagent.BeforeModelCallback{
+			a.recordFailedTools,     // Write the tool calls that failed (the ADK skips the after-tool callbacks for them)
+			a.haltIfStopped,         // Stop once a budget or limit has been hit
+			a.compactHistory(model), // Keep the request inside the context window
+			a.startModelCall,        // Start the clock on each model turn
+		},
+		AfterModelCallbacks: []llmagent.AfterModelCallback{
+			a.recordModelCall, // Record latency and token usage
+		},
+		BeforeToolCallbacks: []llmagent.BeforeToolCallback{
+			a.startToolStep, // Number the step and start the clock
+			a.checkLimits,   // Stop runaway tasks and nudge an agent that repeats itself
+			a.checkApproval, // Ask the user before buying, sending, or typing passwords
+		},
+		AfterToolCallbacks: []llmagent.AfterToolCallback{
+			a.recordToolStep,   // Write the call, its result and duration to the flight recorder
+			a.recordPageErrors, // Capture what went wrong on the page after every step
+			a.checkSnapshots,   // Warn when the page stops changing
+		},
+	}
+	if planning {
+		// The plan changes as steps are done, so the instruction is rebuilt for every model call
+		agentCfg.InstructionProvider = a.planInstruction(systemInstruction)
+	}
+	adkAgent, err := llmagent.New(agentCfg)
 	if err != nil {
 		return fmt.Errorf("failed to create agent: %w", err)
 	}
@@ -88,7 +365,15 @@ You MUST use the Highlight tool to show the user where you are looking before yo
 	// The Runner manages the conversation loop:
 	// User Goal -> AI Thinks -> AI Calls Tool -> Tool Runs -> AI Sees Result -> AI Thinks...
 	sessionService := session.InMemoryService()
+	if _, err := sessionService.Create(ctx, &session.CreateRequest{
+		AppName:   appName,
+		UserID:    "user",
+		SessionID: sessionID,
+	}); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
 	runnerCfg := runner.Config{
+		AppName:        appName,
 		Agent:          adkAgent,
 		SessionService: sessionService,
 	}
@@ -98,10 +383,8 @@ You MUST use the Highlight tool to show the user where you are looking before yo
 		return fmt.Errorf("failed to create runner: %w", err)
 	}
 
-	sessionID := uuid.New().String()
-	userContent := &genai.Content{
-		Parts: []*genai.Part{genai.NewPartFromText(goal)},
-	}
+	// The goal is the user's message; without a role the ADK would leave it out of the history
+	userContent := genai.NewContentFromText(goal, genai.RoleUser)
 
 	// Run returns an iterator that streams events as they happen.
 	// We loop through these events to see what the agent is doing.
@@ -125,10 +408,107 @@ You MUST use the Highlight tool to show the user where you are looking before yo
 	return nil
 }
 
+// recordPageErrors runs after every tool call and writes any new console/network
+// problems to the flight recorder, so each step shows what the page complained about.
+func (a *AgentAdapter) recordPageErrors(ctx tool.Context, t tool.Tool, args, result map[string]any, err error) (map[string]any, error) {
+	a.capturePageErrors(ctx, t.Name())
+	// Returning nil keeps the tool's original result
+	return nil, nil
+}
+
+// capturePageErrors writes the page errors the task hasn't recorded yet, tagged with the tool
+// that was running. Failed tool calls get here through recordFailedTools.
+func (a *AgentAdapter) capturePageErrors(ctx context.Context, toolName string) {
+	run := taskRunFrom(ctx)
+	if run == nil {
+		return
+	}
+	pageErrors, e := a.browser.GetPageErrors()
+	if e != nil {
+		return // The browser isn't ready; nothing to record
+	}
+
+	var fresh []domain.PageError
+	run.mu.Lock()
+	for _, pe := range pageErrors {
+		if pe.Seq > run.lastErrorSeq {
+			fresh = append(fresh, pe)
+			run.lastErrorSeq = pe.Seq
+		}
+	}
+	run.mu.Unlock()
+	if len(fresh) > 0 {
+		a.record(ctx, domain.FlightRecord{
+			Kind:    "page_errors",
+			Tool:    toolName,
+			Details: fresh,
+		})
+	}
+}
+
+// lastPageErrorSeq is the newest page error already in the browser when a task starts.
+// The task only records errors after it, not ones an earlier task already saw.
+func (a *AgentAdapter) lastPageErrorSeq() int64 {
+	pageErrors, err := a.browser.GetPageErrors()
+	if err != nil || len(pageErrors) == 0 {
+		return 0
+	}
+	return pageErrors[len(pageErrors)-1].Seq
+}
+
 // --- Tool Wrappers ---
 // These structs wrap the core Browser interface methods so the ADK can understand them.
 // Each tool has a Name, Description, and Run method.
 
+// functionTools turns our tool structs into ADK function tools. The ADK reads each
+// Run method's argument struct to tell the model which arguments the tool takes,
+// and hands the returned text back to the model as {"result": "..."}.
+func functionTools(tools []tool.Tool) ([]tool.Tool, error) {
+	out := make([]tool.Tool, 0, len(tools))
+	for _, t := range tools {
+		var ft tool.Tool
+		var err error
+		switch t := t.(type) {
+		case *NavigateTool:
+			ft, err = newFunctionTool(t, t.Run)
+		case *ClickTool:
+			ft, err = newFunctionTool(t, t.Run)
+		case *TypeTool:
+			ft, err = newFunctionTool(t, t.Run)
+		case *HighlightTool:
+			ft, err = newFunctionTool(t, t.Run)
+		case *GetSnapshotTool:
+			ft, err = newFunctionTool(t, t.Run)
+		case *ReadPageTool:
+			ft, err = newFunctionTool(t, t.Run)
+		case *HandleDialogTool:
+			ft, err = newFunctionTool(t, t.Run)
+		case *GetPageErrorsTool:
+			ft, err = newFunctionTool(t, t.Run)
+		case *AskUserTool:
+			ft, err = newFunctionTool(t, t.Run)
+		case *FillOTPTool:
+			ft, err = newFunctionTool(t, t.Run)
+		case *UpdatePlanTool:
+			ft, err = newFunctionTool(t, t.Run)
+		default:
+			ft = t // Already an ADK tool
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tool %q: %w", t.Name(), err)
+		}
+		out = append(out, ft)
+	}
+	return out, nil
+}
+
+func newFunctionTool[TArgs any](t tool.Tool, run func(context.Context, TArgs) (string, error)) (tool.Tool, error) {
+	cfg := functiontool.Config{Name: t.Name(), Description: t.Description(), IsLongRunning: t.IsLongRunning()}
+	return functiontool.New(cfg, func(ctx tool.Context, args TArgs) (string, error) {
+		return run(ctx, args)
+	})
+}
+
 type NavigateTool struct {
 	Browser ports.Browser
 }
@@ -137,7 +517,6 @@ func (t *NavigateTool) Name() string        { return "navigate" }
 func (t *NavigateTool) Description() string { return "Navigates to a specified URL." }
 func (t *NavigateTool) IsLongRunning() bool { return false }
 func (t *NavigateTool) Run(ctx context.Context, args struct{ URL string }) (string, error) {
-	logFlightRecorder("navigate", args) // Log for debugging
 	err := t.Browser.Navigate(args.URL)
 	if err != nil {
 		return "", err
@@ -153,7 +532,6 @@ func (t *ClickTool) Name() string        { return "click" }
 func (t *ClickTool) Description() string { return "Clicks on an element specified by the selector." }
 func (t *ClickTool) IsLongRunning() bool { return false }
 func (t *ClickTool) Run(ctx context.Context, args struct{ Selector string }) (string, error) {
-	logFlightRecorder("click", args)
 	err := t.Browser.Click(args.Selector)
 	if err != nil {
 		return "", err
@@ -163,6 +541,7 @@ func (t *ClickTool) Run(ctx context.Context, args struct{ Selector string }) (st
 
 type TypeTool struct {
 	Browser ports.Browser
+	Secrets ports.SecretStore // Optional: fills in {{secret:site.key}} placeholders
 }
 
 func (t *TypeTool) Name() string { return "type" }
@@ -174,14 +553,38 @@ func (t *TypeTool) Run(ctx context.Context, args struct {
 	Selector string
 	Text     string
 }) (string, error) {
-	logFlightRecorder("type", args)
-	err := t.Browser.Type(args.Selector, args.Text)
+	// The recorder logs the args as the model sent them, so it only ever sees placeholders.
+	// Secrets are only filled in on their own site, whatever the page told the model.
+	text := args.Text
+	if t.Secrets != nil {
+		resolved, err := t.Secrets.Resolve(text, pageHost(t.Browser))
+		if err != nil {
+			return "", err
+		}
+		text = resolved
+	}
+
+	err := t.Browser.Type(args.Selector, text)
 	if err != nil {
 		return "", err
 	}
+	// Never echo the typed text back: it may now contain a real password
 	return "Typed into " + args.Selector, nil
 }
 
+// pageHost returns the host name of the page the browser is on ("" if it can't tell).
+func pageHost(browser ports.Browser) string {
+	current, err := browser.CurrentURL()
+	if err != nil {
+		return ""
+	}
+	u, err := url.Parse(current)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
 type HighlightTool struct {
 	Browser ports.Browser
 }
@@ -195,7 +598,6 @@ func (t *HighlightTool) Run(ctx context.Context, args struct {
 	Selector string
 	Message  string
 }) (string, error) {
-	logFlightRecorder("highlight", args)
 	err := t.Browser.Highlight(args.Selector, args.Message)
 	if err != nil {
 		return "", err
@@ -204,7 +606,8 @@ func (t *HighlightTool) Run(ctx context.Context, args struct {
 }
 
 type GetSnapshotTool struct {
-	Browser ports.Browser
+	Browser  ports.Browser
+	Redactor ports.Redactor // Optional: scrubs personal data from the snapshot
 }
 
 func (t *GetSnapshotTool) Name() string { return "get_snapshot" }
@@ -213,32 +616,181 @@ func (t *GetSnapshotTool) Description() string {
 }
 func (t *GetSnapshotTool) IsLongRunning() bool { return false }
 func (t *GetSnapshotTool) Run(ctx context.Context, args struct{}) (string, error) {
-	logFlightRecorder("get_snapshot", args)
-	return t.Browser.GetSnapshot()
+	snapshot, err := t.Browser.GetSnapshot()
+	if err != nil || t.Redactor == nil {
+		return snapshot, err
+	}
+
+	// Redact the decoded strings rather than the raw JSON text, so a match
+	// can never cut an escape sequence like \u003c in half.
+	var tree interface{}
+	if err := json.Unmarshal([]byte(snapshot), &tree); err != nil {
+		return t.Redactor.Redact(snapshot), nil
+	}
+	bytes, err := json.MarshalIndent(t.Redactor.RedactValue(tree), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	return string(bytes), nil
 }
 
-// --- Flight Recorder ---
-// This is a simple logging system that saves every action to a file.
-// It helps us debug what the agent did and why.
+type ReadPageTool struct {
+	Browser  ports.Browser
+	Redactor ports.Redactor // Optional: scrubs personal data from the page text
+}
 
-type FlightRecord struct {
-	Tool string      `json:"tool"`
-	Args interface{} `json:"args"`
+func (t *ReadPageTool) Name() string { return "read_page" }
+func (t *ReadPageTool) Description() string {
+	return "Reads the main text content of the current page as Markdown. " +
+		"Long pages are returned in chunks; pass the returned next offset to continue reading."
 }
+func (t *ReadPageTool) IsLongRunning() bool { return false }
+func (t *ReadPageTool) Run(ctx context.Context, args struct{ Offset int }) (string, error) {
+	chunk, err := t.Browser.ReadPage(args.Offset)
+	if err != nil {
+		return "", err
+	}
 
-func logFlightRecorder(toolName string, args interface{}) {
-	record := FlightRecord{
-		Tool: toolName,
-		Args: args,
+	// Tell the model where it is in the document so it knows whether to keep reading.
+	// The chunk ends where the next one starts; the Markdown itself is trimmed, so its length won't do.
+	end := chunk.Total
+	if chunk.NextOffset > 0 {
+		end = chunk.NextOffset
+	}
+	header := fmt.Sprintf("# %s\nSource: %s\nShowing characters %d-%d of %d.",
+		chunk.Title, chunk.URL, chunk.Offset, end, chunk.Total)
+	footer := "(End of page.)"
+	if chunk.NextOffset > 0 {
+		footer = fmt.Sprintf("(More content available: call read_page with offset %d.)", chunk.NextOffset)
 	}
-	data, _ := json.Marshal(record)
-	// Open file in append mode so we don't lose history
-	f, err := os.OpenFile("kortex_flight_recorder.jsonl", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	markdown := chunk.Markdown
+	if t.Redactor != nil {
+		markdown = t.Redactor.Redact(markdown)
+	}
+	return header + "\n\n" + markdown + "\n\n" + footer, nil
+}
+
+type HandleDialogTool struct {
+	Browser ports.Browser
+}
+
+func (t *HandleDialogTool) Name() string { return "handle_dialog" }
+func (t *HandleDialogTool) Description() string {
+	return "Accepts or dismisses the JavaScript dialog (alert, confirm, prompt) that is currently open. " +
+		"For prompt dialogs, PromptText is entered before accepting."
+}
+func (t *HandleDialogTool) IsLongRunning() bool { return false }
+func (t *HandleDialogTool) Run(ctx context.Context, args struct {
+	Accept     bool
+	PromptText string
+}) (string, error) {
+	err := t.Browser.HandleDialog(args.Accept, args.PromptText)
 	if err != nil {
-		log.Printf("Failed to write to flight recorder: %v", err)
-		return
+		return "", err
+	}
+	if args.Accept {
+		return "Accepted dialog", nil
+	}
+	return "Dismissed dialog", nil
+}
+
+type GetPageErrorsTool struct {
+	Browser ports.Browser
+}
+
+func (t *GetPageErrorsTool) Name() string { return "get_page_errors" }
+func (t *GetPageErrorsTool) Description() string {
+	return "Lists JavaScript errors, console errors/warnings and failed or slow network requests on the current page."
+}
+func (t *GetPageErrorsTool) IsLongRunning() bool { return false }
+func (t *GetPageErrorsTool) Run(ctx context.Context, args struct{}) (string, error) {
+	pageErrors, err := t.Browser.GetPageErrors()
+	if err != nil {
+		return "", err
+	}
+	if len(pageErrors) == 0 {
+		return "No errors recorded on this page.", nil
+	}
+
+	var sb strings.Builder
+	for _, pe := range pageErrors {
+		fmt.Fprintf(&sb, "[%s] %s\n", pe.Kind, pe.Message)
+	}
+	return sb.String(), nil
+}
+
+// AskUserTool pauses the task until the user answers a question.
+// It is long-running because a human may take minutes to reply.
+type AskUserTool struct {
+	Asker ports.Asker
+}
+
+func (t *AskUserTool) Name() string { return "ask_user" }
+func (t *AskUserTool) Description() string {
+	return "Asks the user a clarifying question and waits for their answer. " +
+		"Use it when the goal is ambiguous instead of guessing."
+}
+func (t *AskUserTool) IsLongRunning() bool { return true }
+func (t *AskUserTool) Run(ctx context.Context, args struct{ Question string }) (string, error) {
+	answer, err := t.Asker.AskUser(ctx, domain.HumanRequest{Tool: "ask_user", Message: args.Question})
+	if err != nil {
+		return "", fmt.Errorf("could not get an answer from the user: %w", err)
+	}
+	return "The user answered: " + answer, nil
+}
+
+// FillOTPTool types a two-factor code into the page. If the vault has a TOTP seed
+// for the site the code is generated locally; otherwise (codes sent by SMS or email)
+// the user is asked for it. Either way the code itself is never shown to the model.
+type FillOTPTool struct {
+	Browser ports.Browser
+	OTP     ports.OTPGenerator // Optional: local TOTP codes
+	Asker   ports.Asker        // Optional: fallback when there is no seed
+}
+
+func (t *FillOTPTool) Name() string { return "fill_otp" }
+func (t *FillOTPTool) Description() string {
+	return "Fills a two-factor one-time code for a site (e.g. 'github.com') into the element specified by the selector."
+}
+
+// IsLongRunning is true because the fallback waits for the user to read a text message.
+func (t *FillOTPTool) IsLongRunning() bool { return true }
+func (t *FillOTPTool) Run(ctx context.Context, args struct {
+	Selector string
+	Site     string
+}) (string, error) {
+
+	code, source, err := t.code(ctx, args.Site, pageHost(t.Browser))
+	if err != nil {
+		return "", err
+	}
+	if err := t.Browser.Type(args.Selector, code); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Filled the one-time code (%s) into %s", source, args.Selector), nil
+}
+
+// code returns the OTP for site and where it came from. host is the page it will be typed into:
+// a stored seed is only used on its own site, and the user is told which page is asking.
+func (t *FillOTPTool) code(ctx context.Context, site, host string) (string, string, error) {
+	var otpErr error
+	if t.OTP != nil {
+		code, err := t.OTP.OTPFor(site, host)
+		if err == nil {
+			return code, "generated from the stored seed", nil
+		}
+		otpErr = err
+	}
+	if t.Asker == nil {
+		return "", "", fmt.Errorf("no one-time code available for %s: %w", site, otpErr)
+	}
+
+	answer, err := t.Asker.AskUser(ctx, domain.HumanRequest{
+		Tool:    "fill_otp",
+		Message: fmt.Sprintf("%s (page: %s) is asking for a one-time code. Please enter the code you received.", site, host),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("could not get a one-time code from the user: %w", err)
 	}
-	defer f.Close()
-	f.Write(data)
-	f.WriteString("\n")
+	return strings.TrimSpace(answer), "provided by the user", nil
 }
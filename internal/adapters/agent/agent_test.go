@@ -2,9 +2,24 @@ package agent
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/llm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	adkagent "google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/tool"
+	"google.golang.org/genai"
 )
 
 // MockBrowser implements ports.Browser for testing.
@@ -12,7 +27,12 @@ type MockBrowser struct {
 	navigatedURL string
 	clicked      string
 	typed        string
+	snapshot     string
 	highlighted  string
+	dialog       string
+	pageErrors   []domain.PageError
+	chunk        *domain.PageChunk // What ReadPage returns (nil = a short example page)
+	clickErr     error             // What Click fails with (nil = it works)
 }
 
 func (m *MockBrowser) Navigate(url string) error {
@@ -21,15 +41,36 @@ func (m *MockBrowser) Navigate(url string) error {
 }
 
 func (m *MockBrowser) GetSnapshot() (string, error) {
+	if m.snapshot != "" {
+		return m.snapshot, nil
+	}
 	return "<html><body><button id='submit'>Submit</button></body></html>", nil
 }
 
+func (m *MockBrowser) ReadPage(offset int) (*domain.PageChunk, error) {
+	if m.chunk != nil {
+		return m.chunk, nil
+	}
+	return &domain.PageChunk{
+		Title:    "Example",
+		URL:      "http://example.com",
+		Markdown: "# Example\n\nSome article text.",
+		Offset:   offset,
+		Total:    29,
+	}, nil
+}
+
 func (m *MockBrowser) Highlight(selector, message string) error {
 	m.highlighted = selector
 	return nil
 }
 
 func (m *MockBrowser) Click(selector string) error {
+	if m.clickErr != nil {
+		// A failing page usually complains in the console too
+		m.pageErrors = append(m.pageErrors, domain.PageError{Seq: int64(len(m.pageErrors) + 1), Kind: "console", Message: "error: " + m.clickErr.Error()})
+		return m.clickErr
+	}
 	m.clicked = selector
 	return nil
 }
@@ -39,6 +80,113 @@ func (m *MockBrowser) Type(selector, text string) error {
 	return nil
 }
 
+func (m *MockBrowser) HandleDialog(accept bool, promptText string) error {
+	m.dialog = fmt.Sprintf("%v:%s", accept, promptText)
+	return nil
+}
+
+func (m *MockBrowser) GetPageErrors() ([]domain.PageError, error) {
+	return m.pageErrors, nil
+}
+
+func (m *MockBrowser) CurrentURL() (string, error) {
+	return m.navigatedURL, nil
+}
+
+func (m *MockBrowser) DescribeElement(selector string) (*domain.ElementInfo, error) {
+	switch selector {
+	case "#buy":
+		return &domain.ElementInfo{Tag: "button", Role: "button", Name: "Place order"}, nil
+	case "#password":
+		return &domain.ElementInfo{Tag: "input", Role: "input", InputType: "password"}, nil
+	case "#missing":
+		return nil, fmt.Errorf("element not found: %s", selector)
+	case "#behind-dialog":
+		return nil, fmt.Errorf("%w: call handle_dialog first", domain.ErrDialogOpen)
+	}
+	return &domain.ElementInfo{Tag: "div", Role: "div", Name: "Hello"}, nil
+}
+
+// MockApprover answers every approval request with a fixed decision.
+type MockApprover struct {
+	approve  bool
+	requests []domain.HumanRequest
+}
+
+func (m *MockApprover) RequestApproval(ctx context.Context, req domain.HumanRequest) (bool, error) {
+	m.requests = append(m.requests, req)
+	return m.approve, nil
+}
+
+// MockAsker answers every question with a fixed reply.
+type MockAsker struct {
+	answer   string
+	question string
+}
+
+func (m *MockAsker) AskUser(ctx context.Context, req domain.HumanRequest) (string, error) {
+	m.question = req.Message
+	return m.answer, nil
+}
+
+// MockSecrets resolves a single known placeholder, on github.com only.
+type MockSecrets struct{}
+
+func (m *MockSecrets) Resolve(text, host string) (string, error) {
+	if strings.Contains(text, "{{secret:") && !strings.Contains(text, "{{secret:github.com.password}}") {
+		return "", fmt.Errorf("unknown secret")
+	}
+	if strings.Contains(text, "{{secret:") && host != "github.com" {
+		return "", fmt.Errorf("secrets for github.com can't be used on %s", host)
+	}
+	return strings.ReplaceAll(text, "{{secret:github.com.password}}", "hunter2"), nil
+}
+
+func (m *MockSecrets) List() []domain.SecretRef {
+	return []domain.SecretRef{{Site: "github.com", Key: "password"}}
+}
+
+// MockOTP knows a TOTP seed for github.com only.
+type MockOTP struct{}
+
+func (m *MockOTP) OTPFor(site, host string) (string, error) {
+	if site != "github.com" {
+		return "", fmt.Errorf("no seed for %s", site)
+	}
+	if host != "github.com" {
+		return "", fmt.Errorf("secrets for github.com can't be used on %s", host)
+	}
+	return "123456", nil
+}
+
+// MockRedactor hides one known email address.
+type MockRedactor struct{}
+
+func (m *MockRedactor) Redact(text string) string {
+	return strings.ReplaceAll(text, "bob@example.com", "[REDACTED:email]")
+}
+
+func (m *MockRedactor) RedactValue(v interface{}) interface{} {
+	if tree, ok := v.(map[string]interface{}); ok {
+		for k, child := range tree {
+			if s, ok := child.(string); ok {
+				tree[k] = m.Redact(s)
+			}
+		}
+	}
+	return v
+}
+
+// MockRecorder keeps flight records in memory.
+type MockRecorder struct {
+	records []domain.FlightRecord
+}
+
+func (m *MockRecorder) Record(ctx context.Context, rec domain.FlightRecord) error {
+	m.records = append(m.records, rec)
+	return nil
+}
+
 // MockVectorStore implements ports.VectorStore for testing.
 type MockVectorStore struct{}
 
@@ -91,3 +239,1199 @@ func TestTools(t *testing.T) {
 		t.Errorf("Expected click on #submit, got %s", browser.clicked)
 	}
 }
+
+func TestReadPageTool(t *testing.T) {
+	readTool := &ReadPageTool{Browser: &MockBrowser{}}
+	if readTool.IsLongRunning() {
+		t.Error("ReadPageTool should not be long running")
+	}
+
+	out, err := readTool.Run(context.Background(), struct{ Offset int }{Offset: 0})
+	if err != nil {
+		t.Fatalf("ReadPageTool failed: %v", err)
+	}
+	if !strings.Contains(out, "Some article text.") {
+		t.Errorf("Expected article text in output, got %s", out)
+	}
+	if !strings.Contains(out, "End of page") {
+		t.Errorf("Expected end-of-page marker, got %s", out)
+	}
+
+	// The header reports where the chunk really ends (where the next one starts), not the trimmed text's length
+	readTool.Browser = &MockBrowser{chunk: &domain.PageChunk{Markdown: "First part.", Offset: 100, NextOffset: 160, Total: 500}}
+	out, _ = readTool.Run(context.Background(), struct{ Offset int }{Offset: 100})
+	if !strings.Contains(out, "Showing characters 100-160 of 500.") || !strings.Contains(out, "offset 160") {
+		t.Errorf("Expected the chunk to end at 160, got %s", out)
+	}
+}
+
+func TestHandleDialogTool(t *testing.T) {
+	browser := &MockBrowser{}
+	dialogTool := &HandleDialogTool{Browser: browser}
+
+	out, err := dialogTool.Run(context.Background(), struct {
+		Accept     bool
+		PromptText string
+	}{Accept: true, PromptText: "Kortex"})
+	if err != nil {
+		t.Fatalf("HandleDialogTool failed: %v", err)
+	}
+	if browser.dialog != "true:Kortex" {
+		t.Errorf("Expected dialog accepted with prompt text, got %s", browser.dialog)
+	}
+	if out != "Accepted dialog" {
+		t.Errorf("Unexpected output %q", out)
+	}
+}
+
+func TestGetPageErrorsTool(t *testing.T) {
+	browser := &MockBrowser{}
+	errorsTool := &GetPageErrorsTool{Browser: browser}
+
+	out, err := errorsTool.Run(context.Background(), struct{}{})
+	if err != nil {
+		t.Fatalf("GetPageErrorsTool failed: %v", err)
+	}
+	if !strings.Contains(out, "No errors") {
+		t.Errorf("Expected no errors message, got %s", out)
+	}
+
+	browser.pageErrors = []domain.PageError{
+		{Seq: 1, Kind: "pageerror", Message: "TypeError: x is undefined"},
+		{Seq: 2, Kind: "http_error", Message: "POST /api/cart returned 500", Status: 500},
+	}
+	out, err = errorsTool.Run(context.Background(), struct{}{})
+	if err != nil {
+		t.Fatalf("GetPageErrorsTool failed: %v", err)
+	}
+	if !strings.Contains(out, "[http_error] POST /api/cart returned 500") {
+		t.Errorf("Expected http error in output, got %s", out)
+	}
+}
+
+func TestRecordPageErrors(t *testing.T) {
+	browser := &MockBrowser{pageErrors: []domain.PageError{{Seq: 3, Kind: "console", Message: "error: boom"}}}
+	recorder := &MockRecorder{}
+	agent := NewAgent(browser, &MockVectorStore{}, "fake-api-key", WithRecorder(recorder))
+
+	run := &taskRun{id: "task-1"}
+	ctx := &MockToolContext{ctx: withTaskRun(context.Background(), run), callID: "call-1"}
+	if _, err := agent.recordPageErrors(ctx, &ClickTool{}, nil, nil, nil); err != nil {
+		t.Fatalf("recordPageErrors failed: %v", err)
+	}
+	if run.lastErrorSeq != 3 || len(recorder.records) != 1 {
+		t.Errorf("Expected one record and last error seq 3, got %d and %d", len(recorder.records), run.lastErrorSeq)
+	}
+
+	// The same errors aren't written twice
+	agent.recordPageErrors(ctx, &ClickTool{}, nil, nil, nil)
+	if len(recorder.records) != 1 {
+		t.Errorf("Expected no new record, got %d records", len(recorder.records))
+	}
+}
+
+func TestCheckApproval(t *testing.T) {
+	approver := &MockApprover{approve: false}
+	agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "fake-api-key", WithApprover(approver))
+
+	// Ordinary clicks go straight through without asking.
+	if _, err := agent.checkApproval(nil, &ClickTool{}, map[string]any{"Selector": "#hello"}); err != nil {
+		t.Errorf("Ordinary click should not need approval, got %v", err)
+	}
+	if len(approver.requests) != 0 {
+		t.Fatalf("Expected no approval requests, got %d", len(approver.requests))
+	}
+
+	// Purchases need approval, and a "no" skips the tool call and stops the task.
+	run := &taskRun{id: "task-1"}
+	ctx := &MockToolContext{ctx: withTaskRun(context.Background(), run), callID: "call-1"}
+	if out, err := agent.checkApproval(ctx, &ClickTool{}, map[string]any{"Selector": "#buy"}); err != nil || out["error"] == nil {
+		t.Errorf("Declined purchase should be answered in the tool's place, got %v, %v", out, err)
+	}
+	if !errors.Is(run.stopErr, ErrDeclined) {
+		t.Errorf("Declined purchase should stop the task, got %v", run.stopErr)
+	}
+	if len(approver.requests) != 1 || approver.requests[0].Message != `Click "Place order"` {
+		t.Fatalf("Expected one approval request for the order button, got %+v", approver.requests)
+	}
+
+	// Typing into a password field asks too, without revealing the password.
+	approver.approve = true
+	if _, err := agent.checkApproval(nil, &TypeTool{}, map[string]any{"Selector": "#password", "Text": "hunter2"}); err != nil {
+		t.Errorf("Approved password entry should pass, got %v", err)
+	}
+	if got := approver.requests[1].Args["Text"]; got != "********" {
+		t.Errorf("Password should be masked in approval request, got %v", got)
+	}
+
+	// An element that can't be looked at might be anything, so the user is asked
+	for _, tool := range []tool.Tool{&ClickTool{}, &TypeTool{}} {
+		agent.checkApproval(nil, tool, map[string]any{"Selector": "#missing", "Text": "hunter2"})
+	}
+	if len(approver.requests) != 4 || approver.requests[2].Reason != "unknown element" || approver.requests[3].Reason != "unknown element" {
+		t.Errorf("Expected approval for elements that couldn't be checked, got %+v", approver.requests[2:])
+	}
+
+	// ...except behind a dialog, where the action can't run either
+	agent.checkApproval(nil, &ClickTool{}, map[string]any{"Selector": "#behind-dialog"})
+	if len(approver.requests) != 4 {
+		t.Errorf("Expected no approval while a dialog blocks the page, got %+v", approver.requests[4:])
+	}
+}
+
+func TestAskUserTool(t *testing.T) {
+	asker := &MockAsker{answer: "The Grand Hotel"}
+	askTool := &AskUserTool{Asker: asker}
+	if !askTool.IsLongRunning() {
+		t.Error("AskUserTool should be long running")
+	}
+
+	out, err := askTool.Run(context.Background(), struct{ Question string }{Question: "Which hotel?"})
+	if err != nil {
+		t.Fatalf("AskUserTool failed: %v", err)
+	}
+	if asker.question != "Which hotel?" {
+		t.Errorf("Expected question to reach the user, got %q", asker.question)
+	}
+	if !strings.Contains(out, "The Grand Hotel") {
+		t.Errorf("Expected answer in output, got %s", out)
+	}
+}
+
+func TestTypeToolResolvesSecrets(t *testing.T) {
+	mockBrowser := &MockBrowser{navigatedURL: "https://github.com/login"}
+	typeTool := &TypeTool{Browser: mockBrowser, Secrets: &MockSecrets{}}
+
+	out, err := typeTool.Run(context.Background(), struct {
+		Selector string
+		Text     string
+	}{Selector: "#password", Text: "{{secret:github.com.password}}"})
+	if err != nil {
+		t.Fatalf("TypeTool failed: %v", err)
+	}
+	if mockBrowser.typed != "#password:hunter2" {
+		t.Errorf("Expected secret to be typed, got %s", mockBrowser.typed)
+	}
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("Tool output must not contain the secret: %s", out)
+	}
+
+	if _, err := typeTool.Run(context.Background(), struct {
+		Selector string
+		Text     string
+	}{Selector: "#password", Text: "{{secret:gitlab.com.password}}"}); err == nil {
+		t.Error("Expected error for unknown secret")
+	}
+
+	// A page on another site doesn't get github.com's password, even if it asks nicely
+	mockBrowser.navigatedURL, mockBrowser.typed = "https://github.com.evil.example/login", ""
+	if _, err := typeTool.Run(context.Background(), struct {
+		Selector string
+		Text     string
+	}{Selector: "#password", Text: "{{secret:github.com.password}}"}); err == nil || mockBrowser.typed != "" {
+		t.Errorf("Expected the secret to be refused on another site, got %v (typed %q)", err, mockBrowser.typed)
+	}
+}
+
+func TestFillOTPTool(t *testing.T) {
+	mockBrowser := &MockBrowser{navigatedURL: "https://github.com/sessions/two-factor"}
+	asker := &MockAsker{answer: " 654321 "}
+	otpTool := &FillOTPTool{Browser: mockBrowser, OTP: &MockOTP{}, Asker: asker}
+
+	run := func(site string) (string, error) {
+		return otpTool.Run(context.Background(), struct {
+			Selector string
+			Site     string
+		}{Selector: "#otp", Site: site})
+	}
+
+	// Seed in the vault: generated locally, the user isn't bothered
+	out, err := run("github.com")
+	if err != nil {
+		t.Fatalf("FillOTPTool failed: %v", err)
+	}
+	if mockBrowser.typed != "#otp:123456" || asker.question != "" {
+		t.Errorf("Expected generated code without asking, got %s (asked %q)", mockBrowser.typed, asker.question)
+	}
+	if strings.Contains(out, "123456") {
+		t.Errorf("Tool output must not contain the code: %s", out)
+	}
+
+	// No seed: falls back to asking the user
+	if _, err := run("bank.example"); err != nil {
+		t.Fatalf("FillOTPTool fallback failed: %v", err)
+	}
+	if mockBrowser.typed != "#otp:654321" {
+		t.Errorf("Expected user's code to be typed, got %s", mockBrowser.typed)
+	}
+
+	// No seed and nobody to ask
+	otpTool.Asker = nil
+	if _, err := run("bank.example"); err == nil {
+		t.Error("Expected error without seed or asker")
+	}
+
+	// The seed is only used on its own site
+	mockBrowser.navigatedURL = "https://evil.example/2fa"
+	if _, err := run("github.com"); err == nil {
+		t.Error("Expected the code to be refused on another site")
+	}
+}
+
+func TestGetSnapshotToolRedacts(t *testing.T) {
+	mockBrowser := &MockBrowser{snapshot: `{"role":"body","name":"Signed in as bob@example.com","selector":"body"}`}
+	snapshotTool := &GetSnapshotTool{Browser: mockBrowser, Redactor: &MockRedactor{}}
+
+	out, err := snapshotTool.Run(context.Background(), struct{}{})
+	if err != nil {
+		t.Fatalf("GetSnapshotTool failed: %v", err)
+	}
+	if strings.Contains(out, "bob@example.com") || !strings.Contains(out, "[REDACTED:email]") {
+		t.Errorf("Expected email to be redacted, got %s", out)
+	}
+	if !strings.Contains(out, `"selector": "body"`) {
+		t.Errorf("Expected the rest of the snapshot to survive, got %s", out)
+	}
+}
+
+func TestRecordToolStep(t *testing.T) {
+	recorder := &MockRecorder{}
+	agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "key", WithRecorder(recorder))
+
+	agent.recordToolStep(nil, &ClickTool{}, map[string]any{"Selector": "#buy"}, nil, fmt.Errorf("element not found"))
+	if len(recorder.records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(recorder.records))
+	}
+	rec := recorder.records[0]
+	if rec.Kind != "tool" || rec.Tool != "click" || rec.Error != "element not found" {
+		t.Errorf("Unexpected record %+v", rec)
+	}
+
+	// Inside a task, records carry the task, session and step
+	ctx := withTaskRun(context.Background(), &taskRun{id: "task-1", sessionID: "session-1", step: 3})
+	agent.record(ctx, domain.FlightRecord{Kind: "approval"})
+	rec = recorder.records[1]
+	if rec.TaskID != "task-1" || rec.SessionID != "session-1" || rec.Step != 3 {
+		t.Errorf("Expected task scope to be filled in, got %+v", rec)
+	}
+}
+
+// MockToolContext is the bit of tool.Context the callbacks use: a context and a call ID.
+type MockToolContext struct {
+	tool.Context
+	ctx    context.Context
+	callID string
+}
+
+func (m *MockToolContext) Deadline() (deadline time.Time, ok bool) { return m.ctx.Deadline() }
+func (m *MockToolContext) Done() <-chan struct{}                   { return m.ctx.Done() }
+func (m *MockToolContext) Err() error                              { return m.ctx.Err() }
+func (m *MockToolContext) Value(key any) any                       { return m.ctx.Value(key) }
+func (m *MockToolContext) FunctionCallID() string                  { return m.callID }
+
+func TestToolCallsAreTraced(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(previous)
+
+	recorder := &MockRecorder{}
+	agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "key", WithRecorder(recorder))
+
+	run := &taskRun{id: "task-1", sessionID: "session-1"}
+	ctx, taskSpan := startTaskSpan(withTaskRun(context.Background(), run), run)
+	toolCtx := &MockToolContext{ctx: ctx, callID: "call-1"}
+
+	args := map[string]any{"Selector": "#buy", "Text": "hunter2"}
+	agent.startToolStep(toolCtx, &ClickTool{}, args)
+	agent.recordToolStep(toolCtx, &ClickTool{}, args, nil, fmt.Errorf("element not found"))
+	taskSpan.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected task and tool spans, got %d", len(spans))
+	}
+	toolSpan, task := spans[0], spans[1]
+	if toolSpan.Name != "kortex.tool click" || toolSpan.Parent.SpanID() != task.SpanContext.SpanID() {
+		t.Errorf("Expected a click span under the task span, got %q", toolSpan.Name)
+	}
+	if toolSpan.Status.Code != codes.Error {
+		t.Errorf("Expected the failed click to be marked as an error, got %v", toolSpan.Status)
+	}
+	attrs := map[string]string{}
+	for _, kv := range toolSpan.Attributes {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs["kortex.selector"] != "#buy" || attrs["kortex.step"] != "1" {
+		t.Errorf("Missing selector or step attributes: %v", attrs)
+	}
+	for _, v := range attrs {
+		if strings.Contains(v, "hunter2") {
+			t.Error("Typed text must not end up in spans")
+		}
+	}
+
+	// The flight record points at the trace
+	if rec := recorder.records[0]; rec.TraceID != task.SpanContext.TraceID().String() {
+		t.Errorf("Expected trace ID %s on the record, got %q", task.SpanContext.TraceID(), rec.TraceID)
+	}
+}
+
+func TestTaskOutcome(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{context.Background(), nil, "completed"},
+		{context.Background(), fmt.Errorf("model refused"), "failed"},
+		{context.Background(), fmt.Errorf("run: %w", context.Canceled), "cancelled"},
+		{cancelled, fmt.Errorf("stream closed"), "cancelled"},
+		{context.Background(), fmt.Errorf("%w: task used 120 tokens", ErrBudgetExceeded), "budget_exceeded"},
+	}
+	for _, c := range cases {
+		if got := taskOutcome(c.ctx, c.err); got != c.want {
+			t.Errorf("taskOutcome(%v) = %q, want %q", c.err, got, c.want)
+		}
+	}
+
+	if err := NewAgent(&MockBrowser{}, &MockVectorStore{}, "").CheckConfig(); err == nil {
+		t.Error("Expected CheckConfig to fail without an API key")
+	}
+}
+
+// MockCallbackContext is the bit of agent.CallbackContext the model callbacks use: a context.
+type MockCallbackContext struct {
+	adkagent.CallbackContext
+	ctx context.Context
+}
+
+func (m *MockCallbackContext) Deadline() (deadline time.Time, ok bool) { return m.ctx.Deadline() }
+func (m *MockCallbackContext) Done() <-chan struct{}                   { return m.ctx.Done() }
+func (m *MockCallbackContext) Err() error                              { return m.ctx.Err() }
+func (m *MockCallbackContext) Value(key any) any                       { return m.ctx.Value(key) }
+
+// MockUsageStore keeps the latest usage of each task and reports a fixed daily total.
+type MockUsageStore struct {
+	saved map[string]domain.TaskUsage
+	today domain.TaskUsage
+}
+
+func (m *MockUsageStore) SaveUsage(ctx context.Context, usage domain.TaskUsage) error {
+	m.saved[usage.TaskID] = usage
+	return nil
+}
+
+func (m *MockUsageStore) UsageSince(ctx context.Context, since time.Time) (domain.TaskUsage, error) {
+	return m.today, nil
+}
+
+func (m *MockUsageStore) SessionUsage(ctx context.Context, sessionID string) (domain.TaskUsage, error) {
+	return domain.TaskUsage{}, nil
+}
+
+func TestUsageIsAddedUpAndBudgetStopsTask(t *testing.T) {
+	store := &MockUsageStore{saved: map[string]domain.TaskUsage{}}
+	agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "key",
+		WithUsageStore(store),
+		WithBudget(domain.Budget{TaskTokens: 150}),
+		WithPricing(Pricing{InputPerMillion: 1, OutputPerMillion: 10}),
+	)
+
+	run := &taskRun{id: "task-1", sessionID: "session-1"}
+	run.usage = domain.TaskUsage{TaskID: "task-1", SessionID: "session-1", Model: agent.model.Model}
+	ctx := &MockCallbackContext{ctx: withTaskRun(context.Background(), run)}
+	resp := &model.LLMResponse{UsageMetadata: &genai.GenerateContentResponseUsageMetadata{
+		PromptTokenCount: 60, CandidatesTokenCount: 20, TotalTokenCount: 80,
+	}}
+
+	// First turn: under budget, so the next model call goes ahead
+	agent.recordModelCall(ctx, resp, nil)
+	if stop, _ := agent.haltIfStopped(ctx, &model.LLMRequest{}); stop != nil {
+		t.Fatal("Expected the task to continue under budget")
+	}
+
+	// Second turn: 160 tokens in total, over the 150 token budget
+	agent.recordModelCall(ctx, resp, nil)
+	usage := store.saved["task-1"]
+	if usage.ModelCalls != 2 || usage.PromptTokens != 120 || usage.CompletionTokens != 40 || usage.TotalTokens != 160 {
+		t.Errorf("Unexpected usage totals %+v", usage)
+	}
+	if want := (120*1.0 + 40*10.0) / 1e6; usage.CostUSD < want-1e-12 || usage.CostUSD > want+1e-12 {
+		t.Errorf("Expected cost %v, got %v", want, usage.CostUSD)
+	}
+	stop, _ := agent.haltIfStopped(ctx, &model.LLMRequest{})
+	if stop == nil || !strings.Contains(stop.Content.Parts[0].Text, "budget exceeded") {
+		t.Fatalf("Expected the model call to be replaced by a stop message, got %+v", stop)
+	}
+
+	// Daily budgets count every task saved today
+	agent.budget = domain.Budget{DailyUSD: 5}
+	store.today = domain.TaskUsage{CostUSD: 5.5}
+	if err := agent.checkBudget(context.Background(), domain.TaskUsage{}); err == nil || !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected the daily budget to be exceeded, got %v", err)
+	}
+}
+
+func TestUsageIsPricedByTheModelThatAnswered(t *testing.T) {
+	agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "key",
+		WithModelConfig(domain.ModelConfig{Model: "gemini-2.5-pro"}),
+		WithBudget(domain.Budget{TaskUSD: 1}),
+	)
+	run := &taskRun{id: "task-1"}
+	run.usage = domain.TaskUsage{TaskID: "task-1", Model: "gemini-2.5-pro"}
+	ctx := &MockCallbackContext{ctx: withTaskRun(context.Background(), run)}
+	resp := func(served string) *model.LLMResponse {
+		resp := &model.LLMResponse{UsageMetadata: &genai.GenerateContentResponseUsageMetadata{
+			PromptTokenCount: 1000, CandidatesTokenCount: 100, TotalTokenCount: 1100,
+		}}
+		markServedBy(resp, domain.ModelConfig{Model: served}, nil)
+		return resp
+	}
+
+	// Pro answered, then the task fell back to Flash: each is billed at its own rate
+	agent.recordModelCall(ctx, resp("gemini-2.5-pro"), nil)
+	agent.recordModelCall(ctx, resp("gemini-2.5-flash"), nil)
+	want := (1000*1.25+100*10.00)/1e6 + (1000*0.30+100*2.50)/1e6
+	if got := run.usage.CostUSD; got < want-1e-12 || got > want+1e-12 {
+		t.Errorf("Expected cost %v, got %v", want, got)
+	}
+	if run.stopErr != nil {
+		t.Fatalf("Expected the task to go on, got %v", run.stopErr)
+	}
+
+	// A model without a price would make the dollar budget useless, so the task stops
+	agent.recordModelCall(ctx, resp("gpt-4o"), nil)
+	if !errors.Is(run.stopErr, ErrNoPrice) {
+		t.Errorf("Expected the task to stop for lack of a price, got %v", run.stopErr)
+	}
+	if err := agent.checkPriced("gpt-4o"); !errors.Is(err, ErrNoPrice) {
+		t.Errorf("Expected a task on an unpriced model not to start, got %v", err)
+	}
+
+	// Without a dollar budget it only costs $0 (and a log line)
+	agent.budget = domain.Budget{}
+	if err := agent.checkPriced("gpt-4o"); err != nil {
+		t.Errorf("Expected no error without a dollar budget, got %v", err)
+	}
+}
+
+func TestLimitsStopRunawayTasks(t *testing.T) {
+	recorder := &MockRecorder{}
+	agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "key", WithRecorder(recorder),
+		WithLimits(Limits{MaxToolCalls: 5, RepeatLimit: 2}))
+
+	run := &taskRun{id: "task-1"}
+	toolCtx := &MockToolContext{ctx: withTaskRun(context.Background(), run), callID: "call-1"}
+	call := func(args map[string]any) map[string]any {
+		agent.startToolStep(toolCtx, &ClickTool{}, args)
+		result, _ := agent.checkLimits(toolCtx, &ClickTool{}, args)
+		return result
+	}
+
+	// Repeating a click gets a hint first...
+	if result := call(map[string]any{"Selector": "#next"}); result != nil {
+		t.Fatalf("Expected the first click to go ahead, got %v", result)
+	}
+	result := call(map[string]any{"Selector": "#next"})
+	if msg, _ := result["error"].(string); !strings.Contains(msg, "You are stuck") {
+		t.Fatalf("Expected a stuck hint, got %v", result)
+	}
+	if run.stopErr != nil {
+		t.Fatal("A hint must not stop the task")
+	}
+
+	// ...and the task is stopped if the agent keeps going round in circles
+	call(map[string]any{"Selector": "#next"})
+	call(map[string]any{"Selector": "#next"})
+	if outcome := taskOutcome(context.Background(), run.stopErr); outcome != ReasonStuck {
+		t.Fatalf("Expected the task to stop as stuck, got %q (%v)", outcome, run.stopErr)
+	}
+	if stop, _ := agent.haltIfStopped(&MockCallbackContext{ctx: toolCtx.ctx}, &model.LLMRequest{}); stop == nil {
+		t.Error("Expected the next model call to be replaced by a stop message")
+	}
+	if last := recorder.records[len(recorder.records)-1]; last.Kind != "limit" {
+		t.Errorf("Expected the stop to be recorded, got %+v", last)
+	}
+
+	// Too many tool calls, even different ones, stop the task too
+	run = &taskRun{id: "task-2"}
+	toolCtx = &MockToolContext{ctx: withTaskRun(context.Background(), run), callID: "call-2"}
+	for i := 0; i < 6; i++ {
+		call(map[string]any{"Selector": fmt.Sprintf("#item-%d", i)})
+	}
+	if outcome := taskOutcome(context.Background(), run.stopErr); outcome != ReasonMaxToolCalls {
+		t.Errorf("Expected the task to stop at the tool call limit, got %q", outcome)
+	}
+}
+
+func TestLimitsDetectUnchangedPage(t *testing.T) {
+	agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "key", WithLimits(Limits{RepeatLimit: 3, OnLoop: LoopStop}))
+	run := &taskRun{id: "task-1"}
+	toolCtx := &MockToolContext{ctx: withTaskRun(context.Background(), run), callID: "call-1"}
+
+	snapshot := map[string]any{"result": `{"role":"WebArea","name":"Checkout"}`}
+	for i := 0; i < 2; i++ {
+		if out, _ := agent.checkSnapshots(toolCtx, &GetSnapshotTool{}, nil, snapshot, nil); out != nil {
+			t.Fatalf("Snapshot %d flagged too early: %v", i+1, out)
+		}
+	}
+	out, _ := agent.checkSnapshots(toolCtx, &GetSnapshotTool{}, nil, snapshot, nil)
+	if out["result"] != snapshot["result"] || out["error"] == nil {
+		t.Errorf("Expected the snapshot plus a warning, got %v", out)
+	}
+	if !errors.Is(run.stopErr, ErrLimitReached) {
+		t.Errorf("Expected LoopStop to stop the task, got %v", run.stopErr)
+	}
+}
+
+func TestTimeoutIsReportedAsLimit(t *testing.T) {
+	agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "key", WithLimits(Limits{Timeout: time.Millisecond}))
+	ctx, cancel := agent.withTimeout(context.Background())
+	defer cancel()
+	<-ctx.Done()
+	if outcome := taskOutcome(ctx, context.Cause(ctx)); outcome != ReasonTimeout {
+		t.Errorf("Expected outcome %q, got %q", ReasonTimeout, outcome)
+	}
+}
+
+func TestTaskModelOverridesDefault(t *testing.T) {
+	agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "key",
+		WithProvider(&llm.OpenAI{BaseURL: "http://localhost:11434/v1"}),
+		WithModelConfig(domain.ModelConfig{MaxTokens: 1024}),
+	)
+	if cfg := agent.modelConfig(context.Background()); cfg.Provider != llm.ProviderGemini || cfg.Model != llm.DefaultGeminiModel || cfg.MaxTokens != 1024 {
+		t.Errorf("Unexpected default model %+v", cfg)
+	}
+
+	// Switching provider drops the default model name but keeps the other settings
+	ctx := WithTaskModel(context.Background(), domain.ModelConfig{Provider: llm.ProviderOpenAI, Model: "llama3.1"})
+	cfg := agent.modelConfig(ctx)
+	if cfg.Provider != llm.ProviderOpenAI || cfg.Model != "llama3.1" || cfg.MaxTokens != 1024 {
+		t.Errorf("Unexpected task model %+v", cfg)
+	}
+	if m, err := agent.newModel(ctx, cfg); err != nil || m.Name() != "llama3.1" {
+		t.Errorf("Expected a llama3.1 model, got %v (%v)", m, err)
+	}
+	if _, err := agent.newModel(ctx, domain.ModelConfig{Provider: "mystery"}); err == nil {
+		t.Error("Expected an unknown provider to fail")
+	}
+
+	if err := NewAgent(&MockBrowser{}, &MockVectorStore{}, "",
+		WithProvider(&llm.OpenAI{BaseURL: "http://localhost:11434/v1"}),
+		WithModelConfig(domain.ModelConfig{Provider: llm.ProviderOpenAI, Model: "llama3.1"}),
+	).CheckConfig(); err != nil {
+		t.Errorf("A local model needs no Gemini key, got %v", err)
+	}
+}
+
+func TestExecuteTaskWithScriptedModel(t *testing.T) {
+	script := llm.NewScriptedModel(llm.Script{Turns: []llm.Turn{
+		{Calls: []llm.Call{{Tool: "navigate", Args: map[string]any{"URL": "https://shop.example"}, Want: "Navigated to https://shop.example"}}},
+		{Calls: []llm.Call{
+			{Tool: "highlight", Args: map[string]any{"Selector": "#buy", "Message": "Buying"}, Want: "Highlighted #buy"},
+			{Tool: "click", Args: map[string]any{"Selector": "#buy"}, WantError: "user declined"},
+		}, PromptTokens: 200, CompletionTokens: 20},
+	}})
+	browser := &MockBrowser{}
+	recorder := &MockRecorder{}
+	agent := NewAgent(browser, &MockVectorStore{}, "",
+		WithProvider(script),
+		WithModelConfig(domain.ModelConfig{Provider: llm.ProviderScript}),
+		WithApprover(&MockApprover{approve: false}),
+		WithRecorder(recorder),
+	)
+
+	// The user said no to the purchase, so the task stops there
+	result, err := agent.Execute(context.Background(), "Buy the first item")
+	if !errors.Is(err, ErrDeclined) {
+		t.Fatalf("Expected the task to stop on the decline, got %v", err)
+	}
+	if err := script.Err(); err != nil {
+		t.Fatalf("Script did not play out: %v", err)
+	}
+	if browser.navigatedURL != "https://shop.example" || browser.highlighted != "#buy" || browser.clicked != "" {
+		t.Errorf("Unexpected browser state %+v", browser)
+	}
+	if result.Outcome != "cancelled" || result.Usage.ModelCalls != 2 || result.Usage.TotalTokens != 220 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	// The declined click never ran, but it is still a step, with the decline as its error
+	var steps []string
+	for _, rec := range recorder.records {
+		if rec.Kind == "tool" || rec.Kind == "approval" {
+			steps = append(steps, rec.Kind+":"+rec.Tool)
+		}
+	}
+	if strings.Join(steps, ",") != "tool:navigate,tool:highlight,approval:click,tool:click" {
+		t.Errorf("Unexpected steps in the flight recorder: %v", steps)
+	}
+}
+
+func TestFailedToolIsRecorded(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(previous)
+
+	script := llm.NewScriptedModel(llm.Script{Turns: []llm.Turn{
+		{Calls: []llm.Call{{Tool: "click", Args: map[string]any{"Selector": "#gone"}, WantError: "element not found"}}},
+		{Text: "The button is gone."},
+	}})
+	recorder := &MockRecorder{}
+	agent := NewAgent(&MockBrowser{clickErr: fmt.Errorf("element not found: #gone")}, &MockVectorStore{}, "",
+		WithProvider(script),
+		WithModelConfig(domain.ModelConfig{Provider: llm.ProviderScript}),
+		WithRecorder(recorder),
+	)
+	if _, err := agent.Execute(context.Background(), "Click the button"); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if err := script.Err(); err != nil {
+		t.Fatalf("Script did not play out: %v", err)
+	}
+
+	var failed, pageErrors *domain.FlightRecord
+	for i, rec := range recorder.records {
+		switch rec.Kind {
+		case "tool":
+			failed = &recorder.records[i]
+		case "page_errors":
+			pageErrors = &recorder.records[i]
+		}
+	}
+	if failed == nil || failed.Tool != "click" || failed.Step != 1 || !strings.Contains(failed.Error, "element not found") {
+		t.Fatalf("Expected the failed click in the flight recorder, got %+v", failed)
+	}
+	if pageErrors == nil || pageErrors.Tool != "click" {
+		t.Errorf("Expected the page errors of the failed click to be recorded, got %+v", pageErrors)
+	}
+
+	// Only ended spans are exported, so the click's span being here means it was closed
+	var clickSpan bool
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "kortex.tool click" && span.Status.Code == codes.Error {
+			clickSpan = true
+		}
+	}
+	if !clickSpan {
+		t.Error("Expected the failed click's span to be ended with an error")
+	}
+}
+
+func TestExecuteTaskFromScriptFile(t *testing.T) {
+	s, err := llm.LoadScript("testdata/stuck_loop.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := llm.NewScriptedModel(s)
+	agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "",
+		WithProvider(script),
+		WithModelConfig(domain.ModelConfig{Provider: llm.ProviderScript}),
+		WithLimits(Limits{RepeatLimit: 2}),
+	)
+
+	result, err := agent.Execute(context.Background(), "Get to the last page")
+	if !errors.Is(err, ErrLimitReached) || result.Outcome != ReasonStuck {
+		t.Fatalf("Expected the task to stop as stuck, got %q (%v)", result.Outcome, err)
+	}
+	if err := script.Err(); err != nil {
+		t.Errorf("Script did not play out: %v", err)
+	}
+	if result.Usage.TotalTokens != 560 {
+		t.Errorf("Expected 560 tokens, got %d", result.Usage.TotalTokens)
+	}
+}
+
+func TestExecuteTaskReplaysRecordedResponses(t *testing.T) {
+	dir := t.TempDir()
+	script := llm.Script{Turns: []llm.Turn{
+		{Calls: []llm.Call{{Tool: "navigate", Args: map[string]any{"URL": "https://shop.example"}}}, PromptTokens: 100, CompletionTokens: 10},
+		{Text: "The shop is open."},
+	}}
+	run := func(mode string, model *llm.ScriptedModel) (*domain.TaskResult, error) {
+		cache, err := llm.NewCache(mode, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "",
+			WithProvider(model),
+			WithModelConfig(domain.ModelConfig{Provider: llm.ProviderScript, Model: "fake"}),
+			WithModelCache(cache),
+		)
+		return agent.Execute(context.Background(), "Open the shop")
+	}
+
+	// Record: the scripted model answers and every response is saved
+	if _, err := run(llm.CacheRecord, llm.NewScriptedModel(script)); err != nil {
+		t.Fatalf("Recording failed: %v", err)
+	}
+
+	// Replay: a model with nothing to say must not be asked
+	silent := llm.NewScriptedModel(llm.Script{})
+	result, err := run(llm.CacheReplay, silent)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if result.Outcome != "completed" || result.Usage.ModelCalls != 2 || result.Usage.TotalTokens != 110 {
+		t.Errorf("Unexpected replayed result %+v", result)
+	}
+	if err := silent.Err(); err != nil {
+		t.Errorf("The model was asked during replay: %v", err)
+	}
+
+	// A goal that was never recorded fails instead of reaching the model
+	cache, _ := llm.NewCache(llm.CacheReplay, dir)
+	agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "",
+		WithModelConfig(domain.ModelConfig{Provider: llm.ProviderGemini}),
+		WithModelCache(cache),
+	)
+	if err := agent.CheckConfig(); err != nil {
+		t.Errorf("Replay needs no API key, got %v", err)
+	}
+	if _, err := agent.Execute(context.Background(), "Close the shop"); !errors.Is(err, llm.ErrNotRecorded) {
+		t.Errorf("Expected ErrNotRecorded, got %v", err)
+	}
+}
+
+// MockFlakyModel fails its first calls with errs, then hands over to next.
+// It is its own provider, registered under name.
+type MockFlakyModel struct {
+	name  string
+	errs  []error
+	next  model.LLM
+	calls int
+}
+
+func (m *MockFlakyModel) Name() string { return m.name }
+
+func (m *MockFlakyModel) Check() error { return nil }
+
+func (m *MockFlakyModel) NewModel(ctx context.Context, cfg domain.ModelConfig) (model.LLM, error) {
+	return m, nil
+}
+
+func (m *MockFlakyModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		m.calls++
+		if len(m.errs) > 0 {
+			err := m.errs[0]
+			m.errs = m.errs[1:]
+			yield(nil, err)
+			return
+		}
+		if m.next == nil {
+			yield(nil, &llm.APIError{API: "test", StatusCode: 503, Status: "503 Service Unavailable", Message: "still down"})
+			return
+		}
+		for resp, err := range m.next.GenerateContent(ctx, req, stream) {
+			if !yield(resp, err) {
+				return
+			}
+		}
+	}
+}
+
+func TestModelRetriesAndFallbacks(t *testing.T) {
+	busy := &llm.APIError{API: "test", StatusCode: 429, Status: "429 Too Many Requests", Message: "slow down", RetryAfter: time.Millisecond}
+	overflow := &llm.APIError{API: "test", StatusCode: 400, Status: "400 Bad Request", Message: "This model's maximum context length is 8192 tokens"}
+	answer := llm.Script{Turns: []llm.Turn{{Text: "Done."}}}
+	policy := RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, Fallbacks: []domain.ModelConfig{{Provider: llm.ProviderScript}}}
+	kinds := func(recorder *MockRecorder) string {
+		var out []string
+		for _, rec := range recorder.records {
+			if rec.Kind == "retry" || rec.Kind == "fallback" || rec.Kind == "circuit_open" {
+				out = append(out, rec.Kind)
+			}
+		}
+		return strings.Join(out, ",")
+	}
+	newAgent := func(flaky *MockFlakyModel, fallback *llm.ScriptedModel, recorder *MockRecorder, policy RetryPolicy) *AgentAdapter {
+		return NewAgent(&MockBrowser{}, &MockVectorStore{}, "",
+			WithProvider(flaky), WithProvider(fallback),
+			WithModelConfig(domain.ModelConfig{Provider: "flaky", Model: "pro"}),
+			WithRecorder(recorder),
+			WithRetryPolicy(policy),
+		)
+	}
+
+	// Two rate limits, then the model answers: no fallback needed
+	flaky := &MockFlakyModel{name: "flaky", errs: []error{busy, busy}, next: llm.NewScriptedModel(answer)}
+	recorder := &MockRecorder{}
+	if _, err := newAgent(flaky, llm.NewScriptedModel(llm.Script{}), recorder, policy).Execute(context.Background(), "Go"); err != nil {
+		t.Fatalf("Expected the retries to succeed, got %v", err)
+	}
+	if got := kinds(recorder); got != "retry,retry" {
+		t.Errorf("Expected two retries, got %q", got)
+	}
+
+	// Still failing after the retries: the fallback model takes over, and the user is told as it happens
+	fallback := llm.NewScriptedModel(answer)
+	recorder = &MockRecorder{}
+	var events []string
+	ctx := WithTaskEvents(context.Background(), func(rec domain.FlightRecord) {
+		events = append(events, DescribeRecovery(rec))
+	})
+	if _, err := newAgent(&MockFlakyModel{name: "flaky"}, fallback, recorder, policy).Execute(ctx, "Go"); err != nil {
+		t.Fatalf("Expected the fallback to answer, got %v", err)
+	}
+	if got := kinds(recorder); got != "retry,retry,fallback" {
+		t.Errorf("Expected retries then a fallback, got %q", got)
+	}
+	if len(events) != 3 || !strings.Contains(events[0], "retrying in 1ms (attempt 1)") || !strings.Contains(events[2], "Switching from flaky/pro to script/") {
+		t.Errorf("Expected the retries and the fallback as task events, got %q", events)
+	}
+	if err := fallback.Err(); err != nil {
+		t.Errorf("Fallback did not answer: %v", err)
+	}
+
+	// A context overflow goes to the fallback at once: retrying can't help
+	recorder = &MockRecorder{}
+	flaky = &MockFlakyModel{name: "flaky", errs: []error{overflow}}
+	if _, err := newAgent(flaky, llm.NewScriptedModel(answer), recorder, policy).Execute(context.Background(), "Go"); err != nil {
+		t.Fatalf("Expected the fallback to answer, got %v", err)
+	}
+	if got := kinds(recorder); got != "fallback" || flaky.calls != 1 {
+		t.Errorf("Expected one call and a fallback, got %q after %d calls", got, flaky.calls)
+	}
+
+	// Two failures open the circuit; the next task doesn't call the model at all
+	policy = RetryPolicy{MaxRetries: 5, BaseDelay: time.Millisecond, BreakerThreshold: 2, BreakerCooldown: time.Hour}
+	flaky = &MockFlakyModel{name: "flaky"}
+	recorder = &MockRecorder{}
+	agent := newAgent(flaky, llm.NewScriptedModel(llm.Script{}), recorder, policy)
+	if _, err := agent.Execute(context.Background(), "Go"); err == nil {
+		t.Fatal("Expected the task to fail")
+	}
+	if got := kinds(recorder); got != "retry,circuit_open" || flaky.calls != 2 {
+		t.Errorf("Expected the circuit to open after 2 calls, got %q after %d calls", got, flaky.calls)
+	}
+	if _, err := agent.Execute(context.Background(), "Go again"); !errors.Is(err, ErrCircuitOpen) || flaky.calls != 2 {
+		t.Errorf("Expected ErrCircuitOpen without calling the model, got %v after %d calls", err, flaky.calls)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b := &breaker{}
+	now := time.Now()
+	if ok, probe := b.allow(now); !ok || probe {
+		t.Fatal("Expected a closed circuit to let calls through")
+	}
+	b.failed(now, 2, time.Minute)
+	if !b.failed(now, 2, time.Minute) {
+		t.Fatal("Expected the second failure to open the circuit")
+	}
+	if ok, _ := b.allow(now.Add(time.Second)); ok {
+		t.Fatal("Expected an open circuit to refuse calls")
+	}
+
+	// After the cooldown a single probe goes through
+	later := now.Add(time.Minute)
+	if ok, probe := b.allow(later); !ok || !probe {
+		t.Fatal("Expected a probe once the cooldown is over")
+	}
+	if ok, _ := b.allow(later); ok {
+		t.Fatal("Expected other calls to wait for the probe")
+	}
+
+	// A failed probe opens the circuit again at once
+	if !b.failed(later, 2, time.Minute) {
+		t.Fatal("Expected a failed probe to open the circuit again")
+	}
+	if ok, _ := b.allow(later.Add(time.Second)); ok {
+		t.Fatal("Expected the circuit to be open after a failed probe")
+	}
+
+	// A probe that tells nothing lets the next call try; a successful one closes the circuit
+	later = later.Add(time.Minute)
+	b.allow(later)
+	b.release()
+	if ok, probe := b.allow(later); !ok || !probe {
+		t.Fatal("Expected a new probe after a released one")
+	}
+	b.succeeded()
+	for i := 0; i < 2; i++ {
+		if ok, probe := b.allow(later); !ok || probe {
+			t.Fatal("Expected a closed circuit after a successful probe")
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for _, tc := range []struct {
+		attempt    int
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{0, 0, time.Second},
+		{2, 0, 4 * time.Second},
+		{3, 0, 5 * time.Second},               // Capped
+		{64, 0, 5 * time.Second},              // Capped, not overflowed
+		{0, 3 * time.Second, 3 * time.Second}, // The server knows best
+		{0, time.Minute, 5 * time.Second},     // ...up to a point
+	} {
+		if got := policy.backoff(tc.attempt, tc.retryAfter); got != tc.want {
+			t.Errorf("backoff(%d, %s) = %s, want %s", tc.attempt, tc.retryAfter, got, tc.want)
+		}
+	}
+
+	// Without MaxDelay a long run of retries must not overflow into a zero or negative wait
+	uncapped := RetryPolicy{BaseDelay: time.Second}
+	for _, attempt := range []int{40, 64, 100} {
+		if got := uncapped.backoff(attempt, 0); got < time.Second {
+			t.Errorf("backoff(%d, 0) without MaxDelay = %s, want at least the base delay", attempt, got)
+		}
+	}
+}
+
+// MockSpyModel keeps every request it is sent and hands it to next. Summary requests
+// (see compaction.go) are answered with "SUMMARY" instead, so they don't use up the script.
+type MockSpyModel struct {
+	next      model.LLM
+	requests  [][]*genai.Content
+	summaries int
+}
+
+func (m *MockSpyModel) Name() string { return "spy" }
+
+func (m *MockSpyModel) Check() error { return nil }
+
+func (m *MockSpyModel) NewModel(ctx context.Context, cfg domain.ModelConfig) (model.LLM, error) {
+	return m, nil
+}
+
+func (m *MockSpyModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	if req.Config != nil && req.Config.SystemInstruction != nil && req.Config.SystemInstruction.Parts[0].Text == summaryInstruction {
+		m.summaries++
+		return func(yield func(*model.LLMResponse, error) bool) {
+			yield(&model.LLMResponse{Content: genai.NewContentFromText("SUMMARY", genai.RoleModel)}, nil)
+		}
+	}
+	m.requests = append(m.requests, append([]*genai.Content(nil), req.Contents...))
+	return m.next.GenerateContent(ctx, req, stream)
+}
+
+func TestHistoryIsCompacted(t *testing.T) {
+	snapshotTurn := llm.Turn{Calls: []llm.Call{{Tool: "get_snapshot", Args: map[string]any{}}}}
+	script := llm.Script{Turns: []llm.Turn{snapshotTurn, snapshotTurn, snapshotTurn, snapshotTurn, {Text: "Done."}}}
+	run := func(policy ContextPolicy) (*MockSpyModel, *MockRecorder) {
+		spy := &MockSpyModel{next: llm.NewScriptedModel(script)}
+		recorder := &MockRecorder{}
+		agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "",
+			WithProvider(spy),
+			WithModelConfig(domain.ModelConfig{Provider: "spy"}),
+			WithRecorder(recorder),
+			WithContextPolicy(policy),
+			WithLimits(Limits{}), // The same snapshot over and over would look like a loop
+		)
+		if _, err := agent.Execute(context.Background(), "Look at the page"); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		return spy, recorder
+	}
+	compactions := func(recorder *MockRecorder) []map[string]any {
+		var out []map[string]any
+		for _, rec := range recorder.records {
+			if rec.Kind == "compaction" {
+				out = append(out, rec.Details.(map[string]any))
+			}
+		}
+		return out
+	}
+
+	// Summaries and snapshot eviction: the last request is goal, summary, then the two newest turns
+	spy, recorder := run(ContextPolicy{KeepSnapshots: 1, SummarizeAfter: 4, KeepRecent: 2})
+	last := spy.requests[len(spy.requests)-1]
+	if spy.summaries != 1 || len(last) != 6 || !strings.Contains(last[1].Parts[0].Text, "SUMMARY") {
+		t.Fatalf("Expected goal, summary and 4 messages after 1 summary, got %d messages after %d summaries", len(last), spy.summaries)
+	}
+	older, newest := last[3].Parts[0].FunctionResponse, last[5].Parts[0].FunctionResponse
+	if !strings.HasPrefix(resultText(older.Response), snapshotRemoved) || !strings.Contains(resultText(newest.Response), "Submit") {
+		t.Errorf("Expected only the newest snapshot in full, got %v and %v", older.Response, newest.Response)
+	}
+	// Snapshots are shortened from the third call on; the fourth is also summarized
+	if got := compactions(recorder); len(got) != 3 || got[1]["summarized"] != 4 || got[2]["snapshots_evicted"] != 3 {
+		t.Errorf("Unexpected compaction records %v", got)
+	}
+
+	// The hard limit drops the oldest turns, keeping the newest
+	spy, recorder = run(ContextPolicy{KeepRecent: 2, MaxTokens: 1})
+	last = spy.requests[len(spy.requests)-1]
+	if len(last) != 3 || last[2].Parts[0].FunctionResponse == nil {
+		t.Errorf("Expected the goal and the newest turn, got %d messages", len(last))
+	}
+	if got := compactions(recorder); len(got) == 0 || got[len(got)-1]["dropped"] != 6 {
+		t.Errorf("Expected the last request to drop 6 messages, got %v", got)
+	}
+	// ...after shortening old snapshots, even with summaries switched off
+	evictedAny := false
+	for _, details := range compactions(recorder) {
+		evictedAny = evictedAny || details["snapshots_evicted"] != nil
+	}
+	if !evictedAny {
+		t.Errorf("Expected old snapshots to be shortened over the limit without summaries, got %v", compactions(recorder))
+	}
+
+	// Keeping no recent messages still leaves the newest one for the model to answer
+	spy, _ = run(ContextPolicy{SummarizeAfter: 2, KeepRecent: 0})
+	last = spy.requests[len(spy.requests)-1]
+	if spy.summaries == 0 || len(last) < 3 || last[len(last)-1].Parts[0].FunctionResponse == nil {
+		t.Errorf("Expected a summary and the newest tool result, got %d messages after %d summaries", len(last), spy.summaries)
+	}
+}
+
+func TestSummaryCutAndClip(t *testing.T) {
+	body := []*genai.Content{
+		genai.NewContentFromText("call", genai.RoleModel),
+		genai.NewContentFromText("result", genai.RoleUser),
+		genai.NewContentFromText("call", genai.RoleModel),
+		genai.NewContentFromText("result", genai.RoleUser),
+	}
+	for keep, want := range map[int]int{0: 2, 1: 2, 2: 2, 3: 0, 10: 0} {
+		if got := summaryCut(body, 0, keep); got != want {
+			t.Errorf("summaryCut(keep %d) = %d, want %d", keep, got, want)
+		}
+	}
+
+	// Text is cut between characters, never in the middle of one
+	if got := clip("héllo", 2); got != "h..." {
+		t.Errorf("Expected clip to back up to a character boundary, got %q", got)
+	}
+	if got := clip("日本語", 4); !utf8.ValidString(got) || got != "日..." {
+		t.Errorf("Expected valid UTF-8, got %q", got)
+	}
+}
+
+// MockPlannerModel answers planning requests (see plan.go) with the next of plans and
+// hands everything else to next, keeping the executor's system instructions.
+type MockPlannerModel struct {
+	next         model.LLM
+	plans        []string
+	instructions []string
+}
+
+func (m *MockPlannerModel) Name() string { return "planner" }
+
+func (m *MockPlannerModel) Check() error { return nil }
+
+func (m *MockPlannerModel) NewModel(ctx context.Context, cfg domain.ModelConfig) (model.LLM, error) {
+	return m, nil
+}
+
+func (m *MockPlannerModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	instruction := ""
+	if req.Config != nil && req.Config.SystemInstruction != nil {
+		instruction = req.Config.SystemInstruction.Parts[0].Text
+	}
+	if instruction == plannerInstruction {
+		plan := m.plans[0]
+		m.plans = m.plans[1:]
+		return func(yield func(*model.LLMResponse, error) bool) {
+			yield(&model.LLMResponse{Content: genai.NewContentFromText(plan, genai.RoleModel)}, nil)
+		}
+	}
+	m.instructions = append(m.instructions, instruction)
+	return m.next.GenerateContent(ctx, req, stream)
+}
+
+// MockPlanReviewer approves the plan with its own steps, or rejects it.
+type MockPlanReviewer struct {
+	approve bool
+	steps   []string
+	seen    *domain.Plan
+}
+
+func (m *MockPlanReviewer) ReviewPlan(ctx context.Context, req domain.HumanRequest) (domain.Plan, bool, error) {
+	m.seen = req.Plan
+	plan := domain.Plan{}
+	for _, step := range m.steps {
+		plan.Steps = append(plan.Steps, domain.PlanStep{Description: step})
+	}
+	return plan, m.approve, nil
+}
+
+func TestPlannedTask(t *testing.T) {
+	script := llm.NewScriptedModel(llm.Script{Turns: []llm.Turn{
+		{Calls: []llm.Call{{Tool: "update_plan", Args: map[string]any{"Step": 1, "Status": "done"}, Want: "Step 1 is done."}}},
+		{Calls: []llm.Call{{Tool: "update_plan", Args: map[string]any{"Step": 2, "Status": "failed", "Note": "Out of stock"}, Want: "new plan"}}},
+		{Calls: []llm.Call{{Tool: "update_plan", Args: map[string]any{"Step": 2, "Status": "done"}, Want: "Step 2 is done."}}},
+		{Text: "Bought a similar item."},
+	}})
+	planner := &MockPlannerModel{next: script, plans: []string{
+		"Here is the plan:\n1. Open the shop\n2. Buy the item\n3. Check out",
+		"1. Buy a similar item",
+	}}
+	reviewer := &MockPlanReviewer{approve: true, steps: []string{"Open the shop", " ", "Buy the cheapest item"}}
+	recorder := &MockRecorder{}
+	agent := NewAgent(&MockBrowser{}, &MockVectorStore{}, "",
+		WithProvider(planner),
+		WithModelConfig(domain.ModelConfig{Provider: "planner"}),
+		WithRecorder(recorder),
+		WithPlanning(reviewer),
+	)
+
+	result, err := agent.Execute(context.Background(), "Buy the item")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if err := script.Err(); err != nil {
+		t.Fatalf("Script did not play out: %v", err)
+	}
+	if reviewer.seen == nil || len(reviewer.seen.Steps) != 3 || reviewer.seen.Steps[2].Description != "Check out" {
+		t.Errorf("Expected the reviewer to see the 3-step plan, got %+v", reviewer.seen)
+	}
+	// The executor works from the user's version of the plan
+	if !strings.Contains(planner.instructions[0], "2. [pending] Buy the cheapest item") {
+		t.Errorf("Expected the edited plan in the instruction, got %q", planner.instructions[0])
+	}
+	// The failed step was replanned, keeping the step that was done
+	if result.Plan == nil || result.Plan.Version != 2 || formatPlan(*result.Plan) != "1. [done] Open the shop\n2. [done] Buy a similar item\n" {
+		t.Errorf("Unexpected final plan %+v", result.Plan)
+	}
+	var events []string
+	for _, rec := range recorder.records {
+		if rec.Kind == "plan" {
+			events = append(events, rec.Details.(map[string]any)["event"].(string))
+		}
+	}
+	if strings.Join(events, ",") != "created,edited,done,failed,replanned,done" {
+		t.Errorf("Unexpected plan events %v", events)
+	}
+
+	// A rejected plan cancels the task before any step runs
+	script = llm.NewScriptedModel(llm.Script{})
+	planner = &MockPlannerModel{next: script, plans: []string{"1. Open the shop"}}
+	agent = NewAgent(&MockBrowser{}, &MockVectorStore{}, "",
+		WithProvider(planner),
+		WithModelConfig(domain.ModelConfig{Provider: "planner"}),
+		WithPlanning(&MockPlanReviewer{approve: false}),
+	)
+	result, err = agent.Execute(context.Background(), "Buy the item")
+	if !errors.Is(err, ErrPlanRejected) || result.Outcome != "cancelled" || len(planner.instructions) != 0 {
+		t.Errorf("Expected a cancelled task and no model calls, got %v, %+v", err, result)
+	}
+
+	// Planning can be switched off for one task
+	script = llm.NewScriptedModel(llm.Script{Turns: []llm.Turn{{Text: "Done."}}})
+	agent = NewAgent(&MockBrowser{}, &MockVectorStore{}, "",
+		WithProvider(&MockPlannerModel{next: script}),
+		WithModelConfig(domain.ModelConfig{Provider: "planner"}),
+		WithPlanning(nil),
+	)
+	if result, err := agent.Execute(WithTaskPlanning(context.Background(), false), "Say hi"); err != nil || result.Plan != nil {
+		t.Errorf("Expected an unplanned task, got %v, %+v", err, result)
+	}
+}
+
+func TestParsePlanSteps(t *testing.T) {
+	got := parsePlanSteps("Sure! Here's the plan:\n\n1. Open https://example.com\n2) Search for \"shoes\"\n**3.** Pick the first result\n- a note\n")
+	want := []string{"Open https://example.com", "Search for \"shoes\"", "Pick the first result"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("parsePlanSteps = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/ports"
+	"google.golang.org/adk/tool"
+)
+
+// ApprovalPolicy decides which tool calls need a human's OK before they run.
+// Users don't want Kortex paying for things or sending emails on its own.
+type ApprovalPolicy struct {
+	ClickPatterns       []string // Regexes matched against the name of the element being clicked
+	SensitiveInputTypes []string // Input types that need approval before typing into them
+}
+
+// DefaultApprovalPolicy covers purchases, sending messages, deleting things and passwords.
+var DefaultApprovalPolicy = ApprovalPolicy{
+	ClickPatterns: []string{
+		`(?i)\b(buy|purchase|pay|checkout|place order|submit order|confirm order|book now)\b`,
+		`(?i)^\s*(send|submit|delete|remove account|transfer)\b`,
+	},
+	SensitiveInputTypes: []string{"password"},
+}
+
+// ErrDeclined is returned when the user says no to a sensitive action. The task stops
+// there rather than have the model look for another way to do what the user refused.
+var ErrDeclined = errors.New("declined by the user")
+
+// approvalRules is an ApprovalPolicy with its click patterns compiled, once, when the agent is set up.
+type approvalRules struct {
+	clickPatterns       []*regexp.Regexp
+	sensitiveInputTypes []string
+}
+
+// compile prepares the policy for classify. A pattern that doesn't compile is skipped with a warning.
+func (p ApprovalPolicy) compile() approvalRules {
+	rules := approvalRules{sensitiveInputTypes: p.SensitiveInputTypes}
+	for _, pattern := range p.ClickPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Printf("Ignoring invalid approval pattern %q: %v", pattern, err)
+			continue
+		}
+		rules.clickPatterns = append(rules.clickPatterns, re)
+	}
+	return rules
+}
+
+// classify decides whether a tool call needs approval.
+// It returns a short message for the user ("Click 'Place order'") and the reason it was flagged.
+func (p approvalRules) classify(browser ports.Browser, toolName string, args map[string]any) (needs bool, message, reason string) {
+	selector, _ := args["Selector"].(string)
+
+	switch toolName {
+	case "click":
+		info, err := browser.DescribeElement(selector)
+		if errors.Is(err, domain.ErrDialogOpen) {
+			return false, "", "" // The click can't happen either; the tool will say why
+		}
+		if err != nil {
+			// What we can't look at, we can't call safe: the user decides
+			return true, fmt.Sprintf("Click %s (the element couldn't be checked)", selector), "unknown element"
+		}
+		name := info.Name
+		if name == "" {
+			name = selector
+		}
+		for _, re := range p.clickPatterns {
+			if re.MatchString(name) {
+				return true, fmt.Sprintf("Click %q", name), "sensitive button"
+			}
+		}
+
+	case "type":
+		info, err := browser.DescribeElement(selector)
+		if errors.Is(err, domain.ErrDialogOpen) {
+			return false, "", ""
+		}
+		if err != nil {
+			return true, fmt.Sprintf("Type into %s (the field couldn't be checked)", selector), "unknown element"
+		}
+		for _, t := range p.sensitiveInputTypes {
+			if info.InputType == t {
+				label := info.Name
+				if label == "" {
+					label = selector
+				}
+				return true, fmt.Sprintf("Type into %s field %q", t, label), t + " field"
+			}
+		}
+	}
+	return false, "", ""
+}
+
+// checkApproval runs before every tool call. If the call is sensitive it pauses the run,
+// asks the user, and either lets the tool run or stops the task (like a limit does, see limits.go).
+func (a *AgentAdapter) checkApproval(ctx tool.Context, t tool.Tool, args map[string]any) (map[string]any, error) {
+	if a.approver == nil {
+		return nil, nil
+	}
+
+	needs, message, reason := a.approvalPolicy.classify(a.browser, t.Name(), args)
+	if !needs {
+		return nil, nil
+	}
+
+	// Never show what is about to be typed into a password field, not even to the approver UI.
+	shown := map[string]any{}
+	for k, v := range args {
+		shown[k] = v
+	}
+	if _, ok := shown["Text"]; ok && t.Name() == "type" {
+		shown["Text"] = "********"
+	}
+
+	var runCtx context.Context = context.Background()
+	if ctx != nil {
+		runCtx = ctx
+	}
+
+	start := time.Now()
+	approved, err := a.approver.RequestApproval(runCtx, domain.HumanRequest{
+		Tool:    t.Name(),
+		Args:    shown,
+		Message: message,
+		Reason:  reason,
+	})
+	decision := map[string]any{
+		"tool":     t.Name(),
+		"args":     shown,
+		"message":  message,
+		"reason":   reason,
+		"approved": approved,
+		"waited":   time.Since(start).String(),
+	}
+	if err != nil {
+		decision["error"] = err.Error()
+	}
+	a.record(runCtx, domain.FlightRecord{Kind: "approval", Tool: t.Name(), Details: decision})
+
+	if err != nil {
+		a.halt(runCtx, fmt.Errorf("approval for %q failed: %w", message, err))
+		return map[string]any{"error": "Could not get the user's approval for this action. Stop and tell the user."}, nil
+	}
+	if !approved {
+		a.halt(runCtx, fmt.Errorf("%w: %s", ErrDeclined, message))
+		return map[string]any{"error": "The user declined this action. Stop and tell the user you didn't do it."}, nil
+	}
+	return nil, nil
+}
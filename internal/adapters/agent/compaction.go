@@ -0,0 +1,333 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// --- Context Window Management ---
+// Every tool call and result stays in the ADK session, and page snapshots are big.
+// A long task would eventually send the model more than it can read. Before each
+// model call the request (never the session itself) is trimmed:
+//  1. Old get_snapshot results are replaced by a one-line summary.
+//  2. Older messages are replaced by a running summary, written by the model itself.
+//  3. If the request is still bigger than MaxTokens, the oldest messages are dropped.
+
+// ContextPolicy says how much history the model gets to see. Zero values switch a step off.
+type ContextPolicy struct {
+	KeepSnapshots  int // Newest get_snapshot results kept in full; older ones are summarized in a line
+	SummarizeAfter int // Summarize once this many messages have piled up since the last summary
+	KeepRecent     int // The newest messages, which are never summarized or dropped
+	MaxTokens      int // Estimated size limit of a model request
+}
+
+// DefaultContextPolicy keeps a long task well inside Gemini's context window.
+var DefaultContextPolicy = ContextPolicy{
+	KeepSnapshots:  2,
+	SummarizeAfter: 40,
+	KeepRecent:     10,
+	MaxTokens:      200_000,
+}
+
+// WithContextPolicy replaces DefaultContextPolicy.
+func WithContextPolicy(policy ContextPolicy) Option {
+	return func(a *AgentAdapter) { a.contextPolicy = policy }
+}
+
+// summaryInstruction asks the model for the running summary.
+const summaryInstruction = "You are summarizing the earlier steps of a web browsing agent's task, so it can continue without the full history. " +
+	"Write a short summary: what the agent tried, what worked, what failed, which pages it is on, and any facts it found that it will need later. " +
+	"Keep URLs, selectors and numbers exactly. Do not add anything that isn't in the steps."
+
+// compactHistory returns a BeforeModel callback that trims the request. llm writes the summaries.
+func (a *AgentAdapter) compactHistory(llm model.LLM) llmagent.BeforeModelCallback {
+	return func(ctx agent.CallbackContext, req *model.LLMRequest) (*model.LLMResponse, error) {
+		run := taskRunFrom(ctx)
+		if run == nil || len(req.Contents) < 2 {
+			return nil, nil
+		}
+		p := a.contextPolicy
+		before := estimateTokens(req)
+		details := map[string]any{}
+		overLimit := func() bool { return p.MaxTokens > 0 && estimateTokens(req) > p.MaxTokens }
+
+		// The goal is the first message, and is always kept
+		goal, body := req.Contents[0], req.Contents[1:]
+
+		// 1. Old snapshots
+		evicted := evictSnapshots(body, p.KeepSnapshots)
+		req.Contents, _ = withSummary(goal, run, body)
+
+		// 2. The running summary, brought up to date when enough has piled up or the request is too big
+		var usage *domain.TokenUsage
+		var summaryErr error
+		run.mu.Lock()
+		summarized := run.summarized
+		run.mu.Unlock()
+		over := overLimit()
+		if over {
+			evicted = evictSnapshots(body, 1) // Too big: keep only the newest snapshot, summarizing or not
+		}
+		if p.SummarizeAfter > 0 && (over || len(body)-summarized > p.SummarizeAfter) {
+			if cut := summaryCut(body, summarized, p.KeepRecent); cut > summarized {
+				usage, summaryErr = a.updateSummary(ctx, llm, run, body[summarized:cut], cut)
+				if summaryErr == nil {
+					details["summarized"] = cut - summarized
+				}
+			}
+		}
+		var prefix int
+		req.Contents, prefix = withSummary(goal, run, body)
+
+		// 3. The hard limit: drop the oldest turns until the request fits
+		dropped := 0
+		rest := req.Contents[prefix:]
+		for overLimit() {
+			next := 1
+			for next < len(rest) && rest[next].Role != genai.RoleModel {
+				next++
+			}
+			if next >= len(rest) || len(rest)-next < p.KeepRecent {
+				break // Only the newest messages are left; nothing more can go
+			}
+			dropped += next
+			rest = rest[next:]
+			req.Contents = append(req.Contents[:prefix:prefix], rest...)
+		}
+
+		// Record what changed. Snapshots are evicted again on every call, so only new evictions count.
+		run.mu.Lock()
+		if evicted > run.evictedSnapshots {
+			details["snapshots_evicted"] = evicted
+		}
+		run.evictedSnapshots = evicted
+		run.mu.Unlock()
+		if dropped > 0 {
+			details["dropped"] = dropped
+		}
+		if len(details) == 0 && summaryErr == nil {
+			return nil, nil
+		}
+		details["tokens_before"] = before
+		details["tokens_after"] = estimateTokens(req)
+		rec := domain.FlightRecord{Kind: "compaction", Usage: usage, Details: details}
+		if summaryErr != nil {
+			rec.Error = summaryErr.Error() // The task carries on with the old summary
+		}
+		a.record(ctx, rec)
+		return nil, nil
+	}
+}
+
+// withSummary puts the goal, the running summary (if any) and the messages after it
+// together. prefix is how many of the returned messages are the goal and summary.
+func withSummary(goal *genai.Content, run *taskRun, body []*genai.Content) (contents []*genai.Content, prefix int) {
+	run.mu.Lock()
+	summary, summarized := run.summary, run.summarized
+	run.mu.Unlock()
+	contents = []*genai.Content{goal}
+	if summary == "" || summarized > len(body) {
+		return append(contents, body...), 1
+	}
+	contents = append(contents, genai.NewContentFromText("Summary of the earlier steps of this task:\n"+summary, genai.RoleUser))
+	return append(contents, body[summarized:]...), 2
+}
+
+// summaryCut is where a summary of body[from:] should end: before the newest keep
+// messages, and just before a model turn, so no tool result is cut off from its call.
+// The newest message is never summarized, even with keep 0: the model needs to see it.
+func summaryCut(body []*genai.Content, from, keep int) int {
+	cut := max(len(body)-max(keep, 1), from)
+	for cut > from && body[cut].Role != genai.RoleModel {
+		cut--
+	}
+	return cut
+}
+
+// updateSummary has the model fold contents into the running summary, which then
+// covers the first cut messages. It returns the tokens the summary took.
+func (a *AgentAdapter) updateSummary(ctx context.Context, llm model.LLM, run *taskRun, contents []*genai.Content, cut int) (*domain.TokenUsage, error) {
+	run.mu.Lock()
+	previous := run.summary
+	run.mu.Unlock()
+
+	var prompt strings.Builder
+	if previous != "" {
+		prompt.WriteString("Summary so far:\n" + previous + "\n\n")
+	}
+	prompt.WriteString("Steps to add:\n" + transcript(contents))
+
+	req := &model.LLMRequest{
+		Config:   &genai.GenerateContentConfig{SystemInstruction: genai.NewContentFromText(summaryInstruction, genai.RoleUser)},
+		Contents: []*genai.Content{genai.NewContentFromText(prompt.String(), genai.RoleUser)},
+	}
+	var summary strings.Builder
+	var usage *domain.TokenUsage
+	for resp, err := range llm.GenerateContent(ctx, req, false) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize history: %w", err)
+		}
+		if u := tokenUsage(resp); u != nil {
+			usage = u
+			a.addUsage(ctx, u, servedBy(resp))
+		}
+		if resp.Content != nil {
+			for _, part := range resp.Content.Parts {
+				summary.WriteString(part.Text)
+			}
+		}
+	}
+	if strings.TrimSpace(summary.String()) == "" {
+		return usage, fmt.Errorf("failed to summarize history: the model returned no text")
+	}
+
+	run.mu.Lock()
+	run.summary = strings.TrimSpace(summary.String())
+	run.summarized = cut
+	run.mu.Unlock()
+	return usage, nil
+}
+
+// transcript writes messages out as plain text for the summarizer. Long results are clipped.
+func transcript(contents []*genai.Content) string {
+	var b strings.Builder
+	for _, content := range contents {
+		if content == nil {
+			continue
+		}
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				args, _ := json.Marshal(part.FunctionCall.Args)
+				fmt.Fprintf(&b, "- Called %s %s\n", part.FunctionCall.Name, args)
+			case part.FunctionResponse != nil:
+				fmt.Fprintf(&b, "- %s returned: %s\n", part.FunctionResponse.Name, clip(resultText(part.FunctionResponse.Response), 500))
+			case part.Text != "":
+				fmt.Fprintf(&b, "- %s said: %s\n", content.Role, clip(part.Text, 1000))
+			}
+		}
+	}
+	return b.String()
+}
+
+// evictSnapshots replaces all but the newest keep get_snapshot results with a short
+// summary, and returns how many it replaced. Replaced messages are copies: the
+// session still has the full snapshots.
+func evictSnapshots(contents []*genai.Content, keep int) int {
+	if keep <= 0 {
+		return 0
+	}
+	type ref struct{ content, part int }
+	var snapshots []ref
+	for i, content := range contents {
+		if content == nil {
+			continue
+		}
+		for j, part := range content.Parts {
+			if part != nil && part.FunctionResponse != nil && part.FunctionResponse.Name == "get_snapshot" {
+				snapshots = append(snapshots, ref{i, j})
+			}
+		}
+	}
+	if len(snapshots) <= keep {
+		return 0
+	}
+
+	old := snapshots[:len(snapshots)-keep]
+	for _, r := range old {
+		if strings.HasPrefix(resultText(contents[r.content].Parts[r.part].FunctionResponse.Response), snapshotRemoved) {
+			continue // Already summarized
+		}
+		content := *contents[r.content]
+		content.Parts = append([]*genai.Part(nil), content.Parts...)
+		resp := *content.Parts[r.part].FunctionResponse
+		resp.Response = map[string]any{"result": snapshotSummary(resultText(resp.Response))}
+		content.Parts[r.part] = &genai.Part{FunctionResponse: &resp}
+		contents[r.content] = &content
+	}
+	return len(old)
+}
+
+// snapshotRemoved starts the line that replaces an old snapshot.
+const snapshotRemoved = "[Old page snapshot removed to save space"
+
+// snapshotSummary describes a page snapshot in a line: how big it was and its main headings.
+func snapshotSummary(snapshot string) string {
+	var headings []string
+	var walk func(node any)
+	walk = func(node any) {
+		n, ok := node.(map[string]any)
+		if !ok || len(headings) >= 3 {
+			return
+		}
+		if role, _ := n["role"].(string); role == "h1" || role == "h2" || role == "heading" {
+			if name, _ := n["name"].(string); name != "" {
+				headings = append(headings, name)
+			}
+		}
+		children, _ := n["children"].([]any)
+		for _, child := range children {
+			walk(child)
+		}
+	}
+	var tree any
+	if json.Unmarshal([]byte(snapshot), &tree) == nil {
+		walk(tree)
+	}
+
+	summary := fmt.Sprintf("%s (%d characters", snapshotRemoved, len(snapshot))
+	if len(headings) > 0 {
+		summary += "; headings: " + strings.Join(headings, " | ")
+	}
+	return summary + "). Call get_snapshot again to see the page as it is now.]"
+}
+
+// resultText is a tool result as text. Tool errors arrive as error values.
+func resultText(response map[string]any) string {
+	if s, ok := response["result"].(string); ok {
+		return s
+	}
+	if err, ok := response["error"].(error); ok {
+		return "error: " + err.Error()
+	}
+	data, _ := json.Marshal(response)
+	return string(data)
+}
+
+func clip(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// Don't cut a character in half: back up to the start of the one at n
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
+
+// estimateTokens guesses the size of a request at four characters per token, which
+// is close enough for English text and JSON to stay under a limit.
+func estimateTokens(req *model.LLMRequest) int {
+	size := 0
+	if data, err := json.Marshal(req.Contents); err == nil {
+		size += len(data)
+	}
+	if req.Config != nil {
+		if data, err := json.Marshal(req.Config.SystemInstruction); err == nil {
+			size += len(data)
+		}
+		if data, err := json.Marshal(req.Config.Tools); err == nil {
+			size += len(data)
+		}
+	}
+	return size / 4
+}
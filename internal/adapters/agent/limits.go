@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/tool"
+	"google.golang.org/genai"
+)
+
+// --- Limits ---
+// A confused agent can click the same button forever. Limits put a ceiling on how
+// many tool calls a task may make and how long it may run, and watch for the agent
+// going round in circles.
+
+// Loop actions: what happens when the agent repeats itself.
+const (
+	LoopHint = "hint" // Skip the repeated call and tell the agent it is stuck; stop if it carries on anyway
+	LoopStop = "stop" // Stop the task straight away
+)
+
+// Limits caps a task. Zero values switch a limit off.
+type Limits struct {
+	MaxToolCalls int           // Tool calls per task
+	Timeout      time.Duration // Wall-clock time per task
+	RepeatLimit  int           // The same call (tool + args), or the same snapshot, this many times in a row means "stuck"
+	OnLoop       string        // LoopHint (default) or LoopStop
+}
+
+// DefaultLimits are generous enough for real tasks but stop a runaway one.
+var DefaultLimits = Limits{
+	MaxToolCalls: 100,
+	Timeout:      15 * time.Minute,
+	RepeatLimit:  3,
+	OnLoop:       LoopHint,
+}
+
+// Reasons a LimitError can carry. They double as task outcomes.
+const (
+	ReasonMaxToolCalls = "max_tool_calls"
+	ReasonTimeout      = "timeout"
+	ReasonStuck        = "stuck"
+)
+
+// ErrLimitReached matches every LimitError with errors.Is.
+var ErrLimitReached = errors.New("task limit reached")
+
+// LimitError says which limit stopped a task, so callers can tell a timeout from a loop.
+type LimitError struct {
+	Reason string // One of the Reason* constants
+	Detail string // What happened, in words
+}
+
+func (e *LimitError) Error() string { return "task stopped (" + e.Reason + "): " + e.Detail }
+
+func (e *LimitError) Is(target error) bool { return target == ErrLimitReached }
+
+// stuckHint is what the agent sees instead of the result of a repeated call.
+const stuckHint = "You are stuck: %s. Doing the same thing again will not help. " +
+	"Take a fresh snapshot, try a different element or approach, or explain to the user why you cannot continue."
+
+// withTimeout applies the task's wall-clock limit. When it runs out, the context's
+// cause is a LimitError, which Execute reports instead of a bare "context deadline exceeded".
+func (a *AgentAdapter) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.limits.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, a.limits.Timeout, &LimitError{
+		Reason: ReasonTimeout,
+		Detail: fmt.Sprintf("ran longer than %s", a.limits.Timeout),
+	})
+}
+
+// checkLimits runs before every tool call (after startToolStep has numbered it).
+// Returning a result skips the tool; the agent sees the result as the tool's answer.
+func (a *AgentAdapter) checkLimits(ctx tool.Context, t tool.Tool, args map[string]any) (map[string]any, error) {
+	if ctx == nil {
+		return nil, nil
+	}
+	run := taskRunFrom(ctx)
+	if run == nil {
+		return nil, nil
+	}
+
+	argsJSON, _ := json.Marshal(args) // Map keys are sorted, so equal args give equal JSON
+	call := t.Name() + " " + string(argsJSON)
+
+	run.mu.Lock()
+	step := run.step
+	if call == run.lastCall {
+		run.repeats++
+	} else {
+		run.lastCall, run.repeats = call, 1
+	}
+	repeats := run.repeats
+	run.mu.Unlock()
+
+	if max := a.limits.MaxToolCalls; max > 0 && step > max {
+		err := &LimitError{Reason: ReasonMaxToolCalls, Detail: fmt.Sprintf("made more than %d tool calls", max)}
+		a.stop(ctx, err)
+		return map[string]any{"error": "Tool call limit reached. Stop and tell the user how far you got."}, nil
+	}
+	if limit := a.limits.RepeatLimit; limit > 0 && repeats >= limit {
+		return a.stuck(ctx, fmt.Sprintf("called %s with the same arguments %d times in a row", t.Name(), repeats)), nil
+	}
+	return nil, nil
+}
+
+// checkSnapshots runs after every tool call. If get_snapshot keeps returning the
+// same page, nothing the agent does is having an effect.
+func (a *AgentAdapter) checkSnapshots(ctx tool.Context, t tool.Tool, args, result map[string]any, err error) (map[string]any, error) {
+	if ctx == nil || err != nil || t.Name() != "get_snapshot" || a.limits.RepeatLimit <= 0 {
+		return nil, nil
+	}
+	run := taskRunFrom(ctx)
+	if run == nil {
+		return nil, nil
+	}
+	data, _ := json.Marshal(result)
+	sum := sha256.Sum256(data)
+
+	run.mu.Lock()
+	if sum == run.lastSnapshot {
+		run.sameSnapshots++
+	} else {
+		run.lastSnapshot, run.sameSnapshots = sum, 1
+	}
+	same := run.sameSnapshots
+	run.mu.Unlock()
+
+	if same < a.limits.RepeatLimit {
+		return nil, nil
+	}
+	// Keep the snapshot, so the agent still sees the page, but add the warning next to it
+	out := a.stuck(ctx, fmt.Sprintf("the page has not changed in %d snapshots", same))
+	for k, v := range result {
+		out[k] = v
+	}
+	return out, nil
+}
+
+// stuck decides between a hint and stopping. The agent gets one hint per task;
+// if it gets stuck again (or OnLoop is LoopStop) the task is stopped.
+func (a *AgentAdapter) stuck(ctx context.Context, what string) map[string]any {
+	run := taskRunFrom(ctx)
+	run.mu.Lock()
+	hinted := run.hinted
+	run.hinted = true
+	run.repeats, run.sameSnapshots = 0, 0 // Count afresh after a hint
+	run.mu.Unlock()
+
+	if hinted || a.limits.OnLoop == LoopStop {
+		a.stop(ctx, &LimitError{Reason: ReasonStuck, Detail: what})
+		return map[string]any{"error": "Stopping: " + what + "."}
+	}
+	a.record(ctx, domain.FlightRecord{Kind: "limit", Details: map[string]any{"reason": ReasonStuck, "action": LoopHint, "detail": what}})
+	return map[string]any{"error": fmt.Sprintf(stuckHint, what)}
+}
+
+// stop marks the task as stopped. The next model call is answered by haltIfStopped,
+// so the loop ends cleanly and Execute returns err.
+func (a *AgentAdapter) stop(ctx context.Context, err error) {
+	if a.halt(ctx, err) {
+		a.record(ctx, domain.FlightRecord{Kind: "limit", Details: map[string]any{
+			"reason": taskOutcome(context.Background(), err),
+			"action": LoopStop,
+			"detail": err.Error(),
+		}})
+	}
+}
+
+// halt sets the error the task ends with, unless something stopped it already.
+// It reports whether this was the first stop.
+func (a *AgentAdapter) halt(ctx context.Context, err error) bool {
+	run := taskRunFrom(ctx)
+	if run == nil {
+		return false
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if run.stopErr != nil {
+		return false
+	}
+	run.stopErr = err
+	return true
+}
+
+// haltIfStopped runs before each model call. Once a budget or limit has stopped the
+// task it answers in the model's place with a final message, which ends the ReAct
+// loop cleanly instead of killing it mid-step.
+func (a *AgentAdapter) haltIfStopped(ctx agent.CallbackContext, req *model.LLMRequest) (*model.LLMResponse, error) {
+	run := taskRunFrom(ctx)
+	if run == nil {
+		return nil, nil
+	}
+	run.mu.Lock()
+	err := run.stopErr
+	run.mu.Unlock()
+	if err == nil {
+		return nil, nil
+	}
+	return &model.LLMResponse{
+		Content: genai.NewContentFromText("Stopping here: "+err.Error()+".", genai.RoleModel),
+	}, nil
+}
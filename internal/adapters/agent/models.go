@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/ports"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/llm"
+	"google.golang.org/adk/model"
+)
+
+// --- Model Selection ---
+// The Brain can think with different models. Providers (ports.AIProvider) turn a
+// domain.ModelConfig into an ADK model; the agent has a default config, and each
+// task may override parts of it.
+
+// WithProvider makes a provider available under its Name(). Gemini is always
+// available, using the API key given to NewAgent; registering another "gemini" replaces it.
+func WithProvider(p ports.AIProvider) Option {
+	return func(a *AgentAdapter) { a.providers[p.Name()] = p }
+}
+
+// WithModelConfig sets the default model. Empty fields keep the current default.
+func WithModelConfig(cfg domain.ModelConfig) Option {
+	return func(a *AgentAdapter) { a.model = mergeModelConfig(a.model, cfg) }
+}
+
+// WithModelCache records or replays every model response through cache (see llm.Cache),
+// so prompt changes can be tried without paying for the same answers again.
+func WithModelCache(cache *llm.Cache) Option {
+	return func(a *AgentAdapter) { a.cache = cache }
+}
+
+type taskModelKey struct{}
+
+// WithTaskModel picks the model for the task run with ctx, e.g. a cheaper one for a
+// simple goal or a local one while testing. Empty fields fall back to the agent's default.
+func WithTaskModel(ctx context.Context, cfg domain.ModelConfig) context.Context {
+	return context.WithValue(ctx, taskModelKey{}, cfg)
+}
+
+// modelConfig is the default config with the task's overrides applied.
+func (a *AgentAdapter) modelConfig(ctx context.Context) domain.ModelConfig {
+	if task, ok := ctx.Value(taskModelKey{}).(domain.ModelConfig); ok {
+		return overrideModelConfig(a.model, task)
+	}
+	return a.model
+}
+
+// overrideModelConfig applies override to base, like mergeModelConfig, except that a
+// different provider doesn't inherit base's model name: it wouldn't know it.
+func overrideModelConfig(base, override domain.ModelConfig) domain.ModelConfig {
+	if override.Provider != "" && override.Provider != base.Provider {
+		base.Model = ""
+	}
+	return mergeModelConfig(base, override)
+}
+
+func mergeModelConfig(base, override domain.ModelConfig) domain.ModelConfig {
+	if override.Provider != "" {
+		base.Provider = override.Provider
+	}
+	if override.Model != "" {
+		base.Model = override.Model
+	}
+	if override.Temperature != nil {
+		base.Temperature = override.Temperature
+	}
+	if override.MaxTokens != 0 {
+		base.MaxTokens = override.MaxTokens
+	}
+	return base
+}
+
+// newModel asks the configured provider for a model.
+func (a *AgentAdapter) newModel(ctx context.Context, cfg domain.ModelConfig) (model.LLM, error) {
+	provider, ok := a.providers[cfg.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown model provider %q", cfg.Provider)
+	}
+	if a.cache != nil {
+		return a.cache.NewModel(ctx, provider, cfg)
+	}
+	return provider.NewModel(ctx, cfg)
+}
@@ -0,0 +1,304 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/ports"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// --- Planning ---
+// In planner–executor mode the Brain first writes a numbered plan for the goal and,
+// if a reviewer is set, lets the user check and edit it. Only then does the executor
+// (the usual ReAct loop) start on the steps, ticking them off with the update_plan
+// tool. A failed step gets a new plan for the rest of the goal.
+
+// Plan step statuses.
+const (
+	StepPending    = "pending"
+	StepInProgress = "in_progress"
+	StepDone       = "done"
+	StepFailed     = "failed"
+	StepSkipped    = "skipped"
+)
+
+// MaxReplans is how many new plans a task may make after failed steps.
+// After that a failed step is just marked failed, and the executor carries on as best it can.
+const MaxReplans = 2
+
+// ErrPlanRejected is returned when the user turns down the plan. No step has run.
+var ErrPlanRejected = errors.New("plan rejected by the user")
+
+// WithPlanning turns on planner–executor mode for every task. reviewer, if not nil,
+// is shown each task's plan before it starts (e.g. the hitl.Broker).
+func WithPlanning(reviewer ports.PlanReviewer) Option {
+	return func(a *AgentAdapter) {
+		a.planning = true
+		a.planReviewer = reviewer
+	}
+}
+
+type taskPlanningKey struct{}
+
+// WithTaskPlanning turns planning on or off for the task run with ctx, whatever the agent's default.
+func WithTaskPlanning(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, taskPlanningKey{}, enabled)
+}
+
+func (a *AgentAdapter) planningEnabled(ctx context.Context) bool {
+	if enabled, ok := ctx.Value(taskPlanningKey{}).(bool); ok {
+		return enabled
+	}
+	return a.planning
+}
+
+// plannerInstruction asks the model for a plan, and nothing else.
+const plannerInstruction = "You plan tasks for Kortex, an agent that controls a web browser: it can navigate to URLs, " +
+	"read pages, click, type, handle dialogs and ask the user questions. " +
+	"Break the user's goal into short, concrete steps, at most 10. " +
+	"Reply with a numbered list only, one step per line, like \"1. Open https://example.com\"."
+
+// makePlan asks the model for the first plan for goal.
+func (a *AgentAdapter) makePlan(ctx context.Context, llm model.LLM, goal string) (domain.Plan, error) {
+	steps, err := a.planSteps(ctx, llm, "Goal: "+goal)
+	if err != nil {
+		return domain.Plan{}, err
+	}
+	return newPlan(goal, 1, nil, steps), nil
+}
+
+// replan asks the model for new steps after failed. Steps that are done are kept.
+func (a *AgentAdapter) replan(ctx context.Context, llm model.LLM, plan domain.Plan, failed domain.PlanStep) (domain.Plan, error) {
+	prompt := fmt.Sprintf("Goal: %s\n\nThe plan so far:\n%s\nStep %d failed: %s\n\n"+
+		"Write new steps for the rest of the goal, starting from where the agent is now. Don't repeat steps that are done.",
+		plan.Goal, formatPlan(plan), failed.Number, failed.Note)
+	steps, err := a.planSteps(ctx, llm, prompt)
+	if err != nil {
+		return plan, err
+	}
+	var done []domain.PlanStep
+	for _, step := range plan.Steps {
+		if step.Status == StepDone {
+			done = append(done, step)
+		}
+	}
+	return newPlan(plan.Goal, plan.Version+1, done, steps), nil
+}
+
+// planSteps has the model write a numbered list and reads the steps from it.
+func (a *AgentAdapter) planSteps(ctx context.Context, llm model.LLM, prompt string) ([]string, error) {
+	req := &model.LLMRequest{
+		Config:   &genai.GenerateContentConfig{SystemInstruction: genai.NewContentFromText(plannerInstruction, genai.RoleUser)},
+		Contents: []*genai.Content{genai.NewContentFromText(prompt, genai.RoleUser)},
+	}
+	var text strings.Builder
+	var usage *domain.TokenUsage
+	for resp, err := range llm.GenerateContent(ctx, req, false) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan: %w", err)
+		}
+		if u := tokenUsage(resp); u != nil {
+			usage = u
+			a.addUsage(ctx, u, servedBy(resp))
+		}
+		if resp.Content != nil {
+			for _, part := range resp.Content.Parts {
+				text.WriteString(part.Text)
+			}
+		}
+	}
+	steps := parsePlanSteps(text.String())
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("failed to plan: the model wrote no numbered steps")
+	}
+	if usage != nil {
+		a.record(ctx, domain.FlightRecord{Kind: "model", Usage: usage, Details: map[string]any{"purpose": "plan"}})
+	}
+	return steps, nil
+}
+
+var planLine = regexp.MustCompile(`^\s*(?:\*\*)?\d+[.)]\s*(?:\*\*)?\s*(.+)$`)
+
+// parsePlanSteps reads "1. Do this" lines. Anything else the model wrote is ignored.
+func parsePlanSteps(text string) []string {
+	var steps []string
+	for _, line := range strings.Split(text, "\n") {
+		if m := planLine.FindStringSubmatch(line); m != nil {
+			if step := strings.TrimSpace(strings.Trim(m[1], "*")); step != "" {
+				steps = append(steps, step)
+			}
+		}
+	}
+	return steps
+}
+
+// newPlan numbers done (kept as they are) and then steps (pending).
+func newPlan(goal string, version int, done []domain.PlanStep, steps []string) domain.Plan {
+	plan := domain.Plan{Goal: goal, Version: version}
+	for _, step := range done {
+		step.Number = len(plan.Steps) + 1
+		plan.Steps = append(plan.Steps, step)
+	}
+	for _, description := range steps {
+		plan.Steps = append(plan.Steps, domain.PlanStep{Number: len(plan.Steps) + 1, Description: description, Status: StepPending})
+	}
+	return plan
+}
+
+// tidyPlan cleans up a plan the user edited: empty steps are dropped and the rest renumbered.
+func tidyPlan(plan domain.Plan) domain.Plan {
+	var steps []string
+	for _, step := range plan.Steps {
+		if description := strings.TrimSpace(step.Description); description != "" {
+			steps = append(steps, description)
+		}
+	}
+	return newPlan(plan.Goal, plan.Version, nil, steps)
+}
+
+// formatPlan writes the plan as a numbered list with each step's status.
+func formatPlan(plan domain.Plan) string {
+	var b strings.Builder
+	for _, step := range plan.Steps {
+		fmt.Fprintf(&b, "%d. [%s] %s", step.Number, step.Status, step.Description)
+		if step.Note != "" {
+			fmt.Fprintf(&b, " (%s)", step.Note)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// startPlan writes the task's plan, has the user review it, and keeps it in the task run.
+// It returns ErrPlanRejected if the user said no.
+func (a *AgentAdapter) startPlan(ctx context.Context, llm model.LLM, goal string) error {
+	plan, err := a.makePlan(ctx, llm, goal)
+	if err != nil {
+		return err
+	}
+	a.recordPlan(ctx, "created", plan)
+
+	if a.planReviewer != nil {
+		// The reviewer gets its own copy: the task's plan changes as steps are done
+		review := plan
+		review.Steps = append([]domain.PlanStep(nil), plan.Steps...)
+		reviewed, approved, err := a.planReviewer.ReviewPlan(ctx, domain.HumanRequest{
+			Tool:    "plan",
+			Message: "Review the plan for: " + goal,
+			Plan:    &review,
+		})
+		if err != nil {
+			return fmt.Errorf("could not get the plan reviewed: %w", err)
+		}
+		if !approved {
+			a.recordPlan(ctx, "rejected", plan)
+			return ErrPlanRejected
+		}
+		reviewed.Goal, reviewed.Version = plan.Goal, plan.Version
+		if reviewed = tidyPlan(reviewed); formatPlan(reviewed) != formatPlan(plan) {
+			if len(reviewed.Steps) == 0 {
+				return fmt.Errorf("%w: the edited plan has no steps", ErrPlanRejected)
+			}
+			plan = reviewed
+			a.recordPlan(ctx, "edited", plan)
+		} else {
+			a.recordPlan(ctx, "approved", plan)
+		}
+	}
+
+	run := taskRunFrom(ctx)
+	run.mu.Lock()
+	run.plan = &plan
+	run.mu.Unlock()
+	return nil
+}
+
+// recordPlan writes the plan to the flight recorder. event says what just happened to it.
+func (a *AgentAdapter) recordPlan(ctx context.Context, event string, plan domain.Plan) {
+	a.record(ctx, domain.FlightRecord{Kind: "plan", Details: map[string]any{"event": event, "plan": plan}})
+}
+
+// planInstruction adds the current plan to the executor's instruction, so the model
+// always sees it, with each step's status, however long the task has been running.
+func (a *AgentAdapter) planInstruction(instruction string) llmagent.InstructionProvider {
+	return func(ctx agent.ReadonlyContext) (string, error) {
+		run := taskRunFrom(ctx)
+		if run == nil {
+			return instruction, nil
+		}
+		run.mu.Lock()
+		defer run.mu.Unlock()
+		if run.plan == nil {
+			return instruction, nil
+		}
+		return instruction + "\n\nWork through this plan in order. Before starting a step call update_plan with status " +
+			"in_progress, and when it is finished call it with done, failed (say why in the note) or skipped.\n" +
+			formatPlan(*run.plan), nil
+	}
+}
+
+// UpdatePlanTool lets the executor report progress on the plan. A failed step makes
+// a new plan for the rest of the goal, up to MaxReplans times.
+type UpdatePlanTool struct {
+	Agent *AgentAdapter
+	Model model.LLM // Writes the new plans
+}
+
+func (t *UpdatePlanTool) Name() string { return "update_plan" }
+func (t *UpdatePlanTool) Description() string {
+	return "Updates the status of a plan step: in_progress, done, failed or skipped, with a short note. " +
+		"When a step fails you get a revised plan."
+}
+func (t *UpdatePlanTool) IsLongRunning() bool { return false }
+func (t *UpdatePlanTool) Run(ctx context.Context, args struct {
+	Step   int
+	Status string
+	Note   string `json:"Note,omitempty"` // Optional, except to say why a step failed
+}) (string, error) {
+	switch args.Status {
+	case StepInProgress, StepDone, StepFailed, StepSkipped:
+	default:
+		return "", fmt.Errorf("unknown status %q: use in_progress, done, failed or skipped", args.Status)
+	}
+	run := taskRunFrom(ctx)
+	if run == nil {
+		return "", fmt.Errorf("there is no plan for this task")
+	}
+
+	run.mu.Lock()
+	if run.plan == nil || args.Step < 1 || args.Step > len(run.plan.Steps) {
+		run.mu.Unlock()
+		return "", fmt.Errorf("there is no step %d in the plan", args.Step)
+	}
+	step := &run.plan.Steps[args.Step-1]
+	step.Status, step.Note = args.Status, args.Note
+	failed, plan := *step, *run.plan
+	plan.Steps = append([]domain.PlanStep(nil), run.plan.Steps...)
+	replan := args.Status == StepFailed && run.replans < MaxReplans
+	if replan {
+		run.replans++
+	}
+	run.mu.Unlock()
+	t.Agent.recordPlan(ctx, args.Status, plan)
+
+	if !replan {
+		return fmt.Sprintf("Step %d is %s.", args.Step, args.Status), nil
+	}
+	revised, err := t.Agent.replan(ctx, t.Model, plan, failed)
+	if err != nil {
+		return fmt.Sprintf("Step %d is failed, and no new plan could be made (%v). Carry on as best you can.", args.Step, err), nil
+	}
+	run.mu.Lock()
+	run.plan = &revised
+	run.mu.Unlock()
+	t.Agent.recordPlan(ctx, "replanned", revised)
+	return fmt.Sprintf("Step %d is failed. Here is the new plan; carry on with its first pending step:\n%s", args.Step, formatPlan(revised)), nil
+}
@@ -0,0 +1,302 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/tool"
+)
+
+// --- Flight Recorder ---
+// Every step of a task is written to the injected ports.Recorder. The ADK callbacks
+// below do the writing, so individual tools don't have to remember to log themselves.
+
+// taskRun is the per-task bookkeeping the callbacks share: which task and session we're in,
+// how many steps have run, and when the current tool call and model call started.
+type taskRun struct {
+	id        string
+	sessionID string
+
+	mu           sync.Mutex
+	step         int
+	toolCalls    map[string]*toolCall // FunctionCallID -> tool call that hasn't been recorded yet
+	modelStart   time.Time
+	modelSpan    trace.Span
+	lastErrorSeq int64            // Sequence number of the last page error written to the flight recorder
+	usage        domain.TaskUsage // Tokens and cost so far
+	stopErr      error            // Set once a budget or limit is hit; the next model call is skipped
+
+	// Loop detection (see limits.go)
+	lastCall      string   // Tool name + args of the previous call
+	repeats       int      // How many times in a row lastCall was made
+	lastSnapshot  [32]byte // Hash of the previous get_snapshot result
+	sameSnapshots int      // How many snapshots in a row were identical
+	hinted        bool     // The agent has already been told it is stuck
+
+	// History compaction (see compaction.go)
+	summary          string // Running summary of the earlier messages
+	summarized       int    // How many messages (after the goal) the summary covers
+	evictedSnapshots int    // How many old snapshots were shortened on the last model call
+
+	// Planner–executor mode (see plan.go)
+	plan    *domain.Plan // The current plan (nil = the task isn't planned)
+	replans int          // New plans made after failed steps
+}
+
+// toolCall is a tool call that has started but hasn't been written to the flight recorder yet.
+type toolCall struct {
+	tool  string
+	args  map[string]any
+	step  int
+	start time.Time
+	span  trace.Span
+}
+
+type taskRunKey struct{}
+
+func withTaskRun(ctx context.Context, run *taskRun) context.Context {
+	return context.WithValue(ctx, taskRunKey{}, run)
+}
+
+func taskRunFrom(ctx context.Context) *taskRun {
+	if ctx == nil {
+		return nil
+	}
+	run, _ := ctx.Value(taskRunKey{}).(*taskRun)
+	return run
+}
+
+// record fills in the task ID, session ID and step number and writes the record.
+// A broken recorder must never break a task, so errors are only logged.
+func (a *AgentAdapter) record(ctx context.Context, rec domain.FlightRecord) {
+	if a.recorder == nil {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if run := taskRunFrom(ctx); run != nil {
+		run.mu.Lock()
+		if rec.TaskID == "" {
+			rec.TaskID = run.id
+		}
+		if rec.SessionID == "" {
+			rec.SessionID = run.sessionID
+		}
+		if rec.Step == 0 {
+			rec.Step = run.step
+		}
+		run.mu.Unlock()
+	}
+	if rec.TraceID == "" {
+		rec.TraceID = traceID(ctx)
+	}
+	if err := a.recorder.Record(ctx, rec); err != nil {
+		log.Printf("Failed to write to flight recorder: %v", err)
+	}
+}
+
+// startToolStep runs before every tool call: it bumps the step counter and starts the clock.
+func (a *AgentAdapter) startToolStep(ctx tool.Context, t tool.Tool, args map[string]any) (map[string]any, error) {
+	if ctx == nil {
+		return nil, nil
+	}
+	if run := taskRunFrom(ctx); run != nil {
+		run.mu.Lock()
+		run.step++
+		if run.toolCalls == nil {
+			run.toolCalls = map[string]*toolCall{}
+		}
+		run.toolCalls[ctx.FunctionCallID()] = &toolCall{
+			tool:  t.Name(),
+			args:  args,
+			step:  run.step,
+			start: time.Now(),
+			span:  startToolSpan(ctx, t.Name(), run.step, args),
+		}
+		run.mu.Unlock()
+	}
+	return nil, nil
+}
+
+// recordToolStep runs after every tool call and writes what was called, what came back and how long it took.
+func (a *AgentAdapter) recordToolStep(ctx tool.Context, t tool.Tool, args, result map[string]any, err error) (map[string]any, error) {
+	if ctx != nil {
+		if call := a.takeToolCall(ctx, ctx.FunctionCallID()); call != nil {
+			a.finishToolCall(ctx, call, result, err)
+			return nil, nil
+		}
+	}
+	rec := domain.FlightRecord{Kind: "tool", Tool: t.Name(), Args: args, Result: result}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	a.record(ctx, rec)
+	return nil, nil
+}
+
+// takeToolCall removes the call from the task's open calls and returns it (nil if it isn't open).
+func (a *AgentAdapter) takeToolCall(ctx context.Context, callID string) *toolCall {
+	run := taskRunFrom(ctx)
+	if run == nil {
+		return nil
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	call := run.toolCalls[callID]
+	delete(run.toolCalls, callID)
+	return call
+}
+
+// finishToolCall ends the call's span and writes it to the flight recorder.
+func (a *AgentAdapter) finishToolCall(ctx context.Context, call *toolCall, result map[string]any, err error) {
+	duration := time.Since(call.start)
+	endSpan(call.span, duration, err)
+	rec := domain.FlightRecord{
+		Kind:       "tool",
+		Tool:       call.tool,
+		Step:       call.step,
+		Args:       call.args,
+		Result:     result,
+		DurationMs: duration.Milliseconds(),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	a.record(ctx, rec)
+}
+
+// recordFailedTools runs before each model call and writes the tool calls that failed since
+// the last one. The ADK skips the after-tool callbacks when a tool (or a before-tool callback)
+// returns an error, and only passes that error on to the model as the call's response. So we
+// pick it up here, from the function responses in the request.
+func (a *AgentAdapter) recordFailedTools(ctx agent.CallbackContext, req *model.LLMRequest) (*model.LLMResponse, error) {
+	if len(req.Contents) == 0 {
+		return nil, nil
+	}
+	// The responses to the last round of tool calls are always the latest message
+	for _, part := range req.Contents[len(req.Contents)-1].Parts {
+		if part.FunctionResponse == nil {
+			continue
+		}
+		call := a.takeToolCall(ctx, part.FunctionResponse.ID)
+		if call == nil {
+			continue // Already recorded by recordToolStep
+		}
+		err := errors.New("tool call failed")
+		if msg, ok := part.FunctionResponse.Response["error"]; ok {
+			err = fmt.Errorf("%v", msg)
+		}
+		a.finishToolCall(ctx, call, nil, err)
+		a.capturePageErrors(ctx, call.tool)
+	}
+	return nil, nil
+}
+
+// finishOpenToolCalls records any calls still open when the task ends (e.g. it was cancelled
+// mid-tool), so no span is left running.
+func (a *AgentAdapter) finishOpenToolCalls(ctx context.Context) {
+	run := taskRunFrom(ctx)
+	if run == nil {
+		return
+	}
+	run.mu.Lock()
+	calls := run.toolCalls
+	run.toolCalls = nil
+	run.mu.Unlock()
+	for _, call := range calls {
+		a.finishToolCall(ctx, call, nil, errors.New("the task ended before the tool call finished"))
+	}
+}
+
+// startModelCall runs before each request to the model.
+func (a *AgentAdapter) startModelCall(ctx agent.CallbackContext, req *model.LLMRequest) (*model.LLMResponse, error) {
+	if run := taskRunFrom(ctx); run != nil {
+		run.mu.Lock()
+		run.modelStart = time.Now()
+		_, run.modelSpan = tracer().Start(ctx, "kortex.model", trace.WithAttributes(
+			attribute.String("gen_ai.request.model", req.Model),
+		))
+		run.mu.Unlock()
+	}
+	return nil, nil
+}
+
+// recordModelCall runs after each model response and writes its latency and token usage.
+func (a *AgentAdapter) recordModelCall(ctx agent.CallbackContext, resp *model.LLMResponse, respErr error) (*model.LLMResponse, error) {
+	rec := domain.FlightRecord{Kind: "model"}
+	if respErr != nil {
+		rec.Error = respErr.Error()
+	}
+	if resp != nil {
+		rec.Usage = tokenUsage(resp)
+		rec.Result = summarizeResponse(resp)
+	}
+	if run := taskRunFrom(ctx); run != nil {
+		run.mu.Lock()
+		if !run.modelStart.IsZero() {
+			rec.DurationMs = time.Since(run.modelStart).Milliseconds()
+		}
+		if run.modelSpan != nil {
+			if rec.Usage != nil {
+				run.modelSpan.SetAttributes(
+					attribute.Int("gen_ai.usage.input_tokens", rec.Usage.PromptTokens),
+					attribute.Int("gen_ai.usage.output_tokens", rec.Usage.CompletionTokens),
+				)
+			}
+			endSpan(run.modelSpan, time.Duration(rec.DurationMs)*time.Millisecond, respErr)
+			run.modelSpan = nil
+		}
+		run.mu.Unlock()
+	}
+	a.record(ctx, rec)
+	a.addUsage(ctx, rec.Usage, servedBy(resp))
+	return nil, nil
+}
+
+// tokenUsage converts Gemini's usage metadata into our own type.
+func tokenUsage(resp *model.LLMResponse) *domain.TokenUsage {
+	if resp.UsageMetadata == nil {
+		return nil
+	}
+	return &domain.TokenUsage{
+		PromptTokens:     int(resp.UsageMetadata.PromptTokenCount),
+		CompletionTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+		TotalTokens:      int(resp.UsageMetadata.TotalTokenCount),
+	}
+}
+
+// summarizeResponse keeps what the model said and which tools it asked for, without the raw payload.
+func summarizeResponse(resp *model.LLMResponse) map[string]any {
+	if resp.Content == nil {
+		return nil
+	}
+	var text []string
+	var calls []string
+	for _, part := range resp.Content.Parts {
+		if part.Text != "" {
+			text = append(text, part.Text)
+		}
+		if part.FunctionCall != nil {
+			calls = append(calls, part.FunctionCall.Name)
+		}
+	}
+	summary := map[string]any{}
+	if len(text) > 0 {
+		summary["text"] = strings.Join(text, "\n")
+	}
+	if len(calls) > 0 {
+		summary["tool_calls"] = calls
+	}
+	return summary
+}
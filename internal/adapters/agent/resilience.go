@@ -0,0 +1,326 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/llm"
+	"google.golang.org/adk/model"
+)
+
+// --- Retries, Fallbacks and the Circuit Breaker ---
+// Model APIs have bad minutes: rate limits (429) and overloaded servers (503).
+// Instead of failing the task on the first one, the Brain waits and tries again,
+// then moves on to a fallback model (e.g. Pro -> Flash). A model that keeps failing
+// is left alone for a while (the circuit is "open"), so tasks don't queue up behind it.
+// Every retry and fallback is written to the flight recorder, and shown to the user
+// while the task runs (see WithTaskEvents).
+
+// RetryPolicy says how hard to try before giving up on a model call.
+type RetryPolicy struct {
+	MaxRetries int           // Extra tries per model for transient errors (0 = no retries)
+	BaseDelay  time.Duration // Wait before the first retry; doubled for each one after
+	MaxDelay   time.Duration // Longest wait, also for a server's Retry-After
+
+	// Fallbacks are tried in order when a model keeps failing, its circuit is open, or
+	// the conversation no longer fits its context window. Empty fields are taken from
+	// the task's model, like WithTaskModel.
+	Fallbacks []domain.ModelConfig
+
+	BreakerThreshold int           // Failed calls in a row that open a model's circuit (0 = no breaker)
+	BreakerCooldown  time.Duration // How long an open circuit stays open
+}
+
+// DefaultRetryPolicy rides out a short outage without making the user wait for minutes.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:       3,
+	BaseDelay:        time.Second,
+	MaxDelay:         30 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  time.Minute,
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(a *AgentAdapter) { a.retry = policy }
+}
+
+// ErrCircuitOpen is returned when every model's circuit is open.
+var ErrCircuitOpen = errors.New("model circuit open after repeated failures")
+
+// breaker is the circuit breaker for one model. It is shared by all tasks.
+// It is "closed" (calls go through), "open" (calls are refused until the cooldown is over)
+// or "half-open" (the cooldown is over and a single call is trying the model again).
+type breaker struct {
+	mu        sync.Mutex
+	failures  int       // Failed calls in a row
+	openUntil time.Time // Calls are refused until then (zero = closed)
+	probing   bool      // Half-open: a call is trying the model; others are refused until it's done
+}
+
+// allow reports whether the model may be called. probe is true for the one call let
+// through once the cooldown is over: if it succeeds the circuit closes, if it fails the
+// circuit opens again straight away. The caller must end a probe with succeeded, failed or release.
+func (b *breaker) allow(now time.Time) (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.openUntil.IsZero():
+		return true, false
+	case now.Before(b.openUntil) || b.probing:
+		return false, false
+	default:
+		b.probing = true
+		return true, true
+	}
+}
+
+// failed counts a failure and reports whether it opened the circuit. A failed probe
+// opens it again, however many failures it takes to open it the first time.
+func (b *breaker) failed(now time.Time, threshold int, cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if threshold <= 0 || (b.failures < threshold && !b.probing) {
+		return false
+	}
+	b.openUntil = now.Add(cooldown)
+	b.probing = false
+	return true
+}
+
+// succeeded closes the circuit: the model works.
+func (b *breaker) succeeded() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+}
+
+// release ends a probe that didn't tell whether the model works (e.g. the task was
+// cancelled, or the request was bad), so the next call can try again.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// breakerFor returns the circuit breaker of cfg's model.
+func (a *AgentAdapter) breakerFor(cfg domain.ModelConfig) *breaker {
+	a.breakersMu.Lock()
+	defer a.breakersMu.Unlock()
+	key := modelKey(cfg)
+	if a.breakers[key] == nil {
+		a.breakers[key] = &breaker{}
+	}
+	return a.breakers[key]
+}
+
+func modelKey(cfg domain.ModelConfig) string { return cfg.Provider + "/" + cfg.Model }
+
+// newResilientModel creates the task's model, wrapped with the retry policy.
+// The first model is created straight away, so a bad config fails the task early;
+// fallbacks are only created if they are needed.
+func (a *AgentAdapter) newResilientModel(ctx context.Context, cfg domain.ModelConfig) (model.LLM, error) {
+	first, err := a.newModel(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	chain := []domain.ModelConfig{cfg}
+	for _, fallback := range a.retry.Fallbacks {
+		chain = append(chain, overrideModelConfig(cfg, fallback))
+	}
+	return &resilientModel{agent: a, chain: chain, first: first}, nil
+}
+
+// resilientModel tries each model of its chain in turn, retrying transient errors.
+type resilientModel struct {
+	agent *AgentAdapter
+	chain []domain.ModelConfig // The task's model, then the fallbacks
+	first model.LLM            // chain[0], already created
+}
+
+func (m *resilientModel) Name() string { return m.first.Name() }
+
+func (m *resilientModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		a := m.agent
+		var lastErr error
+		for i, cfg := range m.chain {
+			if i > 0 {
+				a.recordRecovery(ctx, domain.FlightRecord{Kind: "fallback", Error: lastErr.Error(), Details: map[string]any{
+					"from": modelKey(m.chain[i-1]),
+					"to":   modelKey(cfg),
+				}})
+			}
+
+			b := a.breakerFor(cfg)
+			ok, probe := b.allow(time.Now())
+			if !ok {
+				lastErr = fmt.Errorf("%s: %w", modelKey(cfg), ErrCircuitOpen)
+				continue
+			}
+			inner := m.first
+			if i > 0 {
+				var err error
+				if inner, err = a.newModel(ctx, cfg); err != nil {
+					if probe {
+						b.release()
+					}
+					lastErr = err
+					continue
+				}
+			}
+
+			var done bool
+			done, lastErr = m.try(ctx, cfg, inner, b, probe, req, stream, yield)
+			if done {
+				return
+			}
+		}
+		yield(nil, lastErr)
+	}
+}
+
+// try calls one model, with retries. done means the call is over (answered, failed
+// for good, or the caller stopped reading); otherwise err is why the next model should be tried.
+// probe is true if this call is testing a half-open circuit: it gets no retries.
+func (m *resilientModel) try(ctx context.Context, cfg domain.ModelConfig, inner model.LLM, b *breaker, probe bool, req *model.LLMRequest, stream bool,
+	yield func(*model.LLMResponse, error) bool) (done bool, err error) {
+	a := m.agent
+	if probe {
+		defer b.release() // Unless the probe already succeeded or failed
+	}
+	for attempt := 0; ; attempt++ {
+		answered := false
+		var callErr error
+		for resp, err := range inner.GenerateContent(ctx, req, stream) {
+			if err != nil {
+				callErr = err
+				break
+			}
+			answered = true
+			markServedBy(resp, cfg, inner)
+			if !yield(resp, nil) {
+				b.succeeded()
+				return true, nil
+			}
+		}
+		switch {
+		case callErr == nil:
+			b.succeeded()
+			return true, nil
+		case answered || ctx.Err() != nil:
+			// Half an answer can't be taken back, and a cancelled task shouldn't be retried
+			yield(nil, callErr)
+			return true, nil
+		case llm.IsContextOverflow(callErr):
+			return false, callErr // A model with a bigger window may cope
+		case !llm.IsTransient(callErr):
+			yield(nil, callErr) // A bad key or a bad request won't get better by trying again
+			return true, nil
+		}
+
+		if b.failed(time.Now(), a.retry.BreakerThreshold, a.retry.BreakerCooldown) {
+			a.recordRecovery(ctx, domain.FlightRecord{Kind: "circuit_open", Error: callErr.Error(), Details: map[string]any{
+				"model":       modelKey(cfg),
+				"cooldown_ms": a.retry.BreakerCooldown.Milliseconds(),
+			}})
+			return false, callErr
+		}
+		if attempt >= a.retry.MaxRetries {
+			return false, callErr
+		}
+
+		delay := a.retry.backoff(attempt, llm.RetryAfter(callErr))
+		a.recordRecovery(ctx, domain.FlightRecord{Kind: "retry", Error: callErr.Error(), Details: map[string]any{
+			"model":    modelKey(cfg),
+			"attempt":  attempt + 1,
+			"delay_ms": delay.Milliseconds(),
+		}})
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			yield(nil, ctx.Err())
+			return true, nil
+		}
+	}
+}
+
+type taskEventsKey struct{}
+
+// WithTaskEvents sends the retries, fallbacks and opened circuits of the task run with ctx
+// to events as they happen, so the user sees why the task is slow instead of a silent wait.
+// They go to the flight recorder either way. DescribeRecovery puts them into words.
+func WithTaskEvents(ctx context.Context, events func(domain.FlightRecord)) context.Context {
+	return context.WithValue(ctx, taskEventsKey{}, events)
+}
+
+// recordRecovery writes a retry, fallback or circuit_open record and passes it on to the task's events.
+func (a *AgentAdapter) recordRecovery(ctx context.Context, rec domain.FlightRecord) {
+	a.record(ctx, rec)
+	if events, ok := ctx.Value(taskEventsKey{}).(func(domain.FlightRecord)); ok && events != nil {
+		events(rec)
+	}
+}
+
+// DescribeRecovery says what a retry, fallback or circuit_open record means, for the user.
+func DescribeRecovery(rec domain.FlightRecord) string {
+	details, _ := rec.Details.(map[string]any)
+	ms := func(key string) time.Duration {
+		n, _ := details[key].(int64)
+		return time.Duration(n) * time.Millisecond
+	}
+	switch rec.Kind {
+	case "retry":
+		return fmt.Sprintf("⏳ %v failed (%s), retrying in %s (attempt %v)", details["model"], rec.Error, ms("delay_ms"), details["attempt"])
+	case "fallback":
+		return fmt.Sprintf("🔀 Switching from %v to %v: %s", details["from"], details["to"], rec.Error)
+	case "circuit_open":
+		return fmt.Sprintf("⛔ %v keeps failing, so it is skipped for %s: %s", details["model"], ms("cooldown_ms"), rec.Error)
+	default:
+		return rec.Kind + ": " + rec.Error
+	}
+}
+
+// markServedBy notes in resp which model answered, so its tokens are priced at that
+// model's rate rather than the task's (see addUsage).
+func markServedBy(resp *model.LLMResponse, cfg domain.ModelConfig, inner model.LLM) {
+	if resp == nil {
+		return
+	}
+	name := cfg.Model
+	if name == "" {
+		name = inner.Name() // The provider's default model
+	}
+	if resp.CustomMetadata == nil {
+		resp.CustomMetadata = map[string]any{}
+	}
+	resp.CustomMetadata[servedByKey] = name
+}
+
+// backoff is the wait before retry number attempt+1: the server's Retry-After if it
+// sent one, otherwise BaseDelay doubled for each earlier retry. Either way at most MaxDelay.
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := retryAfter
+	if delay <= 0 {
+		delay = p.BaseDelay
+		for i := 0; i < attempt && delay > 0; i++ {
+			if delay > math.MaxInt64/2 {
+				break // Doubling again would overflow into a negative wait
+			}
+			delay *= 2
+		}
+	}
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay <= 0) {
+		delay = p.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// --- Tracing ---
+// Next to the flight recorder, every task is an OpenTelemetry trace: one span for
+// the whole task, with a child span per model turn and per tool call. The spans
+// use the global tracer provider (see internal/infra/tracing), so they are free
+// when tracing is off.
+
+const tracerName = "github.com/PundarikakshNTripathi/Kortex/internal/adapters/agent"
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// startTaskSpan opens the span that every model and tool span of the task hangs off.
+// The goal itself is left out: it may hold personal data, and the flight recorder
+// already keeps a redacted copy.
+func startTaskSpan(ctx context.Context, run *taskRun) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "kortex.task", trace.WithAttributes(
+		attribute.String("kortex.task_id", run.id),
+		attribute.String("kortex.session_id", run.sessionID),
+	))
+}
+
+// startToolSpan opens a span for one tool call. Selectors and URLs say where the
+// agent was acting; typed text is never added, since it can be a password.
+func startToolSpan(ctx context.Context, name string, step int, args map[string]any) trace.Span {
+	attrs := []attribute.KeyValue{
+		attribute.String("kortex.tool", name),
+		attribute.Int("kortex.step", step),
+	}
+	if selector, ok := args["Selector"].(string); ok && selector != "" {
+		attrs = append(attrs, attribute.String("kortex.selector", selector))
+	}
+	if url, ok := args["URL"].(string); ok && url != "" {
+		attrs = append(attrs, attribute.String("url.full", url))
+	}
+	_, span := tracer().Start(ctx, "kortex.tool "+name, trace.WithAttributes(attrs...))
+	return span
+}
+
+// endSpan records how long the step took and whether it failed, then closes the span.
+func endSpan(span trace.Span, duration time.Duration, err error) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes(attribute.Int64("kortex.duration_ms", duration.Milliseconds()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceID returns the ID of the trace ctx belongs to, so flight records can point at it.
+func traceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"google.golang.org/adk/model"
+)
+
+// --- Usage and Budgets ---
+// Every model response says how many tokens it used. We add those up per task,
+// price them, save the running total and stop the task once a budget is used up.
+
+// ErrBudgetExceeded is returned (wrapped) by ExecuteTask when a task was stopped by a budget.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Pricing is what a model charges, in US dollars per million tokens.
+type Pricing struct {
+	InputPerMillion  float64 // Prompt tokens
+	OutputPerMillion float64 // Completion tokens
+}
+
+// DefaultPricing holds list prices for the models we use (prompts under 200k tokens).
+// Override it with WithPricing when prices change or for other models.
+var DefaultPricing = map[string]Pricing{
+	"gemini-3-pro-preview": {InputPerMillion: 2.00, OutputPerMillion: 12.00},
+	"gemini-2.5-pro":       {InputPerMillion: 1.25, OutputPerMillion: 10.00},
+	"gemini-2.5-flash":     {InputPerMillion: 0.30, OutputPerMillion: 2.50},
+}
+
+// Cost prices one model call.
+func (p Pricing) Cost(usage domain.TokenUsage) float64 {
+	return (float64(usage.PromptTokens)*p.InputPerMillion + float64(usage.CompletionTokens)*p.OutputPerMillion) / 1e6
+}
+
+// ErrNoPrice is returned (wrapped) when a dollar budget is set but a model's price is unknown,
+// so the budget couldn't be enforced.
+var ErrNoPrice = errors.New("no price known for the model")
+
+// pricing returns what model charges: the configured prices for the agent's own model
+// (WithPricing), otherwise the list price. known is false if there is neither, in which
+// case the model's tokens would look free.
+func (a *AgentAdapter) pricing(model string) (price Pricing, known bool) {
+	if a.prices != nil && model == a.model.Model {
+		return *a.prices, true
+	}
+	price, known = DefaultPricing[model]
+	return price, known
+}
+
+// checkPriced makes sure a dollar budget can be enforced for model. Without a budget, an
+// unknown price is only logged (once per model), as the cost will be reported as $0.
+func (a *AgentAdapter) checkPriced(model string) error {
+	if _, known := a.pricing(model); known {
+		return nil
+	}
+	if a.budget.TaskUSD > 0 || a.budget.DailyUSD > 0 {
+		return fmt.Errorf("%w: %q, so the dollar budget can't be checked (set MODEL_PRICE_INPUT_PER_M and MODEL_PRICE_OUTPUT_PER_M)", ErrNoPrice, model)
+	}
+	if _, warned := a.unpriced.LoadOrStore(model, true); !warned {
+		log.Printf("No price known for model %q: its cost is counted as $0", model)
+	}
+	return nil
+}
+
+// servedByKey marks which model answered, in LLMResponse.CustomMetadata (see resilientModel).
+const servedByKey = "kortex_served_by"
+
+// servedBy returns the model that produced resp, or "" if it wasn't marked.
+func servedBy(resp *model.LLMResponse) string {
+	if resp == nil {
+		return ""
+	}
+	name, _ := resp.CustomMetadata[servedByKey].(string)
+	return name
+}
+
+// addUsage adds one model call to the task's total, saves it and checks the budget.
+// model is the model that answered ("" = the task's model); after a fallback it isn't the
+// one the task started with, and the tokens are priced at its rate.
+// If the budget is used up, the task is stopped before its next model call (see haltIfStopped).
+func (a *AgentAdapter) addUsage(ctx context.Context, usage *domain.TokenUsage, model string) {
+	run := taskRunFrom(ctx)
+	if run == nil || usage == nil {
+		return
+	}
+	run.mu.Lock()
+	if model == "" {
+		model = run.usage.Model
+	}
+	price, _ := a.pricing(model)
+	run.usage.ModelCalls++
+	run.usage.PromptTokens += usage.PromptTokens
+	run.usage.CompletionTokens += usage.CompletionTokens
+	run.usage.TotalTokens += usage.TotalTokens
+	run.usage.CostUSD += price.Cost(*usage)
+	total := run.usage
+	run.mu.Unlock()
+
+	a.saveUsage(ctx, total)
+	err := a.checkPriced(model)
+	if err == nil {
+		err = a.checkBudget(ctx, total)
+	}
+	if err != nil {
+		a.stop(ctx, err)
+	}
+}
+
+// saveUsage persists the task's running total. Like the flight recorder, a failing
+// store must not break the task, so errors are only logged.
+func (a *AgentAdapter) saveUsage(ctx context.Context, usage domain.TaskUsage) {
+	if a.usage == nil {
+		return
+	}
+	if err := a.usage.SaveUsage(ctx, usage); err != nil {
+		log.Printf("Failed to save token usage: %v", err)
+	}
+}
+
+// checkBudget compares a task's usage (and today's, if there is a usage store) with the budget.
+func (a *AgentAdapter) checkBudget(ctx context.Context, task domain.TaskUsage) error {
+	b := a.budget
+	if b.TaskTokens > 0 && task.TotalTokens >= b.TaskTokens {
+		return fmt.Errorf("%w: task used %d tokens (limit %d)", ErrBudgetExceeded, task.TotalTokens, b.TaskTokens)
+	}
+	if b.TaskUSD > 0 && task.CostUSD >= b.TaskUSD {
+		return fmt.Errorf("%w: task cost $%.4f (limit $%.2f)", ErrBudgetExceeded, task.CostUSD, b.TaskUSD)
+	}
+
+	if a.usage == nil || (b.DailyTokens == 0 && b.DailyUSD == 0) {
+		return nil
+	}
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	today, err := a.usage.UsageSince(ctx, midnight)
+	if err != nil {
+		log.Printf("Failed to check daily budget: %v", err)
+		return nil
+	}
+	if b.DailyTokens > 0 && today.TotalTokens >= b.DailyTokens {
+		return fmt.Errorf("%w: %d tokens used today (limit %d)", ErrBudgetExceeded, today.TotalTokens, b.DailyTokens)
+	}
+	if b.DailyUSD > 0 && today.CostUSD >= b.DailyUSD {
+		return fmt.Errorf("%w: $%.4f spent today (limit $%.2f)", ErrBudgetExceeded, today.CostUSD, b.DailyUSD)
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/ports"
+)
+
+// Replay turns a recorded task back into actions. It reads the "tool" records of one task
+// from the flight recorder and performs the same calls on a browser, in the same order,
+// without asking the LLM anything. A run that worked once becomes a deterministic macro,
+// and a run that suddenly diverges is a regression test failing.
+
+// Step outcomes.
+const (
+	StatusOK       = "ok"       // Behaved like the recording
+	StatusDiverged = "diverged" // Failed when the recording succeeded, or the other way round
+	StatusSkipped  = "skipped"  // Can't be replayed (asks the user, or its args were redacted)
+)
+
+// StepResult is what happened when one recorded step was replayed.
+type StepResult struct {
+	Step     int            `json:"step"`
+	Tool     string         `json:"tool"`
+	Args     map[string]any `json:"args,omitempty"`
+	Status   string         `json:"status"`
+	Expected string         `json:"expected,omitempty"` // Recorded result or error
+	Got      string         `json:"got,omitempty"`      // Result or error this time
+	Reason   string         `json:"reason,omitempty"`   // Why it diverged or was skipped
+}
+
+// Report summarises a replay.
+type Report struct {
+	TaskID string       `json:"task_id"`
+	Steps  []StepResult `json:"steps"`
+}
+
+// Diverged returns the first step that didn't match the recording, or nil.
+func (r *Report) Diverged() *StepResult {
+	for i := range r.Steps {
+		if r.Steps[i].Status == StatusDiverged {
+			return &r.Steps[i]
+		}
+	}
+	return nil
+}
+
+// Options tune a replay.
+type Options struct {
+	StopOnDivergence bool               // Stop at the first step that doesn't match
+	Secrets          ports.SecretStore  // Resolves {{secret:...}} placeholders in typed text
+	OTP              ports.OTPGenerator // Lets fill_otp steps be replayed from stored TOTP seeds
+}
+
+// Tasks lists the tasks in a set of records, in the order they started.
+func Tasks(records []domain.FlightRecord) []domain.TaskSummary {
+	byID := map[string]*domain.TaskSummary{}
+	var order []string
+	for _, rec := range records {
+		if rec.TaskID == "" {
+			continue
+		}
+		t, ok := byID[rec.TaskID]
+		if !ok {
+			t = &domain.TaskSummary{TaskID: rec.TaskID, StartedAt: rec.Time}
+			byID[rec.TaskID] = t
+			order = append(order, rec.TaskID)
+		}
+		switch rec.Kind {
+		case "task_start":
+			if details, ok := rec.Details.(map[string]any); ok {
+				t.Goal, _ = details["goal"].(string)
+			}
+		case "tool":
+			t.Steps++
+		case "task_end":
+			t.Done, t.Error = true, rec.Error
+		}
+	}
+	tasks := make([]domain.TaskSummary, len(order))
+	for i, id := range order {
+		tasks[i] = *byID[id]
+	}
+	return tasks
+}
+
+// TaskSteps picks the tool calls of one task, ordered by step number.
+func TaskSteps(records []domain.FlightRecord, taskID string) []domain.FlightRecord {
+	var steps []domain.FlightRecord
+	for _, rec := range records {
+		if rec.TaskID == taskID && rec.Kind == "tool" {
+			steps = append(steps, rec)
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].Step < steps[j].Step })
+	return steps
+}
+
+// Run replays the tool calls of one task against the browser and reports where behaviour diverged.
+// It returns an error only if the replay itself couldn't run (e.g. no such task).
+func Run(ctx context.Context, browser ports.Browser, records []domain.FlightRecord, taskID string, opts Options) (*Report, error) {
+	steps := TaskSteps(records, taskID)
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("no recorded tool calls for task %s", taskID)
+	}
+
+	report := &Report{TaskID: taskID}
+	for _, rec := range steps {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		result := replayStep(ctx, browser, rec, opts)
+		report.Steps = append(report.Steps, result)
+		if result.Status == StatusDiverged && opts.StopOnDivergence {
+			break
+		}
+	}
+	return report, nil
+}
+
+// replayStep performs one recorded call and compares the outcome with the recording.
+func replayStep(ctx context.Context, browser ports.Browser, rec domain.FlightRecord, opts Options) StepResult {
+	args, _ := rec.Args.(map[string]any)
+	res := StepResult{Step: rec.Step, Tool: rec.Tool, Args: args, Expected: expected(rec)}
+
+	for _, v := range args {
+		if s, ok := v.(string); ok && strings.Contains(s, "[REDACTED:") {
+			res.Status = StatusSkipped
+			res.Reason = "arguments were redacted in the recording"
+			return res
+		}
+	}
+
+	got, err, skip := call(ctx, browser, rec.Tool, args, opts)
+	if skip != "" {
+		res.Status = StatusSkipped
+		res.Reason = skip
+		return res
+	}
+
+	switch {
+	case err != nil && rec.Error == "":
+		res.Status, res.Got, res.Reason = StatusDiverged, err.Error(), "failed now but succeeded in the recording"
+	case err == nil && rec.Error != "":
+		res.Status, res.Got, res.Reason = StatusDiverged, got, "succeeded now but failed in the recording"
+	case err != nil:
+		res.Status, res.Got = StatusOK, err.Error() // Failed both times, like the recording
+	case deterministic[rec.Tool] && res.Expected != "" && got != res.Expected:
+		res.Status, res.Got, res.Reason = StatusDiverged, got, "returned a different result"
+	default:
+		res.Status, res.Got = StatusOK, got
+	}
+	return res
+}
+
+// deterministic lists tools whose result text only depends on their arguments, so a
+// different result means different behaviour. Snapshots and page text change all the time.
+var deterministic = map[string]bool{
+	"navigate":      true,
+	"click":         true,
+	"type":          true,
+	"highlight":     true,
+	"handle_dialog": true,
+}
+
+// call maps a recorded tool name back onto the browser. skip is set for tools
+// that can't be replayed without a human or the model.
+func call(ctx context.Context, browser ports.Browser, tool string, args map[string]any, opts Options) (result string, err error, skip string) {
+	switch tool {
+	case "navigate":
+		url := str(args, "URL")
+		return "Navigated to " + url, browser.Navigate(url), ""
+	case "click":
+		sel := str(args, "Selector")
+		return "Clicked " + sel, browser.Click(sel), ""
+	case "type":
+		sel, text := str(args, "Selector"), str(args, "Text")
+		if opts.Secrets != nil {
+			resolved, err := opts.Secrets.Resolve(text, pageHost(browser))
+			if err != nil {
+				return "", err, ""
+			}
+			text = resolved
+		}
+		return "Typed into " + sel, browser.Type(sel, text), ""
+	case "highlight":
+		sel := str(args, "Selector")
+		return "Highlighted " + sel, browser.Highlight(sel, str(args, "Message")), ""
+	case "get_snapshot":
+		_, err := browser.GetSnapshot()
+		return "", err, ""
+	case "read_page":
+		offset, _ := args["Offset"].(float64)
+		_, err := browser.ReadPage(int(offset))
+		return "", err, ""
+	case "handle_dialog":
+		accept, _ := args["Accept"].(bool)
+		err := browser.HandleDialog(accept, str(args, "PromptText"))
+		if accept {
+			return "Accepted dialog", err, ""
+		}
+		return "Dismissed dialog", err, ""
+	case "get_page_errors":
+		_, err := browser.GetPageErrors()
+		return "", err, ""
+	case "fill_otp":
+		if opts.OTP == nil {
+			return "", nil, "one-time codes need a TOTP seed in the vault"
+		}
+		code, err := opts.OTP.OTPFor(str(args, "Site"), pageHost(browser))
+		if err != nil {
+			return "", nil, fmt.Sprintf("no usable TOTP seed for %s (%v)", str(args, "Site"), err)
+		}
+		return "", browser.Type(str(args, "Selector"), code), ""
+	case "ask_user":
+		return "", nil, "asks the user a question"
+	default:
+		return "", nil, "unknown tool"
+	}
+}
+
+// expected is the recorded outcome as text: the error, or the tool's result string.
+func expected(rec domain.FlightRecord) string {
+	if rec.Error != "" {
+		return rec.Error
+	}
+	switch r := rec.Result.(type) {
+	case string:
+		return r
+	case map[string]any:
+		// ADK wraps a plain string result as {"result": "..."}
+		if s, ok := r["result"].(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// pageHost returns the host name of the page the browser is on, so secrets are only typed into their own site.
+func pageHost(browser ports.Browser) string {
+	current, err := browser.CurrentURL()
+	if err != nil {
+		return ""
+	}
+	u, err := url.Parse(current)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// str reads a string argument. Models are inconsistent about casing, so match case-insensitively.
+func str(args map[string]any, key string) string {
+	if v, ok := args[key].(string); ok {
+		return v
+	}
+	for k, v := range args {
+		if strings.EqualFold(k, key) {
+			s, _ := v.(string)
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+)
+
+// MockBrowser implements ports.Browser and remembers every call.
+// Selectors listed in missing fail, like an element that's no longer on the page.
+type MockBrowser struct {
+	calls   []string
+	missing map[string]bool
+}
+
+func (m *MockBrowser) do(call, selector string) error {
+	m.calls = append(m.calls, call)
+	if m.missing[selector] {
+		return fmt.Errorf("element %s not found", selector)
+	}
+	return nil
+}
+
+func (m *MockBrowser) Navigate(url string) error { return m.do("navigate "+url, "") }
+func (m *MockBrowser) GetSnapshot() (string, error) {
+	return "<html></html>", m.do("get_snapshot", "")
+}
+func (m *MockBrowser) ReadPage(offset int) (*domain.PageChunk, error) {
+	return &domain.PageChunk{Offset: offset}, m.do("read_page", "")
+}
+func (m *MockBrowser) Highlight(selector, message string) error {
+	return m.do("highlight "+selector, selector)
+}
+func (m *MockBrowser) Click(selector string) error { return m.do("click "+selector, selector) }
+func (m *MockBrowser) Type(selector, text string) error {
+	return m.do("type "+selector+" "+text, selector)
+}
+func (m *MockBrowser) HandleDialog(accept bool, promptText string) error {
+	return m.do(fmt.Sprintf("handle_dialog %v", accept), "")
+}
+func (m *MockBrowser) GetPageErrors() ([]domain.PageError, error) {
+	return nil, m.do("get_page_errors", "")
+}
+func (m *MockBrowser) CurrentURL() (string, error) { return "https://example.com/login", nil }
+func (m *MockBrowser) DescribeElement(selector string) (*domain.ElementInfo, error) {
+	return &domain.ElementInfo{}, nil
+}
+
+// MockSecrets resolves one known placeholder.
+type MockSecrets struct{}
+
+func (MockSecrets) Resolve(text, host string) (string, error) {
+	return strings.ReplaceAll(text, "{{secret:example.com.password}}", "hunter2"), nil
+}
+func (MockSecrets) List() []domain.SecretRef { return nil }
+
+func tool(task string, step int, name string, args map[string]any, result any, errText string) domain.FlightRecord {
+	return domain.FlightRecord{TaskID: task, Kind: "tool", Step: step, Tool: name, Args: args, Result: result, Error: errText}
+}
+
+// recording is a small login task, plus noise from another task and non-tool records.
+func recording() []domain.FlightRecord {
+	return []domain.FlightRecord{
+		{TaskID: "t1", Kind: "task_start", Details: map[string]any{"goal": "log in"}},
+		tool("t1", 1, "navigate", map[string]any{"URL": "https://example.com"}, map[string]any{"result": "Navigated to https://example.com"}, ""),
+		{TaskID: "t1", Kind: "model", Step: 2},
+		tool("t2", 1, "click", map[string]any{"Selector": "#other"}, nil, ""),
+		tool("t1", 3, "type", map[string]any{"Selector": "#password", "Text": "{{secret:example.com.password}}"}, map[string]any{"result": "Typed into #password"}, ""),
+		tool("t1", 4, "ask_user", map[string]any{"Question": "Which account?"}, nil, ""),
+		tool("t1", 5, "type", map[string]any{"Selector": "#email", "Text": "[REDACTED:email]"}, nil, ""),
+		tool("t1", 6, "click", map[string]any{"Selector": "#login"}, map[string]any{"result": "Clicked #login"}, ""),
+		{TaskID: "t1", Kind: "task_end"},
+	}
+}
+
+func TestRunMatchesRecording(t *testing.T) {
+	b := &MockBrowser{}
+	report, err := Run(context.Background(), b, recording(), "t1", Options{Secrets: MockSecrets{}})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	want := []string{"navigate https://example.com", "type #password hunter2", "click #login"}
+	if strings.Join(b.calls, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected calls %v, got %v", want, b.calls)
+	}
+	if d := report.Diverged(); d != nil {
+		t.Errorf("Expected no divergence, got %+v", d)
+	}
+
+	statuses := map[int]string{}
+	for _, s := range report.Steps {
+		statuses[s.Step] = s.Status
+	}
+	if statuses[4] != StatusSkipped || statuses[5] != StatusSkipped {
+		t.Errorf("Expected ask_user and redacted steps to be skipped, got %v", statuses)
+	}
+}
+
+func TestRunReportsDivergence(t *testing.T) {
+	b := &MockBrowser{missing: map[string]bool{"#password": true}}
+	report, err := Run(context.Background(), b, recording(), "t1", Options{Secrets: MockSecrets{}, StopOnDivergence: true})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	d := report.Diverged()
+	if d == nil || d.Step != 3 {
+		t.Fatalf("Expected divergence at step 3, got %+v", d)
+	}
+	if !strings.Contains(d.Got, "not found") {
+		t.Errorf("Expected the new error in Got, got %q", d.Got)
+	}
+	if last := report.Steps[len(report.Steps)-1]; last.Step != 3 {
+		t.Errorf("Expected replay to stop at step 3, stopped at %d", last.Step)
+	}
+}
+
+func TestRunUnknownTask(t *testing.T) {
+	if _, err := Run(context.Background(), &MockBrowser{}, recording(), "nope", Options{}); err == nil {
+		t.Error("Expected error for a task with no tool calls")
+	}
+}
+
+func TestTasks(t *testing.T) {
+	tasks := Tasks(recording())
+	if len(tasks) != 2 {
+		t.Fatalf("Expected 2 tasks, got %d", len(tasks))
+	}
+	if tasks[0].TaskID != "t1" || tasks[0].Goal != "log in" || tasks[0].Steps != 5 {
+		t.Errorf("Unexpected summary: %+v", tasks[0])
+	}
+}
@@ -0,0 +1,332 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/adapters/agent"
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/ports"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/browser"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/hitl"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/llm"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/logger"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/sqlite"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/urlpolicy"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/vault"
+)
+
+// --- Configuration ---
+// The desktop app (app.go) and the web server (cmd/web) read the same environment
+// variables (see .env.example). Reading them, and turning them into browser settings
+// and agent options, lives here so both binaries always agree.
+// Bad values are logged and replaced by the default, so a typo never stops Kortex starting.
+
+// APIKey returns GOOGLE_API_KEY. It is an error for it to be missing when Gemini is the
+// provider, unless recorded responses are replayed (LLM_CACHE=replay), which need no key.
+func APIKey() (string, error) {
+	apiKey := os.Getenv("GOOGLE_API_KEY")
+	if provider := os.Getenv("LLM_PROVIDER"); apiKey == "" && (provider == "" || provider == llm.ProviderGemini) && os.Getenv("LLM_CACHE") != llm.CacheReplay {
+		return "", fmt.Errorf("GOOGLE_API_KEY not set. Please create a .env file with your API key")
+	}
+	return apiKey, nil
+}
+
+// DBPath is where the SQLite database lives (DB_PATH, default ./kortex.db).
+func DBPath() string {
+	if dbPath := os.Getenv("DB_PATH"); dbPath != "" {
+		return dbPath
+	}
+	return "./kortex.db"
+}
+
+// Browser applies the dialog and popup policies, granted permissions and network profile to b.
+// Call it before b.Init.
+func Browser(b *browser.PlaywrightBrowser) error {
+	dialogPolicy, err := browser.ParseDialogPolicy(os.Getenv("DIALOG_POLICY"))
+	if err != nil {
+		return fmt.Errorf("invalid DIALOG_POLICY: %w", err)
+	}
+	b.SetDialogPolicy(dialogPolicy)
+	popupPolicy, err := browser.ParsePopupPolicy(os.Getenv("POPUP_POLICY"))
+	if err != nil {
+		return fmt.Errorf("invalid POPUP_POLICY: %w", err)
+	}
+	b.SetPopupPolicy(popupPolicy)
+	b.SetGrantedPermissions(List("GRANT_PERMISSIONS"))
+	networkProfile, err := browser.ResolveNetworkProfile(os.Getenv("NETWORK_PROFILE"), os.Getenv("NETWORK_PROFILE_FILE"))
+	if err != nil {
+		return fmt.Errorf("invalid network profile: %w", err)
+	}
+	if err := b.SetNetworkProfile(networkProfile); err != nil {
+		return fmt.Errorf("invalid network profile: %w", err)
+	}
+	return nil
+}
+
+// URLPolicy reads the global URL rules from URL_ALLOW, URL_DENY and URL_SCHEMES.
+func URLPolicy() urlpolicy.Policy {
+	return urlpolicy.Policy{
+		Allow:   List("URL_ALLOW"),
+		Deny:    List("URL_DENY"),
+		Schemes: List("URL_SCHEMES"),
+	}
+}
+
+// FlightRecorder opens the flight recorder (FLIGHT_RECORDER_*), writing every record to index too.
+func FlightRecorder(redactor ports.Redactor, index ports.Recorder) (*logger.FlightRecorder, error) {
+	return logger.New(logger.Options{
+		Path:     os.Getenv("FLIGHT_RECORDER_PATH"),
+		MaxBytes: Megabytes("FLIGHT_RECORDER_MAX_MB"),
+		MaxAge:   Duration("FLIGHT_RECORDER_MAX_AGE", 0),
+		MaxFiles: Int("FLIGHT_RECORDER_MAX_FILES", 0),
+		Compress: os.Getenv("FLIGHT_RECORDER_COMPRESS") == "true",
+		Redactor: redactor,
+		Index:    index,
+	})
+}
+
+// Broker creates the human-in-the-loop broker with the APPROVAL_TIMEOUT,
+// QUESTION_TIMEOUT and PLAN_REVIEW_TIMEOUT timeouts.
+func Broker() *hitl.Broker {
+	broker := hitl.NewBroker(Duration("APPROVAL_TIMEOUT", hitl.DefaultTimeout))
+	broker.SetTimeout("question", Duration("QUESTION_TIMEOUT", hitl.DefaultQuestionTimeout))
+	broker.SetTimeout("plan", Duration("PLAN_REVIEW_TIMEOUT", hitl.DefaultQuestionTimeout))
+	return broker
+}
+
+// Agent is what AgentOptions set up: the options for agent.NewAgent, and the stores
+// it opened on the way, which the binaries also use.
+type Agent struct {
+	Options []agent.Option
+	Secrets *vault.Vault       // The secrets vault (VAULT_PATH)
+	Usage   *sqlite.UsageStore // Token usage and cost of every task
+}
+
+// AgentOptions reads the agent's settings: approvals, secrets, budgets, the model and
+// its cache, limits, retries, the context window and planning. approvals answers
+// questions, approvals and plan reviews; recorder gets every flight record.
+func AgentOptions(approvals *hitl.Broker, recorder ports.Recorder, redactor ports.Redactor, dbPath string) (*Agent, error) {
+	// Budgets first: a typo in one must stop Kortex before it opens anything
+	budget, err := Budget()
+	if err != nil {
+		return nil, err
+	}
+	opts := []agent.Option{agent.WithAsker(approvals), agent.WithRecorder(recorder)}
+	if os.Getenv("REDACT_SNAPSHOTS") == "true" {
+		opts = append(opts, agent.WithPageRedactor(redactor))
+	}
+
+	// Secrets vault: credentials are typed as {{secret:site.key}} and never reach the model.
+	secrets, err := vault.Open(os.Getenv("VAULT_PATH"), os.Getenv("VAULT_PASSPHRASE"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open secrets vault: %w", err)
+	}
+	// Secrets are only typed on their own site; aliases add hosts for sites like "bank"
+	aliases := map[string][]string{}
+	for _, pair := range List("VAULT_SITE_ALIASES") {
+		site, host, ok := strings.Cut(pair, ":")
+		if site, host = strings.TrimSpace(site), strings.TrimSpace(host); !ok || site == "" || host == "" {
+			log.Printf("Invalid VAULT_SITE_ALIASES entry '%s', expected site:host", pair)
+			continue
+		}
+		aliases[site] = append(aliases[site], host)
+	}
+	secrets.SetAliases(aliases)
+	opts = append(opts, agent.WithSecrets(secrets), agent.WithOTP(secrets))
+	if requireApproval := os.Getenv("REQUIRE_APPROVAL"); requireApproval == "" || requireApproval == "true" {
+		opts = append(opts, agent.WithApprover(approvals))
+	}
+
+	// Token accounting: every task's usage and cost is saved, and budgets stop runaway tasks
+	usage, err := sqlite.NewUsageStore(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage store: %w", err)
+	}
+	opts = append(opts, agent.WithUsageStore(usage), agent.WithBudget(budget))
+	if input, output := Float("MODEL_PRICE_INPUT_PER_M"), Float("MODEL_PRICE_OUTPUT_PER_M"); input > 0 || output > 0 {
+		opts = append(opts, agent.WithPricing(agent.Pricing{InputPerMillion: input, OutputPerMillion: output}))
+	}
+
+	// Model (The Brain's engine): Gemini by default, or any OpenAI-compatible server
+	opts = append(opts,
+		agent.WithProvider(&llm.OpenAI{BaseURL: os.Getenv("OPENAI_BASE_URL"), APIKey: os.Getenv("OPENAI_API_KEY")}),
+		agent.WithModelConfig(Model()),
+	)
+	// Cache: record model responses once, then replay them offline while iterating
+	if mode := os.Getenv("LLM_CACHE"); mode != "" && mode != llm.CacheOff {
+		cache, err := llm.NewCache(mode, os.Getenv("LLM_CACHE_DIR"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid LLM_CACHE: %w", err)
+		}
+		opts = append(opts, agent.WithModelCache(cache))
+	}
+
+	// Limits stop a confused agent from looping forever (0 switches a limit off)
+	opts = append(opts, agent.WithLimits(agent.Limits{
+		MaxToolCalls: Int("MAX_TOOL_CALLS", agent.DefaultLimits.MaxToolCalls),
+		Timeout:      Duration("TASK_TIMEOUT", agent.DefaultLimits.Timeout),
+		RepeatLimit:  Int("LOOP_REPEAT_LIMIT", agent.DefaultLimits.RepeatLimit),
+		OnLoop:       os.Getenv("LOOP_ACTION"),
+	}))
+	// Retries, fallback models and a circuit breaker ride out rate limits and outages
+	retry := agent.RetryPolicy{
+		MaxRetries:       Int("LLM_MAX_RETRIES", agent.DefaultRetryPolicy.MaxRetries),
+		BaseDelay:        agent.DefaultRetryPolicy.BaseDelay,
+		MaxDelay:         Duration("LLM_RETRY_MAX_DELAY", agent.DefaultRetryPolicy.MaxDelay),
+		BreakerThreshold: Int("LLM_BREAKER_THRESHOLD", agent.DefaultRetryPolicy.BreakerThreshold),
+		BreakerCooldown:  Duration("LLM_BREAKER_COOLDOWN", agent.DefaultRetryPolicy.BreakerCooldown),
+	}
+	for _, name := range List("LLM_FALLBACK_MODELS") {
+		retry.Fallbacks = append(retry.Fallbacks, llm.ParseModel(name))
+	}
+	opts = append(opts, agent.WithRetryPolicy(retry))
+	// Context window: old snapshots are shortened and old steps summarized, so long tasks fit
+	opts = append(opts, agent.WithContextPolicy(agent.ContextPolicy{
+		KeepSnapshots:  Int("CONTEXT_KEEP_SNAPSHOTS", agent.DefaultContextPolicy.KeepSnapshots),
+		SummarizeAfter: Int("CONTEXT_SUMMARIZE_AFTER", agent.DefaultContextPolicy.SummarizeAfter),
+		KeepRecent:     Int("CONTEXT_KEEP_RECENT", agent.DefaultContextPolicy.KeepRecent),
+		MaxTokens:      Int("CONTEXT_MAX_TOKENS", agent.DefaultContextPolicy.MaxTokens),
+	}))
+	// Planner–executor mode: write a plan first, let the user edit it, then work through it
+	if os.Getenv("PLAN_MODE") == "true" {
+		opts = append(opts, agent.WithPlanning(approvals))
+	}
+	return &Agent{Options: opts, Secrets: secrets, Usage: usage}, nil
+}
+
+// Model reads the default model from LLM_PROVIDER, LLM_MODEL, LLM_TEMPERATURE and LLM_MAX_TOKENS.
+func Model() domain.ModelConfig {
+	cfg := domain.ModelConfig{
+		Provider:  os.Getenv("LLM_PROVIDER"),
+		Model:     os.Getenv("LLM_MODEL"),
+		MaxTokens: int32(Int("LLM_MAX_TOKENS", 0)),
+	}
+	if os.Getenv("LLM_TEMPERATURE") != "" {
+		temperature := float32(Float("LLM_TEMPERATURE"))
+		cfg.Temperature = &temperature
+	}
+	if cfg.Provider != "" && cfg.Provider != llm.ProviderGemini && cfg.Model == "" {
+		log.Printf("LLM_PROVIDER is %s but LLM_MODEL is not set", cfg.Provider)
+	}
+	return cfg
+}
+
+// Duration reads a duration like "90s" or "2m" from an env var, falling back to def.
+func Duration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s value '%s', defaulting to %s", name, value, def)
+		return def
+	}
+	return d
+}
+
+// Megabytes reads a size in megabytes from the environment and returns it in bytes (0 if unset).
+func Megabytes(name string) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	mb, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || mb < 0 {
+		log.Printf("Invalid %s value '%s', ignoring it", name, value)
+		return 0
+	}
+	return mb << 20
+}
+
+// Int reads a whole number from the environment, falling back to def.
+func Int(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Invalid %s value '%s', defaulting to %d", name, value, def)
+		return def
+	}
+	return n
+}
+
+// Float reads a non-negative number (like a dollar amount) from the environment; 0 if unset or invalid.
+func Float(name string) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		log.Printf("Invalid %s value '%s', ignoring it", name, value)
+		return 0
+	}
+	return f
+}
+
+// Budget reads the task and daily budgets (BUDGET_*; unset or 0 means no limit).
+// Unlike the other settings, a budget that is set but can't be read is an error:
+// quietly ignoring it would mean spending without a limit.
+func Budget() (domain.Budget, error) {
+	var budget domain.Budget
+	var err error
+	if budget.TaskTokens, err = strictInt("BUDGET_TASK_TOKENS"); err != nil {
+		return budget, err
+	}
+	if budget.TaskUSD, err = strictFloat("BUDGET_TASK_USD"); err != nil {
+		return budget, err
+	}
+	if budget.DailyTokens, err = strictInt("BUDGET_DAILY_TOKENS"); err != nil {
+		return budget, err
+	}
+	if budget.DailyUSD, err = strictFloat("BUDGET_DAILY_USD"); err != nil {
+		return budget, err
+	}
+	return budget, nil
+}
+
+// strictInt reads a whole number like Int, but an invalid value is an error (0 if unset).
+func strictInt(name string) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s value '%s': expected a whole number, 0 or more", name, value)
+	}
+	return n, nil
+}
+
+// strictFloat reads a number like Float, but an invalid value is an error (0 if unset).
+func strictFloat(name string) (float64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid %s value '%s': expected a number, 0 or more", name, value)
+	}
+	return f, nil
+}
+
+// List reads a comma-separated env value like "geolocation, notifications" into a slice.
+func List(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
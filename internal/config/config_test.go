@@ -0,0 +1,74 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnvHelpers(t *testing.T) {
+	t.Setenv("KORTEX_TEST_INT", "7")
+	t.Setenv("KORTEX_TEST_BAD_INT", "-1")
+	t.Setenv("KORTEX_TEST_DURATION", "90s")
+	t.Setenv("KORTEX_TEST_MB", "2")
+	t.Setenv("KORTEX_TEST_LIST", " geolocation, ,notifications ")
+
+	if got := Int("KORTEX_TEST_INT", 3); got != 7 {
+		t.Errorf("Int = %d, want 7", got)
+	}
+	if got := Int("KORTEX_TEST_BAD_INT", 3); got != 3 {
+		t.Errorf("A negative number should fall back to the default, got %d", got)
+	}
+	if got := Duration("KORTEX_TEST_DURATION", time.Minute); got != 90*time.Second {
+		t.Errorf("Duration = %s, want 90s", got)
+	}
+	if got := Megabytes("KORTEX_TEST_MB"); got != 2<<20 {
+		t.Errorf("Megabytes = %d, want %d", got, 2<<20)
+	}
+	if got := List("KORTEX_TEST_LIST"); len(got) != 2 || got[0] != "geolocation" || got[1] != "notifications" {
+		t.Errorf("List = %q", got)
+	}
+}
+
+func TestAgentOptions(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("VAULT_PATH", filepath.Join(dir, "vault.json"))
+	t.Setenv("VAULT_PASSPHRASE", "test passphrase")
+	t.Setenv("LLM_FALLBACK_MODELS", "gemini-2.5-flash")
+	t.Setenv("PLAN_MODE", "true")
+
+	setup, err := AgentOptions(Broker(), nil, nil, filepath.Join(dir, "kortex.db"))
+	if err != nil {
+		t.Fatalf("AgentOptions failed: %v", err)
+	}
+	if setup.Secrets == nil || setup.Usage == nil || len(setup.Options) == 0 {
+		t.Errorf("Expected the vault, the usage store and options, got %+v", setup)
+	}
+}
+
+func TestInvalidBudgetStopsStartup(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("VAULT_PATH", filepath.Join(dir, "vault.json"))
+	t.Setenv("VAULT_PASSPHRASE", "test passphrase")
+
+	for name, value := range map[string]string{
+		"BUDGET_TASK_USD":     "$5",
+		"BUDGET_DAILY_USD":    "-1",
+		"BUDGET_TASK_TOKENS":  "10k",
+		"BUDGET_DAILY_TOKENS": "1.5",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := AgentOptions(Broker(), nil, nil, filepath.Join(dir, "kortex.db")); err == nil {
+				t.Errorf("Expected %s=%s to stop startup, not to mean no limit", name, value)
+			}
+		})
+	}
+
+	t.Setenv("BUDGET_TASK_USD", "2.50")
+	t.Setenv("BUDGET_DAILY_TOKENS", "100000")
+	budget, err := Budget()
+	if err != nil || budget.TaskUSD != 2.5 || budget.DailyTokens != 100000 || budget.TaskTokens != 0 {
+		t.Errorf("Budget() = %+v, %v", budget, err)
+	}
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -67,3 +68,178 @@ func (mf *MemoryFragment) BeforeCreate(tx *gorm.DB) (err error) {
 	}
 	return
 }
+
+// PageChunk is one slice of a page's main content, converted to Markdown.
+// Long articles don't fit in a single tool result, so the agent reads them
+// piece by piece, like turning the pages of a book.
+type PageChunk struct {
+	Title      string `json:"title"`       // The page title
+	URL        string `json:"url"`         // Where the content came from
+	Markdown   string `json:"markdown"`    // The readable text for this chunk
+	Offset     int    `json:"offset"`      // Character offset where this chunk starts
+	NextOffset int    `json:"next_offset"` // Offset to pass to read the next chunk (0 when done)
+	Total      int    `json:"total"`       // Total length of the extracted Markdown
+}
+
+// PageError is a problem the browser noticed while the agent was working on a page:
+// a JavaScript error, a console error/warning, or a network request that failed or was slow.
+// These explain "why did my click do nothing?" moments.
+type PageError struct {
+	Seq        int64     `json:"seq"`                   // Increasing number so callers can tell which errors are new
+	Kind       string    `json:"kind"`                  // "console", "pageerror", "request_failed", "http_error", "slow_request" or "policy"
+	Message    string    `json:"message"`               // Human readable description
+	URL        string    `json:"url,omitempty"`         // The page or request URL involved
+	Status     int       `json:"status,omitempty"`      // HTTP status code for http_error
+	DurationMs float64   `json:"duration_ms,omitempty"` // How long the request took, for slow_request
+	Time       time.Time `json:"time"`                  // When it happened
+}
+
+// HumanRequest is something the agent needs from the person watching it:
+// permission to do something risky, or an answer to a question.
+// It is pushed to the desktop app or WebSocket client and waits for a HumanResponse.
+type HumanRequest struct {
+	ID        string         `json:"id"`               // Used to match the answer to the request
+	Kind      string         `json:"kind"`             // "approval", "question" or "plan"
+	Tool      string         `json:"tool,omitempty"`   // The tool the agent wants to run
+	Args      map[string]any `json:"args,omitempty"`   // The arguments it wants to run it with
+	Message   string         `json:"message"`          // What we show the user, e.g. "Click 'Place order'" or the question
+	Reason    string         `json:"reason,omitempty"` // Why this needs a human, e.g. "purchase button"
+	Plan      *Plan          `json:"plan,omitempty"`   // For "plan" requests: the plan to review
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// HumanResponse is the user's answer to a HumanRequest.
+type HumanResponse struct {
+	ID       string `json:"id"`
+	Kind     string `json:"kind"`             // The request's Kind; an answer to another kind of request is refused
+	Approved bool   `json:"approved"`         // For approvals: may the action go ahead?
+	Answer   string `json:"answer,omitempty"` // For questions: what the user typed
+	Plan     *Plan  `json:"plan,omitempty"`   // For plans: the user's edited version (nil = unchanged)
+}
+
+// Plan is the agent's numbered list of steps for a goal, written before it starts
+// (planner–executor mode). The user can edit it first; the agent then ticks steps
+// off as it goes, and writes a new version when a step fails.
+type Plan struct {
+	Goal    string     `json:"goal"`
+	Version int        `json:"version"` // 1 for the first plan, +1 for every replan
+	Steps   []PlanStep `json:"steps"`
+}
+
+// PlanStep is one step of a Plan.
+type PlanStep struct {
+	Number      int    `json:"number"` // 1, 2, 3...
+	Description string `json:"description"`
+	Status      string `json:"status"`         // "pending", "in_progress", "done", "failed" or "skipped"
+	Note        string `json:"note,omitempty"` // What the agent reported, e.g. why the step failed
+}
+
+// ErrDialogOpen is returned (wrapped) by browser actions while a JavaScript dialog
+// (alert, confirm, prompt) blocks the page. The agent has to handle the dialog first.
+var ErrDialogOpen = errors.New("a dialog is open")
+
+// ElementInfo describes a single element on the page, enough to judge what clicking
+// or typing into it would do (e.g. is this a "Buy now" button or a password field?).
+type ElementInfo struct {
+	Tag       string `json:"tag"`                  // e.g. "button", "input"
+	Role      string `json:"role"`                 // ARIA role or tag name
+	Name      string `json:"name"`                 // Visible text or label
+	InputType string `json:"input_type,omitempty"` // For <input>: "text", "password", ...
+}
+
+// SecretRef names a credential in the secrets vault without revealing it.
+// The agent refers to it as {{secret:Site.Key}}, e.g. {{secret:github.com.password}}.
+type SecretRef struct {
+	Site string `json:"site"`
+	Key  string `json:"key"`
+}
+
+// FlightRecord is one line in the flight recorder: something the agent did during a task.
+// Records of one task share a TaskID and are numbered by Step, so a run can be read back,
+// searched or replayed later.
+type FlightRecord struct {
+	Time       time.Time   `json:"time"`
+	TaskID     string      `json:"task_id,omitempty"`
+	SessionID  string      `json:"session_id,omitempty"`
+	TraceID    string      `json:"trace_id,omitempty"`    // OpenTelemetry trace of the task, if tracing is on
+	Step       int         `json:"step,omitempty"`        // 1 for the first tool call, 2 for the next...
+	Kind       string      `json:"kind"`                  // "task_start", "task_end", "tool", "model", "approval", "page_errors", "thought", "limit", "retry", "fallback", "circuit_open", "compaction", "plan"
+	Tool       string      `json:"tool,omitempty"`        // For "tool" and "approval" records
+	Args       any         `json:"args,omitempty"`        // What the tool was called with
+	Result     any         `json:"result,omitempty"`      // What it returned
+	Error      string      `json:"error,omitempty"`       // Why it failed, if it did
+	DurationMs int64       `json:"duration_ms,omitempty"` // How long the step took
+	Usage      *TokenUsage `json:"usage,omitempty"`       // Tokens used, for "model" records
+	Details    any         `json:"details,omitempty"`     // Anything else worth keeping
+}
+
+// TaskUsage is what a task cost: tokens and dollars summed over all its model calls.
+// It is saved after every model call, so a crash mid-task still counts towards the daily budget.
+type TaskUsage struct {
+	TaskID           string    `gorm:"primaryKey" json:"task_id"`
+	SessionID        string    `gorm:"index" json:"session_id"`
+	Model            string    `json:"model"`
+	ModelCalls       int       `json:"model_calls"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	CostUSD          float64   `json:"cost_usd"`
+	StartedAt        time.Time `gorm:"index" json:"started_at"` // UTC, for daily totals
+}
+
+// Budget caps what tasks may spend. Zero means no limit.
+// When a limit is hit the agent is stopped before its next model call.
+type Budget struct {
+	TaskTokens  int     `json:"task_tokens,omitempty"`
+	TaskUSD     float64 `json:"task_usd,omitempty"`
+	DailyTokens int     `json:"daily_tokens,omitempty"` // Across all tasks since local midnight
+	DailyUSD    float64 `json:"daily_usd,omitempty"`
+}
+
+// ModelConfig picks the model that drives a task. Empty fields fall back to the
+// agent's defaults, so a task can override just the model name, say.
+type ModelConfig struct {
+	Provider    string   `json:"provider,omitempty"`    // "gemini" or "openai" (any OpenAI-compatible server)
+	Model       string   `json:"model,omitempty"`       // e.g. "gemini-3-pro-preview", "llama3.1"
+	Temperature *float32 `json:"temperature,omitempty"` // nil = the model's default
+	MaxTokens   int32    `json:"max_tokens,omitempty"`  // Per response; 0 = the model's default
+}
+
+// TaskResult is what ExecuteTask reports back once a task is over.
+type TaskResult struct {
+	TaskID    string    `json:"task_id"`
+	SessionID string    `json:"session_id"`
+	Outcome   string    `json:"outcome"` // "completed", "failed", "cancelled", "budget_exceeded", "max_tool_calls", "timeout" or "stuck"
+	Usage     TaskUsage `json:"usage"`
+	Plan      *Plan     `json:"plan,omitempty"` // The final plan, in planner–executor mode
+}
+
+// RecordQuery filters flight records when searching the recorder index.
+// Empty fields match everything.
+type RecordQuery struct {
+	TaskID     string    `json:"task_id,omitempty"`
+	SessionID  string    `json:"session_id,omitempty"`
+	Kind       string    `json:"kind,omitempty"`
+	Tool       string    `json:"tool,omitempty"`
+	ErrorsOnly bool      `json:"errors_only,omitempty"` // Only records with an Error
+	Since      time.Time `json:"since,omitempty"`
+	Until      time.Time `json:"until,omitempty"`
+	Limit      int       `json:"limit,omitempty"` // Newest first; 0 = a sensible default
+}
+
+// TaskSummary is one line in the list of past tasks.
+type TaskSummary struct {
+	TaskID    string    `json:"task_id"`
+	Goal      string    `json:"goal,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Steps     int       `json:"steps"`           // Tool calls made
+	Done      bool      `json:"done"`            // False while running (or if Kortex crashed mid-task)
+	Error     string    `json:"error,omitempty"` // Why the task failed, if it did
+}
+
+// TokenUsage counts the tokens a model call consumed.
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
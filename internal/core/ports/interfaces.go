@@ -2,22 +2,32 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"google.golang.org/adk/model"
 )
 
 // AIProvider defines the contract for any AI service (like Gemini, GPT-4, etc.).
 // By using an interface, we can easily switch AI models without changing the core logic.
+// A provider hands out ADK models, so the agent's ReAct loop works the same with any of them.
 type AIProvider interface {
-	// GenerateStream sends the chat history to the AI and gets a stream of text back.
-	// It also provides a list of tools the AI can use.
-	GenerateStream(ctx context.Context, history []domain.Message, tools []interface{}) (<-chan string, error)
+	// Name is what configuration uses to pick the provider (e.g. "gemini", "openai").
+	Name() string
+
+	// NewModel creates the model named in cfg. Temperature and max tokens are sent
+	// with every request, so the model doesn't need to remember them.
+	NewModel(ctx context.Context, cfg domain.ModelConfig) (model.LLM, error)
+
+	// Check reports missing configuration (like an API key) without calling the model.
+	Check() error
 }
 
 // VectorStore defines how Kortex remembers things.
 // It's an interface for a database that can search by "meaning" (vectors) rather than just keywords.
 type VectorStore interface {
-	// Save stores a new memory fragment.
+	// Save stores a new memory fragment. With redaction on, compute the Embedding
+	// from the redacted content, so the vector never encodes personal data.
 	Save(ctx context.Context, fragment *domain.MemoryFragment) error
 
 	// Search finds the most relevant memories for a given query vector.
@@ -36,6 +46,10 @@ type Browser interface {
 	// This is what the AI "sees" - a tree of elements, roles, and names.
 	GetSnapshot() (string, error)
 
+	// ReadPage extracts the main readable content of the page (like "Reader Mode")
+	// as Markdown. Long pages are split into chunks; 'offset' selects which one.
+	ReadPage(offset int) (*domain.PageChunk, error)
+
 	// Highlight draws a visual box around an element to show the user what Kortex is looking at.
 	Highlight(selector, message string) error
 
@@ -44,4 +58,94 @@ type Browser interface {
 
 	// Type simulates typing text into an input field.
 	Type(selector, text string) error
+
+	// HandleDialog accepts or dismisses the JavaScript dialog (alert, confirm, prompt) that is open.
+	// promptText is only used when accepting a prompt() dialog.
+	HandleDialog(accept bool, promptText string) error
+
+	// GetPageErrors returns the console errors, JavaScript exceptions and failed or slow
+	// network requests recorded on the current page (oldest first).
+	GetPageErrors() ([]domain.PageError, error)
+
+	// DescribeElement returns the role, name and input type of the element matching the selector.
+	DescribeElement(selector string) (*domain.ElementInfo, error)
+
+	// CurrentURL returns the address of the page the agent is on.
+	CurrentURL() (string, error)
+}
+
+// Approver puts a human in the loop for sensitive actions.
+// Whoever implements it (desktop app, WebSocket client) shows the request to the user
+// and blocks until they answer, the context is cancelled, or a timeout passes.
+type Approver interface {
+	// RequestApproval returns true if the user allowed the action.
+	RequestApproval(ctx context.Context, req domain.HumanRequest) (bool, error)
+}
+
+// Asker lets the agent ask the user a clarifying question in the middle of a task
+// ("Which hotel is 'the usual' one?") instead of guessing.
+type Asker interface {
+	// AskUser blocks until the user answers and returns their answer.
+	AskUser(ctx context.Context, req domain.HumanRequest) (string, error)
+}
+
+// PlanReviewer shows the agent's plan to the user before any step is carried out.
+// The user may edit the steps, or reject the plan, which cancels the task.
+type PlanReviewer interface {
+	// ReviewPlan returns the plan to carry out (the user's edits, if any) and whether the user approved it.
+	ReviewPlan(ctx context.Context, req domain.HumanRequest) (domain.Plan, bool, error)
+}
+
+// SecretStore keeps credentials out of prompts and logs.
+// The agent only ever sees placeholders like {{secret:github.com.password}};
+// the real value is swapped in right before it is typed into the page.
+type SecretStore interface {
+	// Resolve replaces every placeholder in text with the stored value. host is the page
+	// the text is for; placeholders belonging to another site are refused.
+	Resolve(text, host string) (string, error)
+	// List names the available secrets (never their values), so the agent knows what it can use.
+	List() []domain.SecretRef
+}
+
+// OTPGenerator produces one-time codes for two-factor logins from stored TOTP seeds.
+type OTPGenerator interface {
+	// OTPFor returns the current code for a site, or an error if no seed is stored for it
+	// or host (the page the code is for) isn't on that site.
+	OTPFor(site, host string) (string, error)
+}
+
+// Redactor scrubs personal data (emails, phone numbers, card numbers, API keys...)
+// before it is written to logs or memory, or shown to the model.
+type Redactor interface {
+	// Redact replaces sensitive data in text with markers like "[REDACTED:email]".
+	Redact(text string) string
+	// RedactValue does the same for every string inside a struct, map or slice.
+	RedactValue(v interface{}) interface{}
+}
+
+// Recorder is the flight recorder: the black box that writes down every step of every task.
+type Recorder interface {
+	Record(ctx context.Context, rec domain.FlightRecord) error
+}
+
+// RecordIndex is a searchable copy of the flight recorder, so past tasks can be
+// browsed and filtered without grepping through JSONL files.
+type RecordIndex interface {
+	Recorder
+	// Timeline returns every record of one task, in the order they happened.
+	Timeline(ctx context.Context, taskID string) ([]domain.FlightRecord, error)
+	// Search finds records matching the query, newest first.
+	Search(ctx context.Context, query domain.RecordQuery) ([]domain.FlightRecord, error)
+	// Tasks lists the most recent tasks, newest first.
+	Tasks(ctx context.Context, limit int) ([]domain.TaskSummary, error)
+}
+
+// UsageStore keeps what each task cost, so spending can be totalled per session and per day.
+type UsageStore interface {
+	// SaveUsage creates or updates the usage of one task.
+	SaveUsage(ctx context.Context, usage domain.TaskUsage) error
+	// UsageSince totals every task started at or after since.
+	UsageSince(ctx context.Context, since time.Time) (domain.TaskUsage, error)
+	// SessionUsage totals every task of one session.
+	SessionUsage(ctx context.Context, sessionID string) (domain.TaskUsage, error)
 }
@@ -3,21 +3,42 @@ package browser
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
 	"github.com/playwright-community/playwright-go"
 )
 
 // PlaywrightBrowser implements the Browser interface using Microsoft Playwright.
 // Playwright is a tool that lets code control a web browser (Chrome, Firefox, etc.).
 type PlaywrightBrowser struct {
-	pw      *playwright.Playwright // The main Playwright instance
-	browser playwright.Browser     // The browser application (e.g., Chromium)
-	page    playwright.Page        // The specific tab or window we are controlling
+	pw      *playwright.Playwright    // The main Playwright instance
+	browser playwright.Browser        // The browser application (e.g., Chromium)
+	context playwright.BrowserContext // An isolated browser profile (cookies, cache, HAR recording)
+	page    playwright.Page           // The tab we are controlling; popups can swap it, so read it with activePage
+
+	mu                 sync.Mutex                            // Guards the fields below, which Playwright event handlers touch
+	dialogPolicy       DialogPolicy                          // What to do when the page opens alert/confirm/prompt
+	popupPolicy        PopupPolicy                           // What to do when the page opens a new tab or popup window
+	grantedPermissions []string                              // Browser permissions sites may use (everything else is denied)
+	pendingDialogs     map[playwright.Page]playwright.Dialog // Dialogs waiting for the agent to decide, per tab (manual policy)
+	events             []string                              // Things that happened since the last snapshot (dialogs, permission requests)
+	pageErrors         []domain.PageError                    // Console errors and failed/slow requests on the current page
+	errorSeq           int64                                 // Sequence number of the last recorded page error
+	slowRequest        time.Duration                         // Requests slower than this are reported as slow
+	network            *networkRules                         // Block/rewrite/mock rules applied to every request
+	requestFilter      func(string) error                    // Safety check run on every request (e.g. URL policy)
+	replaying          bool                                  // The context serves a HAR file instead of the network
 }
 
 // NewPlaywrightBrowser creates a new instance of our browser adapter.
 func NewPlaywrightBrowser() *PlaywrightBrowser {
-	return &PlaywrightBrowser{}
+	return &PlaywrightBrowser{
+		dialogPolicy: DialogManual,
+		popupPolicy:  PopupSwitch,
+		slowRequest:  DefaultSlowRequestThreshold,
+	}
 }
 
 // Init starts the browser.
@@ -39,37 +60,159 @@ func (pb *PlaywrightBrowser) Init(headless bool) error {
 	}
 	pb.browser = browser
 
+	return pb.openContext(playwright.BrowserNewContextOptions{})
+}
+
+// openContext creates a fresh browser context with one tab and wires up all our page handlers.
+// Any previous context is closed first (which is also what flushes a HAR recording to disk).
+// setup, if given, runs on the new context before our own routes are installed; Playwright
+// tries the newest route first, so ours get first look and fall back to the ones it adds.
+func (pb *PlaywrightBrowser) openContext(options playwright.BrowserNewContextOptions, setup ...func(playwright.BrowserContext) error) error {
+	if err := pb.closeContext(); err != nil {
+		return err
+	}
+
+	// Requests made by service workers skip routing, and with it the request filter
+	if options.ServiceWorkers == nil {
+		options.ServiceWorkers = playwright.ServiceWorkerPolicyBlock
+	}
+	context, err := pb.browser.NewContext(options)
+	if err != nil {
+		return fmt.Errorf("could not create browser context: %v", err)
+	}
+	for _, fn := range setup {
+		if err := fn(context); err != nil {
+			context.Close()
+			return err
+		}
+	}
+	if err := pb.setupNetwork(context); err != nil {
+		context.Close()
+		return err
+	}
+
 	// Open a new tab
-	page, err := browser.NewPage()
+	page, err := context.NewPage()
 	if err != nil {
 		return fmt.Errorf("could not create page: %v", err)
 	}
+	if err := pb.setupDialogs(page); err != nil {
+		return err
+	}
+	pb.setupDiagnostics(page)
+
+	pb.mu.Lock()
+	pb.context = context
 	pb.page = page
+	pb.mu.Unlock()
+
+	// Links with target="_blank" and window.open() create new pages in this context
+	context.OnPage(pb.onPopup)
+	return nil
+}
 
+// closeContext closes the current browser context, if any.
+func (pb *PlaywrightBrowser) closeContext() error {
+	if pb.context == nil {
+		return nil
+	}
+	err := pb.context.Close()
+	pb.mu.Lock()
+	pb.context = nil
+	pb.page = nil
+	pb.pendingDialogs = nil // Their pages are gone
+	pb.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("could not close browser context: %v", err)
+	}
+	return nil
+}
+
+// activePage returns the tab the agent is currently working in (nil before Init).
+func (pb *PlaywrightBrowser) activePage() playwright.Page {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	return pb.page
+}
+
+// Close shuts down the tab, the browser and Playwright itself.
+func (pb *PlaywrightBrowser) Close() error {
+	if err := pb.closeContext(); err != nil {
+		return err
+	}
+	if pb.browser != nil {
+		if err := pb.browser.Close(); err != nil {
+			return fmt.Errorf("could not close browser: %v", err)
+		}
+		pb.browser = nil
+	}
+	if pb.pw != nil {
+		if err := pb.pw.Stop(); err != nil {
+			return fmt.Errorf("could not stop playwright: %v", err)
+		}
+		pb.pw = nil
+	}
+	return nil
+}
+
+// Ping checks that the browser is still running and has a usable tab.
+// The web server's /health endpoint uses it.
+func (pb *PlaywrightBrowser) Ping() error {
+	page := pb.activePage()
+	if pb.browser == nil || page == nil {
+		return fmt.Errorf("browser not initialized")
+	}
+	if !pb.browser.IsConnected() {
+		return fmt.Errorf("browser process is gone")
+	}
+	if page.IsClosed() {
+		return fmt.Errorf("browser tab was closed")
+	}
 	return nil
 }
 
+// OpenContexts returns how many browser contexts (isolated profiles) are open, for metrics.
+func (pb *PlaywrightBrowser) OpenContexts() int {
+	if pb.browser == nil {
+		return 0
+	}
+	return len(pb.browser.Contexts())
+}
+
 // Navigate tells the browser to go to a specific website.
 func (pb *PlaywrightBrowser) Navigate(url string) error {
-	if pb.page == nil {
+	page := pb.activePage()
+	if page == nil {
 		return fmt.Errorf("browser not initialized")
 	}
+	// A new page means a fresh set of errors
+	pb.clearPageErrors()
 	// Goto waits for the page to load before returning
-	if _, err := pb.page.Goto(url); err != nil {
+	if _, err := page.Goto(url); err != nil {
 		return fmt.Errorf("could not navigate to %s: %v", url, err)
 	}
 	return nil
 }
 
+// CurrentURL returns the address of the page the agent is on.
+func (pb *PlaywrightBrowser) CurrentURL() (string, error) {
+	page := pb.activePage()
+	if page == nil {
+		return "", fmt.Errorf("browser not initialized")
+	}
+	return page.URL(), nil
+}
+
 // Highlight injects JavaScript into the page to draw a colored box around an element.
 // This helps the user see what the agent is focusing on.
 func (pb *PlaywrightBrowser) Highlight(selector, message string) error {
-	if pb.page == nil {
-		return fmt.Errorf("browser not initialized")
+	page, err := pb.scriptablePage()
+	if err != nil {
+		return err
 	}
 
 	// Wait up to 10 seconds for the element to appear
-	_, err := pb.page.WaitForSelector(selector, playwright.PageWaitForSelectorOptions{
+	_, err = page.WaitForSelector(selector, playwright.PageWaitForSelectorOptions{
 		Timeout: playwright.Float(10000),
 	})
 	if err != nil {
@@ -112,7 +255,7 @@ func (pb *PlaywrightBrowser) Highlight(selector, message string) error {
 		}
 	`, selector, message)
 
-	_, err = pb.page.Evaluate(js)
+	_, err = page.Evaluate(js)
 	if err != nil {
 		return fmt.Errorf("failed to inject highlight script: %v", err)
 	}
@@ -122,11 +265,12 @@ func (pb *PlaywrightBrowser) Highlight(selector, message string) error {
 
 // Click simulates a mouse click on an element.
 func (pb *PlaywrightBrowser) Click(selector string) error {
-	if pb.page == nil {
-		return fmt.Errorf("browser not initialized")
+	page, err := pb.scriptablePage()
+	if err != nil {
+		return err
 	}
 
-	err := pb.page.Click(selector, playwright.PageClickOptions{
+	err = page.Click(selector, playwright.PageClickOptions{
 		Timeout: playwright.Float(10000),
 	})
 	if err != nil {
@@ -138,11 +282,12 @@ func (pb *PlaywrightBrowser) Click(selector string) error {
 
 // Type simulates typing text into an input field.
 func (pb *PlaywrightBrowser) Type(selector, text string) error {
-	if pb.page == nil {
-		return fmt.Errorf("browser not initialized")
+	page, err := pb.scriptablePage()
+	if err != nil {
+		return err
 	}
 
-	err := pb.page.Fill(selector, text, playwright.PageFillOptions{
+	err = page.Fill(selector, text, playwright.PageFillOptions{
 		Timeout: playwright.Float(10000),
 	})
 	if err != nil {
@@ -163,11 +308,24 @@ type AccessibilityNode struct {
 
 // GetSnapshot scans the page and returns a JSON tree of interactive elements.
 // This is crucial because raw HTML is too messy for the AI to process efficiently.
+// Dialogs and permission requests seen since the last snapshot are listed under "notices".
 func (pb *PlaywrightBrowser) GetSnapshot() (string, error) {
-	if pb.page == nil {
+	page := pb.activePage()
+	if page == nil {
 		return "", fmt.Errorf("browser not initialized")
 	}
 
+	// While a dialog is open the page's JavaScript is frozen, so we can't scan it.
+	// Report the dialog instead so the agent knows to deal with it first.
+	notices, blocked := pb.takeNotices()
+	if blocked {
+		bytes, err := json.MarshalIndent(map[string]interface{}{"notices": notices}, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal snapshot: %v", err)
+		}
+		return string(bytes), nil
+	}
+
 	// Inject JS to traverse DOM and build simplified tree
 	// This script generates a unique selector for each element and extracts role/name
 	js := `
@@ -190,6 +348,10 @@ func (pb *PlaywrightBrowser) GetSnapshot() (string, error) {
 			}
 
 			function getName(el) {
+				// Never expose what's typed into a password field, only its label
+				if (el.tagName === 'INPUT' && el.type === 'password') {
+					return el.getAttribute('aria-label') || el.getAttribute('placeholder') || 'password';
+				}
 				return el.getAttribute('aria-label') || el.innerText || '';
 			}
 
@@ -223,9 +385,13 @@ func (pb *PlaywrightBrowser) GetSnapshot() (string, error) {
 		})()
 	`
 
-	result, err := pb.page.Evaluate(js)
+	result, err := page.Evaluate(js)
 	if err != nil {
-		return fmt.Errorf("failed to evaluate snapshot script: %v", err)
+		return "", fmt.Errorf("failed to evaluate snapshot script: %v", err)
+	}
+
+	if len(notices) > 0 {
+		result = map[string]interface{}{"notices": notices, "page": result}
 	}
 
 	// Convert the result to a pretty-printed JSON string
@@ -236,3 +402,42 @@ func (pb *PlaywrightBrowser) GetSnapshot() (string, error) {
 
 	return string(bytes), nil
 }
+
+// DescribeElement returns what kind of element a selector points at.
+// The agent uses this to spot risky actions, like clicking "Buy now" or typing into a password field.
+func (pb *PlaywrightBrowser) DescribeElement(selector string) (*domain.ElementInfo, error) {
+	page, err := pb.scriptablePage()
+	if err != nil {
+		return nil, err
+	}
+
+	// A locator understands the same selectors as Click and Type (xpath=, text=, role=, >> chains...),
+	// so the element described is the one the action will hit. document.querySelector only knows CSS.
+	result, err := page.Locator(selector).First().Evaluate(`(el) => {
+		const value = el.type === 'password' ? '' : el.value; // Password values stay on the page
+		const name = el.getAttribute('aria-label') || el.innerText || value || el.getAttribute('title') || '';
+		return {
+			tag: el.tagName.toLowerCase(),
+			role: el.getAttribute('role') || el.tagName.toLowerCase(),
+			name: name.substring(0, 100).replace(/\s+/g, ' ').trim(),
+			input_type: el.tagName === 'INPUT' ? (el.getAttribute('type') || 'text').toLowerCase() : ''
+		};
+	}`, nil, playwright.LocatorEvaluateOptions{Timeout: playwright.Float(10000)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe %s: %v", selector, err)
+	}
+	if result == nil {
+		return nil, fmt.Errorf("element not found: %s", selector)
+	}
+
+	// Round-trip through JSON to turn the generic map into our struct
+	bytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal element info: %v", err)
+	}
+	var info domain.ElementInfo
+	if err := json.Unmarshal(bytes, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse element info: %v", err)
+	}
+	return &info, nil
+}
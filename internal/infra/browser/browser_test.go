@@ -1,8 +1,16 @@
 package browser
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
 )
 
 func TestPlaywrightBrowser(t *testing.T) {
@@ -17,14 +25,7 @@ func TestPlaywrightBrowser(t *testing.T) {
 		t.Fatalf("Failed to init browser: %v", err)
 	}
 	// Ensure we close the browser/playwright at the end
-	defer func() {
-		if browser.browser != nil {
-			browser.browser.Close()
-		}
-		if browser.pw != nil {
-			browser.pw.Stop()
-		}
-	}()
+	defer browser.Close()
 
 	t.Run("Navigate and Highlight", func(t *testing.T) {
 		// Use a data URL to avoid network dependency and ensure consistent content
@@ -66,4 +67,425 @@ func TestPlaywrightBrowser(t *testing.T) {
 			t.Errorf("Snapshot should contain button, got: %s", snapshot)
 		}
 	})
+	t.Run("Dialogs", func(t *testing.T) {
+		browser.SetDialogPolicy(DialogManual)
+		html := `<html><body><button id="ask" onclick="document.title = confirm('Proceed?') ? 'yes' : 'no'">Ask</button></body></html>`
+		if err := browser.Navigate("data:text/html," + html); err != nil {
+			t.Fatalf("Failed to navigate: %v", err)
+		}
+
+		// Clicking waits for the dialog to close, so do it in the background.
+		go browser.Click("#ask")
+
+		var snapshot string
+		for i := 0; i < 50 && !strings.Contains(snapshot, "Proceed?"); i++ {
+			time.Sleep(100 * time.Millisecond)
+			snapshot, _ = browser.GetSnapshot()
+		}
+		if !strings.Contains(snapshot, "handle_dialog") {
+			t.Fatalf("Snapshot should report the open dialog, got: %s", snapshot)
+		}
+
+		// Anything that runs page JavaScript says so instead of hanging
+		if _, err := browser.ReadPage(0); !errors.Is(err, domain.ErrDialogOpen) {
+			t.Errorf("Expected ReadPage to report the dialog, got %v", err)
+		}
+		if _, err := browser.DescribeElement("#ask"); !errors.Is(err, domain.ErrDialogOpen) {
+			t.Errorf("Expected DescribeElement to report the dialog, got %v", err)
+		}
+		if err := browser.Highlight("#ask", "Here"); !errors.Is(err, domain.ErrDialogOpen) {
+			t.Errorf("Expected Highlight to report the dialog, got %v", err)
+		}
+
+		if err := browser.HandleDialog(true, ""); err != nil {
+			t.Fatalf("Failed to handle dialog: %v", err)
+		}
+		if err := browser.HandleDialog(true, ""); err == nil {
+			t.Error("Expected error when no dialog is open")
+		}
+	})
+
+	t.Run("GetPageErrors", func(t *testing.T) {
+		html := `<html><body><script>console.error('widget failed'); setTimeout(() => { throw new Error('boom'); }, 0);</script></body></html>`
+		if err := browser.Navigate("data:text/html," + html); err != nil {
+			t.Fatalf("Failed to navigate: %v", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+
+		pageErrors, err := browser.GetPageErrors()
+		if err != nil {
+			t.Fatalf("Failed to get page errors: %v", err)
+		}
+		kinds := map[string]bool{}
+		for _, pe := range pageErrors {
+			kinds[pe.Kind] = true
+		}
+		if !kinds["console"] || !kinds["pageerror"] {
+			t.Errorf("Expected console and pageerror entries, got %+v", pageErrors)
+		}
+	})
+
+	t.Run("Popups", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			if r.URL.Path == "/popup" {
+				w.Write([]byte(`<html><body><h1 id="popup">Sign in</h1><button id="done" onclick="window.close()">Done</button></body></html>`))
+				return
+			}
+			w.Write([]byte(`<html><body><a id="open" href="/popup" target="_blank">Sign in</a></body></html>`))
+		}))
+		defer server.Close()
+
+		waitFor := func(want string) string {
+			var snapshot string
+			for i := 0; i < 50 && !strings.Contains(snapshot, want); i++ {
+				time.Sleep(100 * time.Millisecond)
+				snapshot, _ = browser.GetSnapshot()
+			}
+			return snapshot
+		}
+
+		// switch: the agent follows the new tab, and comes back when it closes
+		browser.SetPopupPolicy(PopupSwitch)
+		if err := browser.Navigate(server.URL); err != nil {
+			t.Fatalf("Failed to navigate: %v", err)
+		}
+		if err := browser.Click("#open"); err != nil {
+			t.Fatalf("Failed to click: %v", err)
+		}
+		if snapshot := waitFor("#popup"); !strings.Contains(snapshot, "now working in it") {
+			t.Fatalf("Expected to switch to the popup, got: %s", snapshot)
+		}
+		if err := browser.Click("#done"); err != nil {
+			t.Fatalf("Failed to click: %v", err)
+		}
+		if snapshot := waitFor("#open"); !strings.Contains(snapshot, "back on") {
+			t.Fatalf("Expected to return to the first tab, got: %s", snapshot)
+		}
+
+		// close: the new tab is shut and the agent stays put
+		browser.SetPopupPolicy(PopupClose)
+		if err := browser.Click("#open"); err != nil {
+			t.Fatalf("Failed to click: %v", err)
+		}
+		snapshot := waitFor("closed automatically")
+		if !strings.Contains(snapshot, "closed automatically") || !strings.Contains(snapshot, "#open") {
+			t.Errorf("Expected the popup to be closed, got: %s", snapshot)
+		}
+		browser.SetPopupPolicy(PopupSwitch)
+	})
+
+	t.Run("RequestFilterCoversPopups", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			if r.URL.Path == "/secret" {
+				w.Write([]byte(`<html><body><p>Top secret</p></body></html>`))
+				return
+			}
+			w.Write([]byte(`<html><body><a id="open" href="/secret" target="_blank">Open</a></body></html>`))
+		}))
+		defer server.Close()
+
+		// The filter applies from the next fresh context on
+		browser.SetRequestFilter(func(url string) error {
+			if strings.HasSuffix(url, "/secret") {
+				return fmt.Errorf("%s is denied", url)
+			}
+			return nil
+		})
+		defer func() {
+			browser.SetRequestFilter(nil)
+			browser.StopRecording()
+		}()
+		if err := browser.StopRecording(); err != nil {
+			t.Fatalf("Failed to reopen the context: %v", err)
+		}
+
+		if err := browser.Navigate(server.URL); err != nil {
+			t.Fatalf("Failed to navigate: %v", err)
+		}
+		if err := browser.Click("#open"); err != nil {
+			t.Fatalf("Failed to click: %v", err)
+		}
+		var snapshot string
+		for i := 0; i < 50 && !strings.Contains(snapshot, "isn't allowed"); i++ {
+			time.Sleep(100 * time.Millisecond)
+			snapshot, _ = browser.GetSnapshot()
+		}
+		if !strings.Contains(snapshot, "isn't allowed") || strings.Contains(snapshot, "Top secret") {
+			t.Errorf("The popup's request should be blocked, got: %s", snapshot)
+		}
+	})
+
+	t.Run("RequestFilterCoversRedirects", func(t *testing.T) {
+		var reached bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/go":
+				http.Redirect(w, r, "/hop", http.StatusFound)
+			case "/hop":
+				http.Redirect(w, r, "/secret", http.StatusFound)
+			case "/ok":
+				http.Redirect(w, r, "/fine", http.StatusMovedPermanently)
+			case "/secret":
+				reached = true
+				w.Write([]byte(`<html><body><p>Top secret</p></body></html>`))
+			default:
+				w.Write([]byte(`<html><body><p>Fine</p></body></html>`))
+			}
+		}))
+		defer server.Close()
+
+		browser.SetRequestFilter(func(url string) error {
+			if strings.HasSuffix(url, "/secret") {
+				return fmt.Errorf("%s is denied", url)
+			}
+			return nil
+		})
+		defer func() {
+			browser.SetRequestFilter(nil)
+			browser.StopRecording()
+		}()
+		if err := browser.StopRecording(); err != nil {
+			t.Fatalf("Failed to reopen the context: %v", err)
+		}
+
+		// Only the first URL of the chain is allowed-looking; the second hop is not
+		if err := browser.Navigate(server.URL + "/go"); err == nil {
+			t.Error("Expected the redirect to a denied URL to fail the navigation")
+		}
+		if reached {
+			t.Error("The denied URL must never be requested")
+		}
+		if current, _ := browser.CurrentURL(); strings.HasSuffix(current, "/secret") {
+			t.Errorf("The browser must not land on the denied page, got %s", current)
+		}
+
+		// Allowed redirects still work
+		if err := browser.Navigate(server.URL + "/ok"); err != nil {
+			t.Errorf("Expected an allowed redirect to load, got %v", err)
+		}
+		if current, _ := browser.CurrentURL(); !strings.HasSuffix(current, "/fine") {
+			t.Errorf("Expected to land on /fine, got %s", current)
+		}
+	})
+
+	t.Run("RecordingKeepsSession", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/login" {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "signed-in", Path: "/"})
+			}
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><p id="cookie">` + r.Header.Get("Cookie") + `</p></body></html>`))
+		}))
+		defer server.Close()
+
+		if err := browser.Navigate(server.URL + "/login"); err != nil {
+			t.Fatalf("Failed to navigate: %v", err)
+		}
+		if err := browser.StartRecording(filepath.Join(t.TempDir(), "task.har")); err != nil {
+			t.Fatalf("Failed to start recording: %v", err)
+		}
+		defer browser.StopRecording()
+
+		if err := browser.Navigate(server.URL + "/account"); err != nil {
+			t.Fatalf("Failed to navigate: %v", err)
+		}
+		snapshot, err := browser.GetSnapshot()
+		if err != nil {
+			t.Fatalf("Failed to get snapshot: %v", err)
+		}
+		if !strings.Contains(snapshot, "session=signed-in") {
+			t.Errorf("The recording context should keep the session cookie, got: %s", snapshot)
+		}
+	})
+
+	t.Run("RecordAndReplayHAR", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><h1 id="captured">Captured once</h1></body></html>`))
+		}))
+		harPath := filepath.Join(t.TempDir(), "task.har")
+
+		if err := browser.StartRecording(harPath); err != nil {
+			t.Fatalf("Failed to start recording: %v", err)
+		}
+		if err := browser.Navigate(server.URL); err != nil {
+			t.Fatalf("Failed to navigate: %v", err)
+		}
+		if err := browser.StopRecording(); err != nil {
+			t.Fatalf("Failed to stop recording: %v", err)
+		}
+
+		// Take the site offline: the replay must be served entirely from the HAR.
+		server.Close()
+
+		if err := browser.StartReplay(harPath); err != nil {
+			t.Fatalf("Failed to start replay: %v", err)
+		}
+		if err := browser.Navigate(server.URL); err != nil {
+			t.Fatalf("Failed to navigate during replay: %v", err)
+		}
+		snapshot, err := browser.GetSnapshot()
+		if err != nil {
+			t.Fatalf("Failed to get snapshot: %v", err)
+		}
+		if !strings.Contains(snapshot, "Captured once") {
+			t.Errorf("Replayed page should contain recorded content, got: %s", snapshot)
+		}
+	})
+
+	t.Run("ReadPage", func(t *testing.T) {
+		html := `
+		<html>
+			<body>
+				<nav><a href="/">Home</a></nav>
+				<article>
+					<h1>Release Notes</h1>
+					<p>This release brings a brand new reader mode that turns cluttered pages into clean text for the agent.</p>
+					<ul><li>Faster snapshots</li><li>Better tables</li></ul>
+					<table><tr><th>Name</th><th>Value</th></tr><tr><td>Speed</td><td>Fast</td></tr></table>
+				</article>
+			</body>
+		</html>
+		`
+		if err := browser.Navigate("data:text/html," + html); err != nil {
+			t.Fatalf("Failed to navigate: %v", err)
+		}
+
+		chunk, err := browser.ReadPage(0)
+		if err != nil {
+			t.Fatalf("Failed to read page: %v", err)
+		}
+		for _, want := range []string{"# Release Notes", "- Faster snapshots", "| Speed | Fast |"} {
+			if !strings.Contains(chunk.Markdown, want) {
+				t.Errorf("Markdown should contain %q, got: %s", want, chunk.Markdown)
+			}
+		}
+		if strings.Contains(chunk.Markdown, "Home") {
+			t.Errorf("Markdown should not contain navigation, got: %s", chunk.Markdown)
+		}
+	})
+}
+
+func TestChunkMarkdown(t *testing.T) {
+	markdown := "First paragraph.\n\nSecond paragraph.\n\nThird paragraph."
+
+	// A window that ends mid-paragraph should snap back to the previous paragraph break.
+	chunk := chunkMarkdown(markdown, 0, 25)
+	if chunk.Markdown != "First paragraph." {
+		t.Errorf("Expected first paragraph only, got %q", chunk.Markdown)
+	}
+	if chunk.NextOffset != 18 {
+		t.Errorf("Expected next offset 18, got %d", chunk.NextOffset)
+	}
+
+	// Reading from the next offset continues where we left off.
+	chunk = chunkMarkdown(markdown, chunk.NextOffset, 100)
+	if chunk.Markdown != "Second paragraph.\n\nThird paragraph." {
+		t.Errorf("Unexpected second chunk %q", chunk.Markdown)
+	}
+	if chunk.NextOffset != 0 {
+		t.Errorf("Expected no more content, got next offset %d", chunk.NextOffset)
+	}
+
+	// Offsets past the end return an empty chunk rather than panicking.
+	chunk = chunkMarkdown(markdown, 1000, 10)
+	if chunk.Markdown != "" || chunk.Total != len(markdown) {
+		t.Errorf("Expected empty chunk at end, got %+v", chunk)
+	}
+}
+
+func TestParseDialogPolicy(t *testing.T) {
+	cases := map[string]DialogPolicy{
+		"":         DialogManual,
+		"accept":   DialogAccept,
+		" Dismiss": DialogDismiss,
+		"MANUAL":   DialogManual,
+	}
+	for input, want := range cases {
+		got, err := ParseDialogPolicy(input)
+		if err != nil {
+			t.Errorf("ParseDialogPolicy(%q) failed: %v", input, err)
+		}
+		if got != want {
+			t.Errorf("ParseDialogPolicy(%q) = %q, want %q", input, got, want)
+		}
+	}
+
+	if _, err := ParseDialogPolicy("ignore"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestParsePopupPolicy(t *testing.T) {
+	cases := map[string]PopupPolicy{
+		"":        PopupSwitch,
+		"switch":  PopupSwitch,
+		" CLOSE ": PopupClose,
+	}
+	for input, want := range cases {
+		got, err := ParsePopupPolicy(input)
+		if err != nil {
+			t.Errorf("ParsePopupPolicy(%q) failed: %v", input, err)
+		}
+		if got != want {
+			t.Errorf("ParsePopupPolicy(%q) = %q, want %q", input, got, want)
+		}
+	}
+
+	if _, err := ParsePopupPolicy("ignore"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	cases := []struct {
+		glob, url string
+		want      bool
+	}{
+		{"**/*doubleclick.net/**", "https://ad.doubleclick.net/ads/x.js", true},
+		{"**/*doubleclick.net/**", "https://example.com/doubleclick", false},
+		{"https://example.com/*.png", "https://example.com/logo.png", true},
+		{"https://example.com/*.png", "https://example.com/img/logo.png", false},
+		{"https://example.com/?", "https://example.com/a", true},
+	}
+	for _, c := range cases {
+		re, err := globToRegexp(c.glob)
+		if err != nil {
+			t.Fatalf("globToRegexp(%q) failed: %v", c.glob, err)
+		}
+		if got := re.MatchString(c.url); got != c.want {
+			t.Errorf("%q matching %q = %v, want %v", c.glob, c.url, got, c.want)
+		}
+	}
+}
+
+func TestNetworkRulesDecide(t *testing.T) {
+	profile, err := LookupNetworkProfile("strict")
+	if err != nil {
+		t.Fatalf("LookupNetworkProfile failed: %v", err)
+	}
+	profile.Mocks = []MockRule{{URLPattern: "**/api/config", Body: `{"ok":true}`}}
+	rules, err := compileNetworkRules(profile)
+	if err != nil {
+		t.Fatalf("compileNetworkRules failed: %v", err)
+	}
+
+	if action, _ := rules.decide("image", "https://example.com/cat.jpg"); action != routeBlock {
+		t.Errorf("Images should be blocked, got %v", action)
+	}
+	if action, _ := rules.decide("script", "https://www.google-analytics.com/analytics.js"); action != routeBlock {
+		t.Errorf("Trackers should be blocked, got %v", action)
+	}
+	if action, mock := rules.decide("fetch", "https://example.com/api/config"); action != routeMock || mock.Body != `{"ok":true}` {
+		t.Errorf("Config endpoint should be mocked, got %v", action)
+	}
+	if action, _ := rules.decide("document", "https://example.com/"); action != routePass {
+		t.Errorf("Documents should pass, got %v", action)
+	}
+
+	if _, err := LookupNetworkProfile("turbo"); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
 }
@@ -0,0 +1,120 @@
+package browser
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/playwright-community/playwright-go"
+)
+
+// maxPageErrors caps how many diagnostics we keep per page so a noisy site can't eat memory.
+const maxPageErrors = 100
+
+// DefaultSlowRequestThreshold is how long a request may take before we report it as slow.
+const DefaultSlowRequestThreshold = 3 * time.Second
+
+// SetSlowRequestThreshold changes how long a request may take before it is reported as slow.
+func (pb *PlaywrightBrowser) SetSlowRequestThreshold(d time.Duration) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.slowRequest = d
+}
+
+// setupDiagnostics listens to the page's console and network traffic and buffers anything that went wrong.
+func (pb *PlaywrightBrowser) setupDiagnostics(page playwright.Page) {
+	page.OnConsole(func(msg playwright.ConsoleMessage) {
+		if msg.Type() != "error" && msg.Type() != "warning" {
+			return
+		}
+		url := ""
+		if loc := msg.Location(); loc != nil {
+			url = loc.URL
+		}
+		pb.addPageError(domain.PageError{Kind: "console", Message: msg.Type() + ": " + msg.Text(), URL: url})
+	})
+
+	page.OnPageError(func(err error) {
+		pb.addPageError(domain.PageError{Kind: "pageerror", Message: err.Error(), URL: page.URL()})
+	})
+
+	page.OnRequestFailed(func(req playwright.Request) {
+		reason := "request failed"
+		if err := req.Failure(); err != nil {
+			reason = err.Error()
+		}
+		pb.addPageError(domain.PageError{
+			Kind:    "request_failed",
+			Message: fmt.Sprintf("%s %s (%s): %s", req.Method(), req.ResourceType(), req.URL(), reason),
+			URL:     req.URL(),
+		})
+	})
+
+	page.OnResponse(func(resp playwright.Response) {
+		if resp.Status() < 400 {
+			return
+		}
+		req := resp.Request()
+		pb.addPageError(domain.PageError{
+			Kind:    "http_error",
+			Message: fmt.Sprintf("%s %s returned %d %s", req.Method(), req.URL(), resp.Status(), resp.StatusText()),
+			URL:     req.URL(),
+			Status:  resp.Status(),
+		})
+	})
+
+	page.OnRequestFinished(func(req playwright.Request) {
+		timing := req.Timing()
+		if timing == nil || timing.ResponseEnd <= 0 {
+			return
+		}
+		pb.mu.Lock()
+		threshold := pb.slowRequest
+		pb.mu.Unlock()
+
+		// ResponseEnd is measured in milliseconds relative to the request's start.
+		if threshold <= 0 || timing.ResponseEnd < float64(threshold.Milliseconds()) {
+			return
+		}
+		pb.addPageError(domain.PageError{
+			Kind:       "slow_request",
+			Message:    fmt.Sprintf("%s %s took %.0fms", req.Method(), req.URL(), timing.ResponseEnd),
+			URL:        req.URL(),
+			DurationMs: timing.ResponseEnd,
+		})
+	})
+}
+
+// addPageError appends to the per-page buffer, dropping the oldest entries once it is full.
+func (pb *PlaywrightBrowser) addPageError(e domain.PageError) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	pb.errorSeq++
+	e.Seq = pb.errorSeq
+	e.Time = time.Now()
+	pb.pageErrors = append(pb.pageErrors, e)
+	if len(pb.pageErrors) > maxPageErrors {
+		pb.pageErrors = pb.pageErrors[len(pb.pageErrors)-maxPageErrors:]
+	}
+}
+
+// clearPageErrors empties the buffer; called when the agent navigates to a new page.
+func (pb *PlaywrightBrowser) clearPageErrors() {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.pageErrors = nil
+}
+
+// GetPageErrors returns a copy of the diagnostics recorded on the current page.
+func (pb *PlaywrightBrowser) GetPageErrors() ([]domain.PageError, error) {
+	if pb.activePage() == nil {
+		return nil, fmt.Errorf("browser not initialized")
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	errs := make([]domain.PageError, len(pb.pageErrors))
+	copy(errs, pb.pageErrors)
+	return errs, nil
+}
@@ -0,0 +1,288 @@
+package browser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/playwright-community/playwright-go"
+)
+
+// DialogPolicy decides what happens when a page opens a JavaScript dialog
+// (alert, confirm, prompt or a "Leave site?" beforeunload prompt).
+type DialogPolicy string
+
+const (
+	// DialogAccept clicks "OK" on every dialog automatically.
+	DialogAccept DialogPolicy = "accept"
+	// DialogDismiss clicks "Cancel" on every dialog automatically.
+	DialogDismiss DialogPolicy = "dismiss"
+	// DialogManual leaves the dialog open until the agent calls HandleDialog.
+	// beforeunload prompts are still accepted so navigation never gets stuck.
+	DialogManual DialogPolicy = "manual"
+)
+
+// ParseDialogPolicy converts a config string (e.g. from the DIALOG_POLICY env var) into a DialogPolicy.
+func ParseDialogPolicy(s string) (DialogPolicy, error) {
+	switch p := DialogPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case DialogAccept, DialogDismiss, DialogManual:
+		return p, nil
+	case "":
+		return DialogManual, nil
+	default:
+		return "", fmt.Errorf("unknown dialog policy %q (want accept, dismiss or manual)", s)
+	}
+}
+
+// PopupPolicy decides what happens when a page opens a new tab or popup window
+// (a target="_blank" link or window.open, e.g. an OAuth login or a "print" view).
+type PopupPolicy string
+
+const (
+	// PopupSwitch moves the agent to the new tab. When it closes, the agent goes back to the tab that opened it.
+	PopupSwitch PopupPolicy = "switch"
+	// PopupClose closes new tabs straight away, so the agent stays on the page it was working on.
+	PopupClose PopupPolicy = "close"
+)
+
+// ParsePopupPolicy converts a config string (e.g. from the POPUP_POLICY env var) into a PopupPolicy.
+func ParsePopupPolicy(s string) (PopupPolicy, error) {
+	switch p := PopupPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case PopupSwitch, PopupClose:
+		return p, nil
+	case "":
+		return PopupSwitch, nil
+	default:
+		return "", fmt.Errorf("unknown popup policy %q (want switch or close)", s)
+	}
+}
+
+// permissionScript runs before any page script and reports permission requests
+// (geolocation, notifications) back to Go, so the agent knows the site asked for them.
+const permissionScript = `
+	(function() {
+		const report = (name) => { try { window.__kortexPermission(name); } catch (e) {} };
+		if (navigator.geolocation) {
+			const get = navigator.geolocation.getCurrentPosition.bind(navigator.geolocation);
+			const watch = navigator.geolocation.watchPosition.bind(navigator.geolocation);
+			navigator.geolocation.getCurrentPosition = function() { report('geolocation'); return get(...arguments); };
+			navigator.geolocation.watchPosition = function() { report('geolocation'); return watch(...arguments); };
+		}
+		if (window.Notification && Notification.requestPermission) {
+			const request = Notification.requestPermission.bind(Notification);
+			Notification.requestPermission = function() { report('notifications'); return request(...arguments); };
+		}
+	})()
+`
+
+// SetDialogPolicy changes how future dialogs are handled.
+func (pb *PlaywrightBrowser) SetDialogPolicy(policy DialogPolicy) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.dialogPolicy = policy
+}
+
+// SetGrantedPermissions lists the browser permissions (e.g. "geolocation", "notifications")
+// that sites are allowed to use. Everything else is denied. Must be called before Init.
+func (pb *PlaywrightBrowser) SetGrantedPermissions(permissions []string) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.grantedPermissions = permissions
+}
+
+// SetPopupPolicy changes how future popups and new tabs are handled.
+func (pb *PlaywrightBrowser) SetPopupPolicy(policy PopupPolicy) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.popupPolicy = policy
+}
+
+// setupDialogs wires the dialog and permission handlers onto a freshly created page.
+func (pb *PlaywrightBrowser) setupDialogs(page playwright.Page) error {
+	if len(pb.grantedPermissions) > 0 {
+		if err := page.Context().GrantPermissions(pb.grantedPermissions); err != nil {
+			return fmt.Errorf("could not grant permissions: %v", err)
+		}
+	}
+
+	if err := page.ExposeFunction("__kortexPermission", func(args ...interface{}) interface{} {
+		name := fmt.Sprint(args...)
+		decision := "denied"
+		for _, p := range pb.grantedPermissions {
+			if p == name {
+				decision = "granted"
+			}
+		}
+		pb.recordEvent(fmt.Sprintf("Site requested %s permission (%s by policy).", name, decision))
+		return nil
+	}); err != nil {
+		return fmt.Errorf("could not expose permission hook: %v", err)
+	}
+	script := permissionScript
+	if err := page.AddInitScript(playwright.Script{Content: &script}); err != nil {
+		return fmt.Errorf("could not add permission script: %v", err)
+	}
+
+	page.OnDialog(pb.onDialog)
+	page.OnClose(func(page playwright.Page) {
+		pb.mu.Lock()
+		delete(pb.pendingDialogs, page)
+		pb.mu.Unlock()
+	})
+	return nil
+}
+
+// onDialog is called by Playwright whenever the page opens a dialog.
+// It must never block: in manual mode we just park the dialog for the agent.
+func (pb *PlaywrightBrowser) onDialog(dialog playwright.Dialog) {
+	pb.mu.Lock()
+	policy := pb.dialogPolicy
+	if policy == DialogManual && dialog.Type() != "beforeunload" {
+		if pb.pendingDialogs == nil {
+			pb.pendingDialogs = map[playwright.Page]playwright.Dialog{}
+		}
+		pb.pendingDialogs[dialog.Page()] = dialog
+		pb.mu.Unlock()
+		return
+	}
+	pb.mu.Unlock()
+
+	var err error
+	action := "accepted"
+	if policy == DialogDismiss {
+		action = "dismissed"
+		err = dialog.Dismiss()
+	} else {
+		err = dialog.Accept()
+	}
+	if err != nil {
+		action = fmt.Sprintf("could not be handled: %v", err)
+	}
+	pb.recordEvent(fmt.Sprintf("A %s dialog appeared with text %q and was %s automatically.", dialog.Type(), dialog.Message(), action))
+}
+
+// onPopup is called by Playwright whenever a new page opens in our browser context.
+// Playwright delivers events one at a time, so the real work happens in a goroutine.
+func (pb *PlaywrightBrowser) onPopup(page playwright.Page) {
+	pb.mu.Lock()
+	opener := pb.page
+	policy := pb.popupPolicy
+	pb.mu.Unlock()
+	if page == opener {
+		return // The tab we opened ourselves
+	}
+
+	go func() {
+		// Give the popup a moment to get its real URL instead of about:blank
+		_ = page.WaitForLoadState(playwright.PageWaitForLoadStateOptions{State: playwright.LoadStateDomcontentloaded})
+
+		if policy == PopupClose {
+			if err := page.Close(); err != nil {
+				pb.recordEvent(fmt.Sprintf("A new tab opened at %s and could not be closed: %v", page.URL(), err))
+				return
+			}
+			pb.recordEvent(fmt.Sprintf("The page opened a new tab at %s, which was closed automatically.", page.URL()))
+			return
+		}
+		pb.switchToPopup(page, opener)
+	}()
+}
+
+// switchToPopup makes page the tab the agent works in, with the same handlers as the first tab.
+// When the popup closes (e.g. after an OAuth login), the agent goes back to opener.
+func (pb *PlaywrightBrowser) switchToPopup(page, opener playwright.Page) {
+	if err := pb.setupDialogs(page); err != nil {
+		pb.recordEvent(fmt.Sprintf("A new tab opened at %s but could not be set up: %v", page.URL(), err))
+		return
+	}
+	pb.setupDiagnostics(page) // Network rules are on the whole context, so they already cover the popup
+
+	page.OnClose(func(playwright.Page) {
+		pb.mu.Lock()
+		back := pb.page == page && opener != nil && !opener.IsClosed()
+		if back {
+			pb.page = opener
+		}
+		pb.mu.Unlock()
+		if back {
+			pb.recordEvent(fmt.Sprintf("The tab closed; you are back on %s.", opener.URL()))
+		}
+	})
+
+	pb.mu.Lock()
+	pb.page = page
+	pb.mu.Unlock()
+	pb.clearPageErrors()
+	pb.recordEvent(fmt.Sprintf("The page opened a new tab at %s. You are now working in it.", page.URL()))
+}
+
+// HandleDialog accepts or dismisses the dialog open on the agent's tab.
+// For prompt() dialogs, promptText is typed into the input before accepting.
+func (pb *PlaywrightBrowser) HandleDialog(accept bool, promptText string) error {
+	pb.mu.Lock()
+	dialog := pb.pendingDialogs[pb.page]
+	delete(pb.pendingDialogs, pb.page)
+	pb.mu.Unlock()
+
+	if dialog == nil {
+		return fmt.Errorf("no dialog is open")
+	}
+
+	if !accept {
+		if err := dialog.Dismiss(); err != nil {
+			return fmt.Errorf("failed to dismiss dialog: %v", err)
+		}
+		return nil
+	}
+	if dialog.Type() == "prompt" {
+		if err := dialog.Accept(promptText); err != nil {
+			return fmt.Errorf("failed to accept dialog: %v", err)
+		}
+		return nil
+	}
+	if err := dialog.Accept(); err != nil {
+		return fmt.Errorf("failed to accept dialog: %v", err)
+	}
+	return nil
+}
+
+// scriptablePage returns the agent's tab, or an error wrapping domain.ErrDialogOpen if a
+// dialog is open on it. While a dialog is open the page's JavaScript is frozen, so
+// Evaluate (and with it clicking, typing and reading) would hang until it is handled.
+func (pb *PlaywrightBrowser) scriptablePage() (playwright.Page, error) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if pb.page == nil {
+		return nil, fmt.Errorf("browser not initialized")
+	}
+	if d := pb.pendingDialogs[pb.page]; d != nil {
+		return nil, fmt.Errorf("%w (%s: %q): call handle_dialog to accept or dismiss it first", domain.ErrDialogOpen, d.Type(), d.Message())
+	}
+	return pb.page, nil
+}
+
+// recordEvent remembers something that happened on the page so the next snapshot can mention it.
+func (pb *PlaywrightBrowser) recordEvent(event string) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.events = append(pb.events, event)
+}
+
+// takeNotices returns (and clears) the page events recorded since the last snapshot,
+// plus a description of any dialog that is still waiting for the agent.
+func (pb *PlaywrightBrowser) takeNotices() (notices []string, blocked bool) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	notices = pb.events
+	pb.events = nil
+	if d := pb.pendingDialogs[pb.page]; d != nil {
+		notice := fmt.Sprintf("A %s dialog is open with text %q. Use handle_dialog to accept or dismiss it.", d.Type(), d.Message())
+		if d.Type() == "prompt" && d.DefaultValue() != "" {
+			notice += fmt.Sprintf(" Default value: %q.", d.DefaultValue())
+		}
+		notices = append(notices, notice)
+		blocked = true
+	}
+	return notices, blocked
+}
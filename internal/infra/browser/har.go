@@ -0,0 +1,96 @@
+package browser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// HAR (HTTP Archive) files capture every request and response the browser made.
+// Recording one per task lets us replay the exact same pages later with no network,
+// which turns a flaky real-world failure into a deterministic regression test.
+
+// StartRecording switches to a browser context that records all network traffic to harPath.
+// Cookies, localStorage and the open page carry over, so a logged-in session stays logged in.
+// The file is only written once StopRecording (or Close) is called.
+func (pb *PlaywrightBrowser) StartRecording(harPath string) error {
+	if pb.browser == nil {
+		return fmt.Errorf("browser not initialized")
+	}
+	if err := os.MkdirAll(filepath.Dir(harPath), 0755); err != nil {
+		return fmt.Errorf("could not create HAR directory: %v", err)
+	}
+
+	return pb.reopenContext(playwright.BrowserNewContextOptions{
+		RecordHarPath:    playwright.String(harPath),
+		RecordHarContent: playwright.HarContentPolicyEmbed, // Keep bodies inside the HAR so it is self-contained
+		RecordHarMode:    playwright.HarModeFull,
+	})
+}
+
+// StopRecording flushes the HAR file to disk and switches back to a normal, non-recording context,
+// again keeping the session's state.
+func (pb *PlaywrightBrowser) StopRecording() error {
+	if pb.browser == nil {
+		return fmt.Errorf("browser not initialized")
+	}
+	return pb.reopenContext(playwright.BrowserNewContextOptions{})
+}
+
+// reopenContext swaps the current context for a new one made with options. Playwright can only
+// turn HAR recording on when a context is created, so we copy the old context's storage state
+// (cookies and localStorage) into the new one and reopen the page the agent was on.
+func (pb *PlaywrightBrowser) reopenContext(options playwright.BrowserNewContextOptions) error {
+	pb.mu.Lock()
+	pb.replaying = false
+	pb.mu.Unlock()
+
+	url := ""
+	if pb.context != nil {
+		state, err := pb.context.StorageState()
+		if err != nil {
+			return fmt.Errorf("could not save browser state: %v", err)
+		}
+		options.StorageState = state.ToOptionalStorageState()
+		if page := pb.activePage(); page != nil {
+			url = page.URL()
+		}
+	}
+
+	if err := pb.openContext(options); err != nil {
+		return err
+	}
+	// Only real web pages are worth reopening (not about:blank or data: URLs)
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		if _, err := pb.activePage().Goto(url); err != nil {
+			pb.recordEvent(fmt.Sprintf("Could not reopen %s in the new browser context: %v", url, err))
+		}
+	}
+	return nil
+}
+
+// StartReplay opens a fresh browser context that serves every request from harPath.
+// Requests that aren't in the HAR are aborted, so the replay never touches the real network.
+func (pb *PlaywrightBrowser) StartReplay(harPath string) error {
+	if pb.browser == nil {
+		return fmt.Errorf("browser not initialized")
+	}
+	if _, err := os.Stat(harPath); err != nil {
+		return fmt.Errorf("could not open HAR file: %v", err)
+	}
+
+	pb.mu.Lock()
+	pb.replaying = true
+	pb.mu.Unlock()
+	return pb.openContext(playwright.BrowserNewContextOptions{}, func(context playwright.BrowserContext) error {
+		if err := context.RouteFromHAR(harPath, playwright.BrowserContextRouteFromHAROptions{
+			NotFound: playwright.HarNotFoundAbort,
+		}); err != nil {
+			return fmt.Errorf("could not replay HAR %s: %v", harPath, err)
+		}
+		return nil
+	})
+}
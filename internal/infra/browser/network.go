@@ -0,0 +1,425 @@
+package browser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/playwright-community/playwright-go"
+)
+
+// NetworkProfile describes which requests the browser should block, rewrite or fake.
+// Ads, trackers and heavy media make pages slow and snapshots noisy, so a server
+// running headless usually wants a stricter profile than a desktop user watching along.
+type NetworkProfile struct {
+	Name               string            `json:"name"`
+	BlockResourceTypes []string          `json:"block_resource_types"` // e.g. "image", "font", "media", "stylesheet"
+	BlockURLPatterns   []string          `json:"block_url_patterns"`   // Globs like "**/*doubleclick.net/**"
+	SetHeaders         map[string]string `json:"set_headers"`          // Headers added to (or replaced on) every request
+	Mocks              []MockRule        `json:"mocks"`                // Fake responses for matching URLs
+}
+
+// MockRule answers matching requests with a canned response instead of hitting the network.
+type MockRule struct {
+	URLPattern  string `json:"url_pattern"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+}
+
+// NetworkStats counts what the routing rules did. Reset at the start of each task.
+type NetworkStats struct {
+	Blocked   int `json:"blocked"`   // Requests aborted by a block rule
+	Mocked    int `json:"mocked"`    // Requests answered by a mock rule
+	Rewritten int `json:"rewritten"` // Requests sent on with modified headers
+	Passed    int `json:"passed"`    // Requests sent on untouched
+}
+
+// Built-in profiles, selectable with the NETWORK_PROFILE env var.
+var networkProfiles = map[string]NetworkProfile{
+	"default": {Name: "default"},
+	// "lite" skips everything the agent can't read anyway. Ideal for headless server runs.
+	"lite": {
+		Name:               "lite",
+		BlockResourceTypes: []string{"image", "font", "media"},
+	},
+	// "strict" also drops common ad and tracking networks.
+	"strict": {
+		Name:               "strict",
+		BlockResourceTypes: []string{"image", "font", "media"},
+		BlockURLPatterns: []string{
+			"**/*doubleclick.net/**",
+			"**/*googlesyndication.com/**",
+			"**/*google-analytics.com/**",
+			"**/*googletagmanager.com/**",
+			"**/*facebook.net/**",
+			"**/*hotjar.com/**",
+		},
+	},
+}
+
+// LookupNetworkProfile returns a built-in profile by name ("default", "lite" or "strict").
+func LookupNetworkProfile(name string) (NetworkProfile, error) {
+	if name == "" {
+		name = "default"
+	}
+	profile, ok := networkProfiles[strings.ToLower(name)]
+	if !ok {
+		return NetworkProfile{}, fmt.Errorf("unknown network profile %q", name)
+	}
+	return profile, nil
+}
+
+// LoadNetworkProfile reads a custom profile from a JSON file.
+func LoadNetworkProfile(path string) (NetworkProfile, error) {
+	var profile NetworkProfile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return profile, fmt.Errorf("could not read network profile: %v", err)
+	}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return profile, fmt.Errorf("could not parse network profile %s: %v", path, err)
+	}
+	return profile, nil
+}
+
+// ResolveNetworkProfile picks the profile to use from config: a JSON file wins over a built-in name.
+func ResolveNetworkProfile(name, file string) (NetworkProfile, error) {
+	if file != "" {
+		return LoadNetworkProfile(file)
+	}
+	return LookupNetworkProfile(name)
+}
+
+// String summarises the counters for logs, e.g. "12 blocked, 1 mocked, 0 rewritten, 40 passed".
+func (s NetworkStats) String() string {
+	return fmt.Sprintf("%d blocked, %d mocked, %d rewritten, %d passed", s.Blocked, s.Mocked, s.Rewritten, s.Passed)
+}
+
+// routeAction is the decision the rules engine makes for a single request.
+type routeAction int
+
+const (
+	routePass routeAction = iota
+	routeBlock
+	routeMock
+	routeRewrite
+)
+
+// networkRules is a compiled NetworkProfile plus its counters.
+type networkRules struct {
+	profile      NetworkProfile
+	blockTypes   map[string]bool
+	blockURLs    []*regexp.Regexp
+	mockPatterns []*regexp.Regexp
+
+	mu    sync.Mutex
+	stats NetworkStats
+}
+
+// compileNetworkRules turns the profile's globs into regular expressions once, up front.
+func compileNetworkRules(profile NetworkProfile) (*networkRules, error) {
+	rules := &networkRules{profile: profile, blockTypes: map[string]bool{}}
+	for _, t := range profile.BlockResourceTypes {
+		rules.blockTypes[strings.ToLower(t)] = true
+	}
+	for _, pattern := range profile.BlockURLPatterns {
+		re, err := globToRegexp(pattern)
+		if err != nil {
+			return nil, err
+		}
+		rules.blockURLs = append(rules.blockURLs, re)
+	}
+	for _, mock := range profile.Mocks {
+		re, err := globToRegexp(mock.URLPattern)
+		if err != nil {
+			return nil, err
+		}
+		rules.mockPatterns = append(rules.mockPatterns, re)
+	}
+	return rules, nil
+}
+
+// decide picks what to do with a request. Mocks win over blocks so a profile can
+// block a whole domain but still fake one endpoint on it.
+func (r *networkRules) decide(resourceType, url string) (routeAction, *MockRule) {
+	for i, re := range r.mockPatterns {
+		if re.MatchString(url) {
+			return routeMock, &r.profile.Mocks[i]
+		}
+	}
+	if r.blockTypes[resourceType] {
+		return routeBlock, nil
+	}
+	for _, re := range r.blockURLs {
+		if re.MatchString(url) {
+			return routeBlock, nil
+		}
+	}
+	if len(r.profile.SetHeaders) > 0 {
+		return routeRewrite, nil
+	}
+	return routePass, nil
+}
+
+// handle is the BrowserContext.Route callback. Untouched requests go to pass (with the
+// rewritten headers, if any); see passRoute for the default.
+func (r *networkRules) handle(route playwright.Route, pass func(route playwright.Route, headers map[string]string)) {
+	req := route.Request()
+	action, mock := r.decide(req.ResourceType(), req.URL())
+
+	r.mu.Lock()
+	switch action {
+	case routeBlock:
+		r.stats.Blocked++
+	case routeMock:
+		r.stats.Mocked++
+	case routeRewrite:
+		r.stats.Rewritten++
+	default:
+		r.stats.Passed++
+	}
+	r.mu.Unlock()
+
+	switch action {
+	case routeBlock:
+		route.Abort("blockedbyclient")
+	case routeMock:
+		status := mock.Status
+		if status == 0 {
+			status = 200
+		}
+		route.Fulfill(playwright.RouteFulfillOptions{
+			Status:      playwright.Int(status),
+			ContentType: playwright.String(mock.ContentType),
+			Body:        mock.Body,
+		})
+	case routeRewrite:
+		headers := req.Headers()
+		for k, v := range r.profile.SetHeaders {
+			headers[strings.ToLower(k)] = v
+		}
+		pass(route, headers)
+	default:
+		pass(route, nil)
+	}
+}
+
+// passRoute lets a request through untouched, apart from headers. It uses Fallback (not Continue)
+// so routes installed before ours, such as HAR replay, still get a chance to answer it.
+func passRoute(route playwright.Route, headers map[string]string) {
+	if headers != nil {
+		route.Fallback(playwright.RouteFallbackOptions{Headers: headers})
+		return
+	}
+	route.Fallback()
+}
+
+// empty reports whether the rules would never touch a request.
+func (r *networkRules) empty() bool {
+	return len(r.blockTypes) == 0 && len(r.blockURLs) == 0 &&
+		len(r.mockPatterns) == 0 && len(r.profile.SetHeaders) == 0
+}
+
+// snapshot returns the current counters, optionally resetting them.
+func (r *networkRules) snapshot(reset bool) NetworkStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stats
+	if reset {
+		r.stats = NetworkStats{}
+	}
+	return stats
+}
+
+// globToRegexp converts a URL glob into a regular expression.
+// "**" matches anything, "*" matches anything except "/", and "?" matches one character.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL pattern %q: %v", glob, err)
+	}
+	return re, nil
+}
+
+// SetNetworkProfile installs the request rules used by every page from now on.
+// Call it before Init, or it takes effect on the next fresh context (e.g. a new HAR recording).
+func (pb *PlaywrightBrowser) SetNetworkProfile(profile NetworkProfile) error {
+	rules, err := compileNetworkRules(profile)
+	if err != nil {
+		return err
+	}
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.network = rules
+	return nil
+}
+
+// NetworkStats returns how many requests were blocked, mocked, rewritten or passed
+// since the last reset. Pass reset=true at the start of a task so its counts are its own
+// (the counts so far are returned, then cleared).
+func (pb *PlaywrightBrowser) NetworkStats(reset bool) NetworkStats {
+	pb.mu.Lock()
+	rules := pb.network
+	pb.mu.Unlock()
+	if rules == nil {
+		return NetworkStats{}
+	}
+	return rules.snapshot(reset)
+}
+
+// SetRequestFilter installs a check that runs on every request any tab makes, including
+// popups and navigations triggered by clicks. Playwright only routes the first URL of a
+// redirect chain, so page navigations are fetched by us one hop at a time and every
+// redirect target is checked too (see checkRedirects). Service workers, whose requests
+// skip routing, are blocked. Requests for which the filter returns an error are aborted
+// and reported in the next snapshot.
+// Call it before Init, or it takes effect on the next fresh context.
+func (pb *PlaywrightBrowser) SetRequestFilter(filter func(url string) error) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.requestFilter = filter
+}
+
+// setupNetwork attaches the request filter and routing rules (if any) to a freshly created context.
+// Routing the whole context, not just one page, means popups and new tabs go through them too.
+func (pb *PlaywrightBrowser) setupNetwork(context playwright.BrowserContext) error {
+	pb.mu.Lock()
+	rules := pb.network
+	filter := pb.requestFilter
+	replaying := pb.replaying
+	pb.mu.Unlock()
+
+	// Routing every request has a cost, so skip it entirely when there's nothing to do.
+	if filter == nil && (rules == nil || rules.empty()) {
+		return nil
+	}
+
+	pass := passRoute
+	if filter != nil && !replaying {
+		// Page navigations are where redirects matter: follow them ourselves so each hop is checked.
+		// (A replay never touches the network, and its redirects come from the HAR.)
+		pass = func(route playwright.Route, headers map[string]string) {
+			if !route.Request().IsNavigationRequest() {
+				passRoute(route, headers)
+				return
+			}
+			pb.checkRedirects(context, route, headers, filter)
+		}
+	}
+	handler := func(route playwright.Route) {
+		if filter != nil {
+			if err := filter(route.Request().URL()); err != nil {
+				pb.blockRequest(route, route.Request().URL(), err)
+				return
+			}
+		}
+		if rules != nil {
+			rules.handle(route, pass)
+			return
+		}
+		pass(route, nil)
+	}
+
+	if err := context.Route("**/*", handler); err != nil {
+		return fmt.Errorf("could not install network rules: %v", err)
+	}
+	return nil
+}
+
+// blockRequest aborts a request the filter refused and tells the agent about it.
+func (pb *PlaywrightBrowser) blockRequest(route playwright.Route, target string, err error) {
+	route.Abort("blockedbyclient")
+	pb.addPageError(domain.PageError{Kind: "policy", Message: err.Error(), URL: target})
+	if route.Request().IsNavigationRequest() {
+		pb.recordEvent(fmt.Sprintf("The page tried to navigate somewhere it isn't allowed to go: %v", err))
+	}
+}
+
+// maxRedirects is how many redirects in a row a navigation may take, like a browser.
+const maxRedirects = 20
+
+// checkRedirects sends a page navigation itself without following redirects, then walks
+// the redirect chain one hop at a time, checking every Location with filter. If each hop
+// is allowed, the browser gets the first response and follows the (already checked)
+// chain; otherwise the navigation is aborted. A 169.254.169.254 behind an allowed
+// host's 302 never loads.
+func (pb *PlaywrightBrowser) checkRedirects(context playwright.BrowserContext, route playwright.Route, headers map[string]string, filter func(string) error) {
+	first, err := route.Fetch(playwright.RouteFetchOptions{Headers: headers, MaxRedirects: playwright.Int(0)})
+	if err != nil {
+		route.Abort("failed")
+		pb.addPageError(domain.PageError{Kind: "request", Message: fmt.Sprintf("could not load the page: %v", err), URL: route.Request().URL()})
+		return
+	}
+
+	resp, current := first, route.Request().URL()
+	for hops := 0; ; hops++ {
+		next := redirectTarget(resp, current)
+		if resp != first {
+			resp.Dispose()
+		}
+		if next == "" {
+			break // Not a redirect: the end of the chain
+		}
+		if err := filter(next); err != nil {
+			pb.blockRequest(route, next, err)
+			first.Dispose()
+			return
+		}
+		if hops >= maxRedirects {
+			route.Abort("failed")
+			pb.addPageError(domain.PageError{Kind: "request", Message: "too many redirects", URL: next})
+			first.Dispose()
+			return
+		}
+		// Later hops are plain GETs, like a browser does after 301/302/303, sharing the context's cookies
+		if resp, err = context.Request().Get(next, playwright.APIRequestContextGetOptions{MaxRedirects: playwright.Int(0)}); err != nil {
+			break // The browser will run into the same error and report it
+		}
+		current = next
+	}
+
+	route.Fulfill(playwright.RouteFulfillOptions{Response: first})
+	first.Dispose()
+}
+
+// redirectTarget returns the absolute URL resp redirects to, or "" if it isn't a redirect.
+func redirectTarget(resp playwright.APIResponse, current string) string {
+	location := resp.Headers()["location"]
+	if resp.Status() < 300 || resp.Status() > 399 || location == "" {
+		return ""
+	}
+	base, err := url.Parse(current)
+	if err != nil {
+		return ""
+	}
+	next, err := base.Parse(location)
+	if err != nil {
+		return ""
+	}
+	return next.String()
+}
@@ -0,0 +1,207 @@
+package browser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+)
+
+// ReadChunkSize is the maximum number of characters returned by one ReadPage call.
+// It keeps each tool result small enough for the model to digest comfortably.
+const ReadChunkSize = 8000
+
+// readerScript finds the main content of the page (Readability-style) and converts it to Markdown.
+// It scores candidate containers by how much paragraph text they hold versus how many links
+// they contain, so navigation bars, footers and sidebars lose to the actual article.
+const readerScript = `
+	(function() {
+		const NOISE = ['SCRIPT', 'STYLE', 'NOSCRIPT', 'NAV', 'FOOTER', 'ASIDE', 'FORM', 'IFRAME', 'SVG', 'BUTTON'];
+
+		function isHidden(el) {
+			const style = window.getComputedStyle(el);
+			return style.display === 'none' || style.visibility === 'hidden';
+		}
+
+		function linkDensity(el) {
+			const text = el.innerText || '';
+			if (!text.length) return 1;
+			let linkText = 0;
+			el.querySelectorAll('a').forEach(a => linkText += (a.innerText || '').length);
+			return linkText / text.length;
+		}
+
+		// Score every likely container and keep the best one
+		function findMain() {
+			const explicit = document.querySelector('article, main, [role="main"]');
+			if (explicit && (explicit.innerText || '').length > 200) return explicit;
+
+			let best = document.body, bestScore = 0;
+			document.querySelectorAll('div, section, td').forEach(el => {
+				if (isHidden(el)) return;
+				const paragraphs = el.querySelectorAll(':scope > p, :scope > pre, :scope > ul, :scope > ol');
+				if (!paragraphs.length) return;
+				let score = 0;
+				paragraphs.forEach(p => score += Math.min((p.innerText || '').length, 1000) / 100 + 1);
+				score *= (1 - linkDensity(el));
+				if (score > bestScore) { best = el; bestScore = score; }
+			});
+			return best;
+		}
+
+		function clean(text) {
+			return text.replace(/\s+/g, ' ');
+		}
+
+		function inline(el) {
+			let out = '';
+			for (const child of el.childNodes) {
+				if (child.nodeType === Node.TEXT_NODE) { out += clean(child.textContent); continue; }
+				if (child.nodeType !== Node.ELEMENT_NODE || NOISE.includes(child.tagName) || isHidden(child)) continue;
+				const text = inline(child);
+				switch (child.tagName) {
+					case 'A': {
+						const href = child.href || '';
+						out += href && !href.startsWith('javascript:') ? '[' + text.trim() + '](' + href + ')' : text;
+						break;
+					}
+					case 'STRONG': case 'B': out += text.trim() ? '**' + text.trim() + '**' : ''; break;
+					case 'EM': case 'I': out += text.trim() ? '*' + text.trim() + '*' : ''; break;
+					case 'CODE': out += '` + "`" + `' + child.textContent + '` + "`" + `'; break;
+					case 'BR': out += '\n'; break;
+					case 'IMG': out += child.alt ? '![' + child.alt + ']' : ''; break;
+					default: out += text;
+				}
+			}
+			return out;
+		}
+
+		function table(el) {
+			const rows = Array.from(el.querySelectorAll('tr')).map(tr =>
+				Array.from(tr.children).map(cell => inline(cell).trim().replace(/\|/g, '\\|')));
+			if (!rows.length) return '';
+			const width = Math.max(...rows.map(r => r.length));
+			const line = r => '| ' + Array.from({length: width}, (_, i) => r[i] || '').join(' | ') + ' |';
+			const out = [line(rows[0]), '|' + ' --- |'.repeat(width)];
+			rows.slice(1).forEach(r => out.push(line(r)));
+			return out.join('\n');
+		}
+
+		function list(el, depth) {
+			const ordered = el.tagName === 'OL';
+			let i = 1, out = [];
+			for (const li of el.children) {
+				if (li.tagName !== 'LI') continue;
+				const marker = ordered ? (i++) + '.' : '-';
+				const own = Array.from(li.childNodes).filter(n => !(n.tagName === 'UL' || n.tagName === 'OL'));
+				const wrapper = document.createElement('span');
+				own.forEach(n => wrapper.appendChild(n.cloneNode(true)));
+				out.push('  '.repeat(depth) + marker + ' ' + inline(wrapper).trim());
+				li.querySelectorAll(':scope > ul, :scope > ol').forEach(sub => out.push(list(sub, depth + 1)));
+			}
+			return out.join('\n');
+		}
+
+		function blocks(el, out) {
+			for (const child of el.children) {
+				if (NOISE.includes(child.tagName) || isHidden(child)) continue;
+				const tag = child.tagName;
+				if (/^H[1-6]$/.test(tag)) {
+					const text = inline(child).trim();
+					if (text) out.push('#'.repeat(Number(tag[1])) + ' ' + text);
+				} else if (tag === 'P' || tag === 'FIGCAPTION') {
+					const text = inline(child).trim();
+					if (text) out.push(text);
+				} else if (tag === 'UL' || tag === 'OL') {
+					out.push(list(child, 0));
+				} else if (tag === 'TABLE') {
+					out.push(table(child));
+				} else if (tag === 'PRE') {
+					out.push('` + "```" + `\n' + child.textContent.replace(/\n$/, '') + '\n` + "```" + `');
+				} else if (tag === 'BLOCKQUOTE') {
+					out.push(inline(child).trim().split('\n').map(l => '> ' + l).join('\n'));
+				} else if (tag === 'HR') {
+					out.push('---');
+				} else if (child.children.length) {
+					blocks(child, out);
+				} else {
+					const text = inline(child).trim();
+					if (text) out.push(text);
+				}
+			}
+			return out;
+		}
+
+		const main = findMain();
+		return {
+			title: document.title || '',
+			url: location.href,
+			markdown: blocks(main, []).filter(b => b.trim()).join('\n\n')
+		};
+	})()
+`
+
+// ReadPage extracts the main content of the current page as Markdown and returns
+// the chunk starting at 'offset'. Pass the returned NextOffset to continue reading.
+func (pb *PlaywrightBrowser) ReadPage(offset int) (*domain.PageChunk, error) {
+	page, err := pb.scriptablePage()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := page.Evaluate(readerScript)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate reader script: %v", err)
+	}
+
+	data, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected reader result: %T", result)
+	}
+	title, _ := data["title"].(string)
+	url, _ := data["url"].(string)
+	markdown, _ := data["markdown"].(string)
+
+	chunk := chunkMarkdown(markdown, offset, ReadChunkSize)
+	chunk.Title = title
+	chunk.URL = url
+	return chunk, nil
+}
+
+// chunkMarkdown cuts the Markdown into a window of at most 'size' characters starting at 'offset'.
+// It prefers to break at a paragraph boundary (a blank line) so the model never sees half a sentence,
+// falling back to a line break and finally a hard cut for very long paragraphs.
+func chunkMarkdown(markdown string, offset, size int) *domain.PageChunk {
+	runes := []rune(markdown)
+	total := len(runes)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+
+	end := offset + size
+	if end >= total {
+		end = total
+	} else {
+		window := string(runes[offset:end])
+		if cut := strings.LastIndex(window, "\n\n"); cut > 0 {
+			end = offset + len([]rune(window[:cut])) + 2
+		} else if cut := strings.LastIndex(window, "\n"); cut > 0 {
+			end = offset + len([]rune(window[:cut])) + 1
+		}
+	}
+
+	next := 0
+	if end < total {
+		next = end
+	}
+
+	return &domain.PageChunk{
+		Markdown:   strings.TrimSpace(string(runes[offset:end])),
+		Offset:     offset,
+		NextOffset: next,
+		Total:      total,
+	}
+}
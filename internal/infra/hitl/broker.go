@@ -0,0 +1,176 @@
+package hitl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/google/uuid"
+)
+
+// DefaultTimeout is how long we wait for a human before giving up.
+const DefaultTimeout = 2 * time.Minute
+
+// DefaultQuestionTimeout is longer: typing an answer (or editing a plan) takes more thought than clicking "Approve".
+const DefaultQuestionTimeout = 10 * time.Minute
+
+// ErrTimeout is returned when nobody answered a request in time.
+var ErrTimeout = errors.New("timed out waiting for the user")
+
+// Notifier delivers a request to the user, e.g. as a Wails event or a WebSocket message.
+type Notifier func(req domain.HumanRequest) error
+
+// Broker connects the agent, which asks questions from deep inside a tool call,
+// with the UI, which answers them at some later point from a different goroutine.
+// Each request gets an ID and a channel; Respond looks the channel up by ID.
+type Broker struct {
+	timeout  time.Duration            // Default wait for any kind of request
+	timeouts map[string]time.Duration // Per-kind overrides, e.g. "question"
+
+	mu       sync.Mutex
+	notify   Notifier
+	pending  map[string]chan domain.HumanResponse
+	requests map[string]domain.HumanRequest
+}
+
+// NewBroker creates a broker. A zero timeout means DefaultTimeout.
+func NewBroker(timeout time.Duration) *Broker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Broker{
+		timeout:  timeout,
+		timeouts: map[string]time.Duration{"question": DefaultQuestionTimeout, "plan": DefaultQuestionTimeout},
+		pending:  make(map[string]chan domain.HumanResponse),
+		requests: make(map[string]domain.HumanRequest),
+	}
+}
+
+// SetNotifier changes where new requests are sent. The web server swaps this
+// per task so requests go to the WebSocket client that started the task.
+func (b *Broker) SetNotifier(n Notifier) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.notify = n
+}
+
+// SetTimeout changes how long requests of one kind ("approval", "question") wait for an answer.
+func (b *Broker) SetTimeout(kind string, timeout time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.timeouts[kind] = timeout
+}
+
+// RequestApproval implements ports.Approver.
+// It blocks until the user answers, the context is cancelled, or the timeout passes.
+// Timeouts and cancellations count as "no": a sensitive action never happens by default.
+func (b *Broker) RequestApproval(ctx context.Context, req domain.HumanRequest) (bool, error) {
+	req.Kind = "approval"
+	resp, err := b.ask(ctx, req)
+	if err != nil {
+		return false, err
+	}
+	return resp.Approved, nil
+}
+
+// AskUser implements ports.Asker. The user's typed answer is returned as-is.
+func (b *Broker) AskUser(ctx context.Context, req domain.HumanRequest) (string, error) {
+	req.Kind = "question"
+	resp, err := b.ask(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return resp.Answer, nil
+}
+
+// ReviewPlan implements ports.PlanReviewer. The plan travels in req.Plan; the user
+// answers with Approved and, if they changed it, their version in Plan.
+func (b *Broker) ReviewPlan(ctx context.Context, req domain.HumanRequest) (domain.Plan, bool, error) {
+	req.Kind = "plan"
+	var plan domain.Plan
+	if req.Plan != nil {
+		plan = *req.Plan
+	}
+	resp, err := b.ask(ctx, req)
+	if err != nil {
+		return plan, false, err
+	}
+	if resp.Plan != nil {
+		plan = *resp.Plan
+	}
+	return plan, resp.Approved, nil
+}
+
+// ask registers the request, notifies the user and waits for the matching response.
+func (b *Broker) ask(ctx context.Context, req domain.HumanRequest) (domain.HumanResponse, error) {
+	if req.ID == "" {
+		req.ID = uuid.New().String()
+	}
+	if req.CreatedAt.IsZero() {
+		req.CreatedAt = time.Now()
+	}
+
+	ch := make(chan domain.HumanResponse, 1)
+	b.mu.Lock()
+	notify := b.notify
+	timeout, ok := b.timeouts[req.Kind]
+	if !ok || timeout <= 0 {
+		timeout = b.timeout
+	}
+	b.pending[req.ID] = ch
+	b.requests[req.ID] = req
+	b.mu.Unlock()
+	defer b.forget(req.ID)
+
+	if notify == nil {
+		return domain.HumanResponse{}, fmt.Errorf("no user interface connected to answer %s request", req.Kind)
+	}
+	if err := notify(req); err != nil {
+		return domain.HumanResponse{}, fmt.Errorf("failed to send %s request: %w", req.Kind, err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-timer.C:
+		return domain.HumanResponse{}, ErrTimeout
+	case <-ctx.Done():
+		return domain.HumanResponse{}, ctx.Err()
+	}
+}
+
+// Respond delivers the user's answer to whoever is waiting for it. The answer must be
+// for the same kind of request: a stray "approved" sent for a question or a plan
+// must not be taken as the user's answer to it.
+func (b *Broker) Respond(resp domain.HumanResponse) error {
+	b.mu.Lock()
+	ch, ok := b.pending[resp.ID]
+	req := b.requests[resp.ID]
+	b.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no pending request with id %s", resp.ID)
+	}
+	if resp.Kind != req.Kind {
+		return fmt.Errorf("request %s is a %s request, not a %q one", resp.ID, req.Kind, resp.Kind)
+	}
+
+	select {
+	case ch <- resp:
+		return nil
+	default:
+		return fmt.Errorf("request %s was already answered", resp.ID)
+	}
+}
+
+func (b *Broker) forget(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.pending, id)
+	delete(b.requests, id)
+}
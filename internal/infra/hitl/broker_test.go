@@ -0,0 +1,124 @@
+package hitl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+)
+
+func TestBrokerApproval(t *testing.T) {
+	broker := NewBroker(time.Second)
+
+	// The "UI" answers every request as soon as it sees it.
+	broker.SetNotifier(func(req domain.HumanRequest) error {
+		go broker.Respond(domain.HumanResponse{ID: req.ID, Kind: req.Kind, Approved: true})
+		return nil
+	})
+
+	req := domain.HumanRequest{ID: "buy", Message: "Click 'Buy'"}
+	approved, err := broker.RequestApproval(context.Background(), req)
+	if err != nil {
+		t.Fatalf("RequestApproval failed: %v", err)
+	}
+	if !approved {
+		t.Error("Expected approval")
+	}
+	if err := broker.Respond(domain.HumanResponse{ID: "buy", Kind: "approval", Approved: true}); err == nil {
+		t.Error("Answered requests should not stay pending")
+	}
+}
+
+func TestBrokerRejectsAnswerOfTheWrongKind(t *testing.T) {
+	broker := NewBroker(time.Second)
+	errs := make(chan error, 1)
+	broker.SetNotifier(func(req domain.HumanRequest) error {
+		go func() {
+			// An approval sent for a question must not count as its answer
+			errs <- broker.Respond(domain.HumanResponse{ID: req.ID, Kind: "approval", Approved: true})
+			broker.Respond(domain.HumanResponse{ID: req.ID, Kind: "question", Answer: "No"})
+		}()
+		return nil
+	})
+
+	answer, err := broker.AskUser(context.Background(), domain.HumanRequest{Message: "Delete everything?"})
+	if err != nil || answer != "No" {
+		t.Errorf("Expected the question's own answer, got %q, %v", answer, err)
+	}
+	if err := <-errs; err == nil {
+		t.Error("Expected the approval to be refused for a question")
+	}
+}
+
+func TestBrokerTimeout(t *testing.T) {
+	broker := NewBroker(50 * time.Millisecond)
+	broker.SetNotifier(func(req domain.HumanRequest) error { return nil }) // Nobody answers
+
+	approved, err := broker.RequestApproval(context.Background(), domain.HumanRequest{Message: "Send email"})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if approved {
+		t.Error("A timeout must never count as approval")
+	}
+}
+
+func TestBrokerRespondUnknown(t *testing.T) {
+	broker := NewBroker(0)
+	if err := broker.Respond(domain.HumanResponse{ID: "missing"}); err == nil {
+		t.Error("Expected error for unknown request id")
+	}
+	if _, err := broker.RequestApproval(context.Background(), domain.HumanRequest{}); err == nil {
+		t.Error("Expected error when no notifier is connected")
+	}
+}
+
+func TestBrokerAskUser(t *testing.T) {
+	broker := NewBroker(time.Second)
+	broker.SetNotifier(func(req domain.HumanRequest) error {
+		if req.Kind != "question" {
+			t.Errorf("Expected question request, got %s", req.Kind)
+		}
+		go broker.Respond(domain.HumanResponse{ID: req.ID, Kind: "question", Answer: "The Grand Hotel"})
+		return nil
+	})
+
+	answer, err := broker.AskUser(context.Background(), domain.HumanRequest{Message: "Which hotel is the usual one?"})
+	if err != nil {
+		t.Fatalf("AskUser failed: %v", err)
+	}
+	if answer != "The Grand Hotel" {
+		t.Errorf("Unexpected answer %q", answer)
+	}
+}
+
+func TestBrokerReviewPlan(t *testing.T) {
+	plan := domain.Plan{Goal: "Buy milk", Version: 1, Steps: []domain.PlanStep{{Number: 1, Description: "Open the shop"}}}
+	edited := domain.Plan{Steps: []domain.PlanStep{{Description: "Open the corner shop"}}}
+	broker := NewBroker(time.Second)
+
+	// Approved with changes: the user's version comes back
+	broker.SetNotifier(func(req domain.HumanRequest) error {
+		if req.Kind != "plan" || req.Plan == nil {
+			t.Errorf("Expected a plan request, got %+v", req)
+		}
+		go broker.Respond(domain.HumanResponse{ID: req.ID, Kind: "plan", Approved: true, Plan: &edited})
+		return nil
+	})
+	got, approved, err := broker.ReviewPlan(context.Background(), domain.HumanRequest{Plan: &plan})
+	if err != nil || !approved || got.Steps[0].Description != "Open the corner shop" {
+		t.Errorf("Expected the edited plan, got %+v, %v, %v", got, approved, err)
+	}
+
+	// Approved as it is: the original plan comes back
+	broker.SetNotifier(func(req domain.HumanRequest) error {
+		go broker.Respond(domain.HumanResponse{ID: req.ID, Kind: "plan", Approved: true})
+		return nil
+	})
+	got, approved, err = broker.ReviewPlan(context.Background(), domain.HumanRequest{Plan: &plan})
+	if err != nil || !approved || got.Steps[0].Description != "Open the shop" {
+		t.Errorf("Expected the original plan, got %+v, %v, %v", got, approved, err)
+	}
+}
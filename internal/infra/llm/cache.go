@@ -0,0 +1,215 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/ports"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// --- Model Cache ---
+// Every run of a task costs tokens, even when you only changed a log line. The cache
+// records each model response in a "cassette" (a directory of JSON files, one per
+// request) and plays them back later, so tests and local runs work offline and free.
+
+// Cache modes, as used by LLM_CACHE.
+const (
+	CacheOff    = "off"    // Always ask the model (the default)
+	CacheRecord = "record" // Ask the model and save every response
+	CacheReplay = "replay" // Answer from the cassette only; a request that wasn't recorded is an error
+)
+
+// DefaultCacheDir is where cassettes live unless LLM_CACHE_DIR says otherwise.
+const DefaultCacheDir = "./kortex_cassettes"
+
+// ErrNotRecorded is returned in replay mode for a request the cassette doesn't have.
+var ErrNotRecorded = errors.New("no recorded response for this request")
+
+// Cache wraps models so their responses are recorded or replayed.
+type Cache struct {
+	Mode string // One of the Cache* constants
+	Dir  string // The cassette
+}
+
+// NewCache checks the mode and, when recording, creates the cassette directory.
+func NewCache(mode, dir string) (*Cache, error) {
+	if dir == "" {
+		dir = DefaultCacheDir
+	}
+	switch mode {
+	case "", CacheOff:
+		mode = CacheOff
+	case CacheRecord:
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+		}
+	case CacheReplay:
+	default:
+		return nil, fmt.Errorf("unknown cache mode %q (use record, replay or off)", mode)
+	}
+	return &Cache{Mode: mode, Dir: dir}, nil
+}
+
+// NewModel gets a model from provider and wraps it. In replay mode the provider isn't
+// asked at all, so no API key is needed.
+func (c *Cache) NewModel(ctx context.Context, provider ports.AIProvider, cfg domain.ModelConfig) (model.LLM, error) {
+	name := cfg.Provider + "/" + cfg.Model // Part of every key, so cassettes of different models don't mix
+	if c.Mode == CacheReplay {
+		return &cachedModel{cache: c, name: name}, nil
+	}
+	inner, err := provider.NewModel(ctx, cfg)
+	if err != nil || c.Mode == CacheOff {
+		return inner, err
+	}
+	return &cachedModel{cache: c, name: name, inner: inner}, nil
+}
+
+// cachedModel records or replays the responses of inner.
+type cachedModel struct {
+	cache *Cache
+	name  string
+	inner model.LLM // nil when replaying
+}
+
+func (m *cachedModel) Name() string {
+	if m.inner != nil {
+		return m.inner.Name()
+	}
+	return m.name
+}
+
+// cassetteEntry is one file in the cassette.
+type cassetteEntry struct {
+	Model     string               `json:"model"`
+	Responses []*model.LLMResponse `json:"responses"`
+}
+
+func (m *cachedModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	// The key is taken before the request is sent, since models may add to it
+	key := RequestKey(m.name, req)
+	path := filepath.Join(m.cache.Dir, key+".json")
+
+	if m.inner == nil {
+		return func(yield func(*model.LLMResponse, error) bool) {
+			entry, err := readEntry(path)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, resp := range entry.Responses {
+				if !yield(resp, nil) {
+					return
+				}
+			}
+		}
+	}
+
+	return func(yield func(*model.LLMResponse, error) bool) {
+		entry := cassetteEntry{Model: m.name}
+		for resp, err := range m.inner.GenerateContent(ctx, req, stream) {
+			if err != nil {
+				yield(nil, err) // Errors are not recorded: the next run should try again
+				return
+			}
+			// Saved as each response arrives: the caller may stop reading after the last one
+			entry.Responses = append(entry.Responses, resp)
+			if err := writeEntry(path, entry); err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(resp, nil) {
+				return
+			}
+		}
+	}
+}
+
+func readEntry(path string) (*cassetteEntry, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w (%s); record it with LLM_CACHE=record", ErrNotRecorded, filepath.Base(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var entry cassetteEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	return &entry, nil
+}
+
+func writeEntry(path string, entry cassetteEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// RequestKey identifies a request by what the model gets to see: the model, the
+// system instruction, the conversation so far, the tools and the sampling settings.
+// Function call IDs are left out, because the ADK makes up new ones on every run.
+func RequestKey(modelName string, req *model.LLMRequest) string {
+	key := struct {
+		Model       string
+		System      *genai.Content `json:",omitempty"`
+		Contents    []*genai.Content
+		Tools       []*genai.Tool `json:",omitempty"`
+		Temperature *float32      `json:",omitempty"`
+		MaxTokens   int32         `json:",omitempty"`
+	}{Model: modelName}
+
+	for _, content := range req.Contents {
+		key.Contents = append(key.Contents, withoutCallIDs(content))
+	}
+	if cfg := req.Config; cfg != nil {
+		key.System = cfg.SystemInstruction
+		key.Tools = cfg.Tools
+		key.Temperature = cfg.Temperature
+		key.MaxTokens = cfg.MaxOutputTokens
+	}
+
+	data, _ := json.Marshal(key)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// withoutCallIDs copies content with the IDs of function calls and responses cleared.
+func withoutCallIDs(content *genai.Content) *genai.Content {
+	if content == nil {
+		return nil
+	}
+	out := &genai.Content{Role: content.Role}
+	for _, part := range content.Parts {
+		if part == nil {
+			continue
+		}
+		p := *part
+		if p.FunctionCall != nil {
+			call := *p.FunctionCall
+			call.ID = ""
+			p.FunctionCall = &call
+		}
+		if p.FunctionResponse != nil {
+			resp := *p.FunctionResponse
+			resp.ID = ""
+			p.FunctionResponse = &resp
+		}
+		out.Parts = append(out.Parts, &p)
+	}
+	return out
+}
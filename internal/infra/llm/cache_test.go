@@ -0,0 +1,45 @@
+package llm
+
+import (
+	"testing"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+func TestRequestKeyIgnoresCallIDs(t *testing.T) {
+	request := func(id, system string) *model.LLMRequest {
+		return &model.LLMRequest{
+			Config: &genai.GenerateContentConfig{SystemInstruction: genai.NewContentFromText(system, genai.RoleUser)},
+			Contents: []*genai.Content{
+				genai.NewContentFromText("Open example.com", genai.RoleUser),
+				{Role: genai.RoleModel, Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{ID: id, Name: "navigate", Args: map[string]any{"URL": "https://example.com"}}}}},
+				{Role: genai.RoleUser, Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{ID: id, Name: "navigate", Response: map[string]any{"result": "ok"}}}}},
+			},
+		}
+	}
+
+	first := request("adk-1", "You are Kortex.")
+	key := RequestKey("gemini/gemini-2.5-flash", first)
+	if RequestKey("gemini/gemini-2.5-flash", request("adk-2", "You are Kortex.")) != key {
+		t.Error("New call IDs on every run must not change the key")
+	}
+	if first.Contents[1].Parts[0].FunctionCall.ID != "adk-1" {
+		t.Error("RequestKey must not modify the request")
+	}
+	if RequestKey("gemini/gemini-2.5-flash", request("adk-1", "You are someone else.")) == key {
+		t.Error("A different system instruction must change the key")
+	}
+	if RequestKey("gemini/gemini-2.5-pro", first) == key {
+		t.Error("A different model must change the key")
+	}
+}
+
+func TestNewCacheRejectsUnknownMode(t *testing.T) {
+	if _, err := NewCache("rewind", t.TempDir()); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+	if c, err := NewCache("", ""); err != nil || c.Mode != CacheOff || c.Dir != DefaultCacheDir {
+		t.Errorf("Expected the defaults, got %+v (%v)", c, err)
+	}
+}
@@ -0,0 +1,118 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// --- Model Errors ---
+// Model APIs fail in different ways: a busy server (429, 503) is worth another try,
+// a conversation that no longer fits the context window needs a bigger model, and
+// a bad API key needs a human. These helpers tell them apart, whichever provider failed.
+
+// APIError is an error response from an HTTP model API.
+type APIError struct {
+	API        string        // What was called, e.g. "chat completions"
+	StatusCode int           // e.g. 429
+	Status     string        // e.g. "429 Too Many Requests"
+	Message    string        // What the server said
+	RetryAfter time.Duration // From the Retry-After header (0 = not given)
+}
+
+func (e *APIError) Error() string {
+	return e.API + " returned " + e.Status + ": " + e.Message
+}
+
+// StatusCode is the HTTP status of a failed model call, or 0 if err didn't come from the API.
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	var geminiErr genai.APIError
+	if errors.As(err, &geminiErr) {
+		return geminiErr.Code
+	}
+	return 0
+}
+
+// IsTransient reports whether trying the same call again later may work: rate limits,
+// overloaded or restarting servers, and dropped connections.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	switch StatusCode(err) {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case 0:
+		var netErr net.Error
+		return errors.As(err, &netErr)
+	}
+	return false
+}
+
+// overflowHints are how APIs say the prompt is longer than the model's context window.
+var overflowHints = []string{
+	"context_length_exceeded",
+	"context length",
+	"maximum context",
+	"input token count",
+	"too many tokens",
+}
+
+// IsContextOverflow reports whether the request was too long for the model.
+func IsContextOverflow(err error) bool {
+	if err == nil || (StatusCode(err) != http.StatusBadRequest && StatusCode(err) != http.StatusRequestEntityTooLarge) {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, hint := range overflowHints {
+		if strings.Contains(msg, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryAfter is how long the server asked us to wait, or 0 if it didn't say.
+// OpenAI-style APIs send a Retry-After header; Gemini sends a RetryInfo detail.
+func RetryAfter(err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RetryAfter
+	}
+	var geminiErr genai.APIError
+	if errors.As(err, &geminiErr) {
+		for _, detail := range geminiErr.Details {
+			if delay, ok := detail["retryDelay"].(string); ok {
+				if d, err := time.ParseDuration(delay); err == nil {
+					return d
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// parseRetryAfter reads a Retry-After header: either seconds or an HTTP date.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+func TestOpenAIRateLimitIsTransient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error": {"message": "Rate limit reached"}}`))
+	}))
+	defer server.Close()
+
+	llm, _ := (&OpenAI{BaseURL: server.URL}).NewModel(context.Background(), domain.ModelConfig{Model: "gpt-4o-mini"})
+	for _, err := range llm.GenerateContent(context.Background(), &model.LLMRequest{}, false) {
+		if !IsTransient(err) || IsContextOverflow(err) || RetryAfter(err) != 2*time.Second {
+			t.Errorf("Expected a transient error with a 2s Retry-After, got %v", err)
+		}
+	}
+}
+
+func TestClassifyGeminiErrors(t *testing.T) {
+	// The ADK wraps Gemini's error value
+	busy := fmt.Errorf("failed to call model: %w", genai.APIError{
+		Code:    503,
+		Message: "The model is overloaded.",
+		Details: []map[string]any{{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "7s"}},
+	})
+	if !IsTransient(busy) || RetryAfter(busy) != 7*time.Second {
+		t.Errorf("Expected a transient error with a 7s delay, got %v", busy)
+	}
+
+	tooLong := genai.APIError{Code: 400, Message: "The input token count (1200000) exceeds the maximum number of tokens allowed (1048576)."}
+	if IsTransient(tooLong) || !IsContextOverflow(tooLong) {
+		t.Errorf("Expected a context overflow, got %v", tooLong)
+	}
+
+	badKey := genai.APIError{Code: 400, Message: "API key not valid."}
+	if IsTransient(badKey) || IsContextOverflow(badKey) {
+		t.Errorf("A bad key is neither transient nor an overflow: %v", badKey)
+	}
+}
+
+func TestParseModel(t *testing.T) {
+	for in, want := range map[string]domain.ModelConfig{
+		"gemini-2.5-flash":   {Model: "gemini-2.5-flash"},
+		"openai:gpt-4o-mini": {Provider: ProviderOpenAI, Model: "gpt-4o-mini"},
+		"llama3.1:8b":        {Model: "llama3.1:8b"},
+	} {
+		if got := ParseModel(in); got.Provider != want.Provider || got.Model != want.Model {
+			t.Errorf("ParseModel(%q) = %+v, want %+v", in, got, want)
+		}
+	}
+}
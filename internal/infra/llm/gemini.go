@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/model/gemini"
+	"google.golang.org/genai"
+)
+
+// Provider names, as used by LLM_PROVIDER and domain.ModelConfig.Provider.
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai"
+)
+
+// DefaultGeminiModel is used when no model name is configured.
+const DefaultGeminiModel = "gemini-3-pro-preview" // Gemini 3 Pro for advanced reasoning
+
+// ParseModel reads a model from a setting like "gemini-2.5-flash" or "openai:gpt-4o-mini".
+// Without a known provider prefix the whole value is the model name (so "llama3.1:8b"
+// stays intact) and the provider is left for the caller's default.
+func ParseModel(s string) domain.ModelConfig {
+	s = strings.TrimSpace(s)
+	if provider, name, ok := strings.Cut(s, ":"); ok {
+		switch provider {
+		case ProviderGemini, ProviderOpenAI, ProviderScript:
+			return domain.ModelConfig{Provider: provider, Model: name}
+		}
+	}
+	return domain.ModelConfig{Model: s}
+}
+
+// Gemini implements ports.AIProvider with Google's Gemini API, through the ADK's own model.
+type Gemini struct {
+	APIKey string // GOOGLE_API_KEY
+}
+
+func (g *Gemini) Name() string { return ProviderGemini }
+
+// Check reports whether an API key is set.
+func (g *Gemini) Check() error {
+	if g.APIKey == "" {
+		return errors.New("GOOGLE_API_KEY is not set")
+	}
+	return nil
+}
+
+// NewModel creates a Gemini model. An empty model name means DefaultGeminiModel.
+func (g *Gemini) NewModel(ctx context.Context, cfg domain.ModelConfig) (model.LLM, error) {
+	if err := g.Check(); err != nil {
+		return nil, err
+	}
+	name := cfg.Model
+	if name == "" {
+		name = DefaultGeminiModel
+	}
+	m, err := gemini.NewModel(ctx, name, &genai.ClientConfig{APIKey: g.APIKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gemini model: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,324 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// DefaultOpenAIBaseURL is OpenAI's own API. Point BaseURL at any server that speaks the
+// same chat completions protocol instead: Ollama (http://localhost:11434/v1),
+// llama.cpp's llama-server (http://localhost:8080/v1), vLLM, LM Studio...
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAI implements ports.AIProvider for OpenAI-compatible chat completions endpoints.
+//
+// The ADK speaks Gemini's format (genai.Content with text, function call and
+// function response parts). This adapter translates each request into chat
+// messages and tool definitions, and the reply back into genai parts, so the rest
+// of the agent never knows which model it is talking to.
+type OpenAI struct {
+	BaseURL string       // Default DefaultOpenAIBaseURL
+	APIKey  string       // Sent as a bearer token; local servers usually don't need one
+	Client  *http.Client // Default http.DefaultClient
+}
+
+func (o *OpenAI) Name() string { return ProviderOpenAI }
+
+// Check reports whether the provider can be used. Without a base URL it talks to
+// OpenAI itself, which needs an API key.
+func (o *OpenAI) Check() error {
+	if o.BaseURL == "" && o.APIKey == "" {
+		return errors.New("OPENAI_API_KEY is not set (or set OPENAI_BASE_URL for a local server)")
+	}
+	return nil
+}
+
+// NewModel returns a model that sends every request to the chat completions endpoint.
+func (o *OpenAI) NewModel(ctx context.Context, cfg domain.ModelConfig) (model.LLM, error) {
+	if err := o.Check(); err != nil {
+		return nil, err
+	}
+	if cfg.Model == "" {
+		return nil, errors.New("no model name configured for the OpenAI-compatible provider")
+	}
+	return &openAIModel{provider: o, name: cfg.Model}, nil
+}
+
+type openAIModel struct {
+	provider *OpenAI
+	name     string
+}
+
+func (m *openAIModel) Name() string { return m.name }
+
+// GenerateContent sends one request. Streaming is not used: the whole reply comes
+// back as a single response, which the ADK handles the same way.
+func (m *openAIModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		resp, err := m.generate(ctx, req)
+		yield(resp, err)
+	}
+}
+
+// --- Wire format ---
+// Just the parts of the chat completions API we use.
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Tools       []chatTool    `json:"tools,omitempty"`
+	Temperature *float32      `json:"temperature,omitempty"`
+	MaxTokens   int32         `json:"max_tokens,omitempty"`
+}
+
+type chatMessage struct {
+	Role       string     `json:"role"` // system, user, assistant or tool
+	Content    string     `json:"content"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"` // For role "tool": which call this answers
+}
+
+type toolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"` // Always "function"
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON object, as a string
+	} `json:"function"`
+}
+
+type chatTool struct {
+	Type     string       `json:"type"` // Always "function"
+	Function chatFunction `json:"function"`
+}
+
+type chatFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"` // JSON Schema
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int32 `json:"prompt_tokens"`
+		CompletionTokens int32 `json:"completion_tokens"`
+		TotalTokens      int32 `json:"total_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (m *openAIModel) generate(ctx context.Context, req *model.LLMRequest) (*model.LLMResponse, error) {
+	body, err := json.Marshal(m.chatRequest(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode chat request: %w", err)
+	}
+
+	baseURL := m.provider.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chat request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if m.provider.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+m.provider.APIKey)
+	}
+
+	client := m.provider.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("chat request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chat response: %w", err)
+	}
+
+	var resp chatResponse
+	if err := json.Unmarshal(data, &resp); err != nil || httpResp.StatusCode != http.StatusOK {
+		apiErr := &APIError{
+			API:        "chat completions",
+			StatusCode: httpResp.StatusCode,
+			Status:     httpResp.Status,
+			Message:    strings.TrimSpace(string(data)),
+			RetryAfter: parseRetryAfter(httpResp.Header.Get("Retry-After")),
+		}
+		if resp.Error != nil && resp.Error.Message != "" {
+			apiErr.Message = resp.Error.Message
+			return nil, apiErr
+		}
+		if httpResp.StatusCode != http.StatusOK {
+			return nil, apiErr
+		}
+		return nil, fmt.Errorf("failed to decode chat response: %w", err)
+	}
+	return toLLMResponse(&resp)
+}
+
+// chatRequest translates the ADK request. Gemini's "model" role is "assistant" here,
+// function calls become tool_calls, and function responses become "tool" messages.
+func (m *openAIModel) chatRequest(req *model.LLMRequest) chatRequest {
+	out := chatRequest{Model: m.name}
+
+	if cfg := req.Config; cfg != nil {
+		out.Temperature = cfg.Temperature
+		out.MaxTokens = cfg.MaxOutputTokens
+		if system := contentText(cfg.SystemInstruction); system != "" {
+			out.Messages = append(out.Messages, chatMessage{Role: "system", Content: system})
+		}
+		for _, t := range cfg.Tools {
+			if t == nil {
+				continue
+			}
+			for _, decl := range t.FunctionDeclarations {
+				fn := chatFunction{Name: decl.Name, Description: decl.Description, Parameters: decl.ParametersJsonSchema}
+				if fn.Parameters == nil && decl.Parameters != nil {
+					fn.Parameters = schemaJSON(decl.Parameters)
+				}
+				if fn.Parameters == nil {
+					fn.Parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+				}
+				out.Tools = append(out.Tools, chatTool{Type: "function", Function: fn})
+			}
+		}
+	}
+
+	for _, content := range req.Contents {
+		if content == nil {
+			continue
+		}
+		msg := chatMessage{Role: "user"}
+		if content.Role == genai.RoleModel {
+			msg.Role = "assistant"
+		}
+		var results []chatMessage
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				args, _ := json.Marshal(part.FunctionCall.Args)
+				call := toolCall{ID: part.FunctionCall.ID, Type: "function"}
+				call.Function.Name = part.FunctionCall.Name
+				call.Function.Arguments = string(args)
+				msg.ToolCalls = append(msg.ToolCalls, call)
+			case part.FunctionResponse != nil:
+				result, _ := json.Marshal(part.FunctionResponse.Response)
+				results = append(results, chatMessage{Role: "tool", ToolCallID: part.FunctionResponse.ID, Content: string(result)})
+			case part.Text != "" && !part.Thought:
+				if msg.Content != "" {
+					msg.Content += "\n"
+				}
+				msg.Content += part.Text
+			}
+		}
+		if msg.Content != "" || len(msg.ToolCalls) > 0 {
+			out.Messages = append(out.Messages, msg)
+		}
+		out.Messages = append(out.Messages, results...)
+	}
+	return out
+}
+
+// toLLMResponse translates the first choice back into Gemini's format.
+func toLLMResponse(resp *chatResponse) (*model.LLMResponse, error) {
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("chat completions returned no choices")
+	}
+	choice := resp.Choices[0]
+	content := &genai.Content{Role: genai.RoleModel}
+	if choice.Message.Content != "" {
+		content.Parts = append(content.Parts, genai.NewPartFromText(choice.Message.Content))
+	}
+	for _, call := range choice.Message.ToolCalls {
+		args := map[string]any{}
+		if call.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+				return nil, fmt.Errorf("model sent invalid arguments for %q: %w", call.Function.Name, err)
+			}
+		}
+		content.Parts = append(content.Parts, &genai.Part{FunctionCall: &genai.FunctionCall{ID: call.ID, Name: call.Function.Name, Args: args}})
+	}
+
+	out := &model.LLMResponse{Content: content, TurnComplete: true}
+	switch choice.FinishReason {
+	case "stop", "tool_calls":
+		out.FinishReason = genai.FinishReasonStop
+	case "length":
+		out.FinishReason = genai.FinishReasonMaxTokens
+	case "content_filter":
+		out.FinishReason = genai.FinishReasonSafety
+	}
+	if u := resp.Usage; u != nil {
+		out.UsageMetadata = &genai.GenerateContentResponseUsageMetadata{
+			PromptTokenCount:     u.PromptTokens,
+			CandidatesTokenCount: u.CompletionTokens,
+			TotalTokenCount:      u.TotalTokens,
+		}
+	}
+	return out, nil
+}
+
+// contentText joins the text parts of a content (used for the system instruction).
+func contentText(content *genai.Content) string {
+	if content == nil {
+		return ""
+	}
+	var texts []string
+	for _, part := range content.Parts {
+		if part != nil && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// schemaJSON turns a Gemini schema into plain JSON Schema. Gemini writes types in
+// capitals ("OBJECT"); JSON Schema wants them in lower case.
+func schemaJSON(s *genai.Schema) map[string]any {
+	out := map[string]any{}
+	if s.Type != "" {
+		out["type"] = strings.ToLower(string(s.Type))
+	}
+	if s.Description != "" {
+		out["description"] = s.Description
+	}
+	if len(s.Enum) > 0 {
+		out["enum"] = s.Enum
+	}
+	if len(s.Required) > 0 {
+		out["required"] = s.Required
+	}
+	if s.Items != nil {
+		out["items"] = schemaJSON(s.Items)
+	}
+	if len(s.Properties) > 0 {
+		props := map[string]any{}
+		for name, prop := range s.Properties {
+			props[name] = schemaJSON(prop)
+		}
+		out["properties"] = props
+	}
+	return out
+}
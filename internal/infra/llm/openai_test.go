@@ -0,0 +1,131 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+func TestOpenAITranslatesRequestAndResponse(t *testing.T) {
+	var got chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer sk-test" {
+			t.Errorf("Expected the API key as a bearer token, got %q", auth)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{
+			"choices": [{"message": {"role": "assistant", "content": "", "tool_calls": [
+				{"id": "call_2", "type": "function", "function": {"name": "click", "arguments": "{\"Selector\":\"#buy\"}"}}
+			]}, "finish_reason": "tool_calls"}],
+			"usage": {"prompt_tokens": 120, "completion_tokens": 15, "total_tokens": 135}
+		}`))
+	}))
+	defer server.Close()
+
+	provider := &OpenAI{BaseURL: server.URL + "/v1/", APIKey: "sk-test"}
+	temperature := float32(0.2)
+	llm, err := provider.NewModel(context.Background(), domain.ModelConfig{Model: "llama3.1"})
+	if err != nil {
+		t.Fatalf("NewModel failed: %v", err)
+	}
+
+	req := &model.LLMRequest{
+		Config: &genai.GenerateContentConfig{
+			Temperature:       &temperature,
+			MaxOutputTokens:   512,
+			SystemInstruction: genai.NewContentFromText("You are Kortex.", genai.RoleUser),
+			Tools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{{
+				Name:        "navigate",
+				Description: "Navigates to a specified URL.",
+				Parameters: &genai.Schema{
+					Type:       genai.TypeObject,
+					Properties: map[string]*genai.Schema{"URL": {Type: genai.TypeString}},
+					Required:   []string{"URL"},
+				},
+			}}}},
+		},
+		Contents: []*genai.Content{
+			genai.NewContentFromText("Open example.com", genai.RoleUser),
+			{Role: genai.RoleModel, Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{ID: "call_1", Name: "navigate", Args: map[string]any{"URL": "https://example.com"}}}}},
+			{Role: genai.RoleUser, Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{ID: "call_1", Name: "navigate", Response: map[string]any{"result": "Navigated to https://example.com"}}}}},
+		},
+	}
+
+	var resp *model.LLMResponse
+	for r, err := range llm.GenerateContent(context.Background(), req, false) {
+		if err != nil {
+			t.Fatalf("GenerateContent failed: %v", err)
+		}
+		resp = r
+	}
+
+	// Request: system prompt first, then user, assistant tool call and tool result
+	if got.Model != "llama3.1" || got.Temperature == nil || *got.Temperature != 0.2 || got.MaxTokens != 512 {
+		t.Errorf("Unexpected model settings: %+v", got)
+	}
+	roles := []string{}
+	for _, m := range got.Messages {
+		roles = append(roles, m.Role)
+	}
+	if want := []string{"system", "user", "assistant", "tool"}; len(roles) != len(want) || roles[0] != want[0] || roles[2] != want[2] || roles[3] != want[3] {
+		t.Fatalf("Expected roles %v, got %v", want, roles)
+	}
+	if call := got.Messages[2].ToolCalls[0]; call.ID != "call_1" || call.Function.Arguments != `{"URL":"https://example.com"}` {
+		t.Errorf("Unexpected tool call %+v", call)
+	}
+	if got.Messages[3].ToolCallID != "call_1" {
+		t.Errorf("Tool result must answer call_1, got %q", got.Messages[3].ToolCallID)
+	}
+	params, _ := json.Marshal(got.Tools[0].Function.Parameters)
+	if string(params) != `{"properties":{"URL":{"type":"string"}},"required":["URL"],"type":"object"}` {
+		t.Errorf("Expected a lower-case JSON schema, got %s", params)
+	}
+
+	// Response: the tool call comes back as a Gemini function call, with usage
+	call := resp.Content.Parts[0].FunctionCall
+	if call == nil || call.ID != "call_2" || call.Name != "click" || call.Args["Selector"] != "#buy" {
+		t.Errorf("Unexpected function call %+v", call)
+	}
+	if u := resp.UsageMetadata; u == nil || u.PromptTokenCount != 120 || u.CandidatesTokenCount != 15 || u.TotalTokenCount != 135 {
+		t.Errorf("Unexpected usage %+v", resp.UsageMetadata)
+	}
+}
+
+func TestOpenAIReportsServerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": {"message": "model 'llama9' not found"}}`))
+	}))
+	defer server.Close()
+
+	llm, _ := (&OpenAI{BaseURL: server.URL}).NewModel(context.Background(), domain.ModelConfig{Model: "llama9"})
+	for _, err := range llm.GenerateContent(context.Background(), &model.LLMRequest{}, false) {
+		if err == nil || err.Error() != "chat completions returned 404 Not Found: model 'llama9' not found" {
+			t.Errorf("Expected the server's error message, got %v", err)
+		}
+	}
+}
+
+func TestProvidersCheckConfig(t *testing.T) {
+	if err := (&Gemini{}).Check(); err == nil {
+		t.Error("Gemini without an API key should fail its check")
+	}
+	if err := (&OpenAI{}).Check(); err == nil {
+		t.Error("OpenAI without a key or base URL should fail its check")
+	}
+	if err := (&OpenAI{BaseURL: "http://localhost:11434/v1"}).Check(); err != nil {
+		t.Errorf("A local server needs no key, got %v", err)
+	}
+	if _, err := (&OpenAI{BaseURL: "http://localhost:11434/v1"}).NewModel(context.Background(), domain.ModelConfig{}); err == nil {
+		t.Error("Expected an error without a model name")
+	}
+}
@@ -0,0 +1,205 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+	"gopkg.in/yaml.v3"
+)
+
+// ProviderScript is the name of the scripted fake model.
+const ProviderScript = "script"
+
+// Script is what a fake model says, turn by turn. It lets tests run the whole
+// ReAct loop (model -> tool -> model -> ...) with no API key and no network:
+//
+//	turns:
+//	  - calls:
+//	      - tool: navigate
+//	        args: {URL: "https://shop.example"}
+//	        want: "Navigated to"
+//	  - text: "I opened the shop."
+//
+// Each turn is one model response. Its calls are the tools the model asks for;
+// the next turn first checks that the tool results it receives match want/want_error.
+type Script struct {
+	Turns []Turn `yaml:"turns"`
+}
+
+// Turn is one model response.
+type Turn struct {
+	Text             string `yaml:"text,omitempty"`              // What the model says
+	Calls            []Call `yaml:"calls,omitempty"`             // Tools the model calls
+	Error            string `yaml:"error,omitempty"`             // Fail the model call with this error instead
+	PromptTokens     int32  `yaml:"prompt_tokens,omitempty"`     // Reported token usage
+	CompletionTokens int32  `yaml:"completion_tokens,omitempty"` // Reported token usage
+}
+
+// Call is one tool call, plus what its result should look like.
+type Call struct {
+	Tool      string         `yaml:"tool"`
+	Args      map[string]any `yaml:"args,omitempty"`
+	Want      string         `yaml:"want,omitempty"`       // The tool's result must contain this
+	WantError string         `yaml:"want_error,omitempty"` // The tool must fail with an error containing this
+}
+
+// LoadScript reads a Script from a YAML file.
+func LoadScript(path string) (Script, error) {
+	var s Script
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, fmt.Errorf("failed to read script: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("failed to parse script %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// ScriptedModel plays a Script. It is a model.LLM and its own ports.AIProvider,
+// so it can be registered with agent.WithProvider and picked as "script".
+// After the run, Err reports any tool result that didn't match, and any turn left unplayed.
+type ScriptedModel struct {
+	script Script
+
+	mu       sync.Mutex
+	turn     int      // Next turn to play
+	failures []string // Mismatches found so far
+}
+
+// NewScriptedModel creates a model that plays script from the start.
+func NewScriptedModel(script Script) *ScriptedModel {
+	return &ScriptedModel{script: script}
+}
+
+func (m *ScriptedModel) Name() string { return ProviderScript }
+
+func (m *ScriptedModel) Check() error { return nil }
+
+// NewModel returns the model itself, whatever model name is asked for.
+func (m *ScriptedModel) NewModel(ctx context.Context, cfg domain.ModelConfig) (model.LLM, error) {
+	return m, nil
+}
+
+// GenerateContent checks the tool results in req against the previous turn and plays the next turn.
+func (m *ScriptedModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		yield(m.next(req))
+	}
+}
+
+func (m *ScriptedModel) next(req *model.LLMRequest) (*model.LLMResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.turn > 0 {
+		m.checkResults(m.turn-1, req)
+	}
+	if m.turn >= len(m.script.Turns) {
+		err := fmt.Errorf("script has no turn %d", m.turn+1)
+		m.failures = append(m.failures, err.Error())
+		return nil, err
+	}
+	turn := m.script.Turns[m.turn]
+	m.turn++
+	if turn.Error != "" {
+		return nil, errors.New(turn.Error)
+	}
+
+	content := &genai.Content{Role: genai.RoleModel}
+	if turn.Text != "" {
+		content.Parts = append(content.Parts, genai.NewPartFromText(turn.Text))
+	}
+	for i, call := range turn.Calls {
+		content.Parts = append(content.Parts, &genai.Part{FunctionCall: &genai.FunctionCall{
+			ID:   callID(m.turn-1, i),
+			Name: call.Tool,
+			Args: call.Args,
+		}})
+	}
+	return &model.LLMResponse{
+		Content:      content,
+		TurnComplete: true,
+		UsageMetadata: &genai.GenerateContentResponseUsageMetadata{
+			PromptTokenCount:     turn.PromptTokens,
+			CandidatesTokenCount: turn.CompletionTokens,
+			TotalTokenCount:      turn.PromptTokens + turn.CompletionTokens,
+		},
+	}, nil
+}
+
+// checkResults compares the tool results the model was sent with what turn expected.
+func (m *ScriptedModel) checkResults(turn int, req *model.LLMRequest) {
+	results := map[string]map[string]any{}
+	for _, content := range req.Contents {
+		if content == nil {
+			continue
+		}
+		for _, part := range content.Parts {
+			if part.FunctionResponse != nil {
+				results[part.FunctionResponse.ID] = part.FunctionResponse.Response
+			}
+		}
+	}
+
+	for i, call := range m.script.Turns[turn].Calls {
+		result, ok := results[callID(turn, i)]
+		if !ok {
+			m.failf(turn, call, "no result received")
+			continue
+		}
+		got, _ := json.Marshal(result["result"])
+		errText := fmt.Sprint(result["error"])
+		switch {
+		case call.WantError != "" && (result["error"] == nil || !strings.Contains(errText, call.WantError)):
+			m.failf(turn, call, "want error containing %q, got %s", call.WantError, describe(result))
+		case call.WantError == "" && result["error"] != nil && call.Want != "":
+			m.failf(turn, call, "want result containing %q, got error %s", call.Want, errText)
+		case call.Want != "" && !strings.Contains(string(got), call.Want):
+			m.failf(turn, call, "want result containing %q, got %s", call.Want, describe(result))
+		}
+	}
+}
+
+func (m *ScriptedModel) failf(turn int, call Call, format string, args ...any) {
+	m.failures = append(m.failures, fmt.Sprintf("turn %d, %s: ", turn+1, call.Tool)+fmt.Sprintf(format, args...))
+}
+
+// Err reports every mismatch, and turns the agent never got to. nil means the script played out as written.
+func (m *ScriptedModel) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	failures := append([]string(nil), m.failures...)
+	if m.turn < len(m.script.Turns) {
+		failures = append(failures, fmt.Sprintf("only %d of %d turns were played", m.turn, len(m.script.Turns)))
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(failures, "; "))
+}
+
+func callID(turn, i int) string { return fmt.Sprintf("script-%d-%d", turn+1, i+1) }
+
+// describe prints a tool result for a failure message. Tool errors arrive as error
+// values, which JSON would print as {}.
+func describe(result map[string]any) string {
+	shown := map[string]any{}
+	for k, v := range result {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		shown[k] = v
+	}
+	data, _ := json.Marshal(shown)
+	return string(data)
+}
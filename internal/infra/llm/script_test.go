@@ -0,0 +1,49 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+func TestScriptedModelReportsMismatches(t *testing.T) {
+	m := NewScriptedModel(Script{Turns: []Turn{
+		{Calls: []Call{{Tool: "click", Args: map[string]any{"Selector": "#buy"}, Want: "Clicked #buy"}}},
+		{Text: "Done."},
+		{Text: "Never reached."},
+	}})
+
+	first, _ := m.next(&model.LLMRequest{})
+	call := first.Content.Parts[0].FunctionCall
+	if call.Name != "click" || call.Args["Selector"] != "#buy" {
+		t.Fatalf("Unexpected call %+v", call)
+	}
+
+	// The click "failed", which the script didn't expect
+	reply := &genai.Content{Role: genai.RoleUser, Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{
+		ID: call.ID, Name: "click", Response: map[string]any{"error": "element not found"},
+	}}}}
+	second, err := m.next(&model.LLMRequest{Contents: []*genai.Content{first.Content, reply}})
+	if err != nil || second.Content.Parts[0].Text != "Done." {
+		t.Fatalf("Expected the second turn, got %+v (%v)", second, err)
+	}
+
+	err = m.Err()
+	if err == nil || !strings.Contains(err.Error(), `turn 1, click: want result containing "Clicked #buy", got error element not found`) ||
+		!strings.Contains(err.Error(), "only 2 of 3 turns were played") {
+		t.Errorf("Unexpected report: %v", err)
+	}
+
+	// Running past the end of the script is an error too
+	m.next(&model.LLMRequest{})
+	if _, err := m.next(&model.LLMRequest{}); err == nil {
+		t.Error("Expected an error past the last turn")
+	}
+	if llm, _ := m.NewModel(context.Background(), domain.ModelConfig{Model: "anything"}); llm != m {
+		t.Error("NewModel should return the scripted model itself")
+	}
+}
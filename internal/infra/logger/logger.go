@@ -1,75 +1,447 @@
 package logger
 
 import (
+	"bufio"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
-	"log/slog"
+	"io"
+	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/ports"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/redact"
 )
 
+// DefaultPath is where the flight recorder writes when no path is configured.
+const DefaultPath = "kortex_flight_recorder.jsonl"
+
+// Options configures a FlightRecorder.
+type Options struct {
+	Path     string         // JSONL file to append to (default DefaultPath)
+	MaxBytes int64          // Start a new file once the current one reaches this size (0 = never)
+	MaxAge   time.Duration  // Start a new file once the current one has been open this long (0 = never)
+	MaxFiles int            // How many rotated files to keep; older ones are deleted (0 = keep all)
+	Compress bool           // Gzip rotated files (kortex_flight_recorder.jsonl.20240102-150405.000.gz)
+	Redactor ports.Redactor // Scrubs personal data before writing (default redact.Default())
+	Index    ports.Recorder // Also receives every (redacted) record, e.g. a SQLite index for searching
+}
+
 // FlightRecorder is a specialized logger that records the agent's "thoughts" and actions.
-// It writes structured JSON logs to a file, which can be replayed or analyzed later.
+// It writes one JSON object per line (see domain.FlightRecord), which can be replayed or analyzed later.
 // We call it a "Flight Recorder" (like a black box on a plane) because it helps us
 // understand what happened if something goes wrong.
 type FlightRecorder struct {
-	logger *slog.Logger // The underlying structured logger
-	file   *os.File     // The file we are writing to
-	mu     sync.Mutex   // Ensures we don't write from two threads at once
+	opts     Options
+	mu       sync.Mutex     // Ensures we don't write from two threads at once
+	file     *os.File       // The file we are writing to (nil after a failed reopen: write tries again)
+	closed   bool           // Close was called; nothing more is written
+	size     int64          // Bytes in the current file, for rotation
+	openedAt time.Time      // When the current file was opened, for age-based rotation
+	cleanup  sync.WaitGroup // Background compression/retention jobs, so Close can wait for them
+	cleanMu  sync.Mutex     // Runs those jobs one at a time, so pruning never races a compression
+}
+
+// New opens (or creates) the recorder's file. The file stays open until Close.
+func New(opts Options) (*FlightRecorder, error) {
+	if opts.Path == "" {
+		opts.Path = DefaultPath
+	}
+	r := &FlightRecorder{opts: opts}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the file in append mode (don't overwrite old logs). Caller holds r.mu or owns r.
+func (r *FlightRecorder) open() error {
+	f, err := os.OpenFile(r.opts.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open flight recorder: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not open flight recorder: %w", err)
+	}
+	r.file = f
+	r.size = info.Size()
+	r.openedAt = time.Now()
+	return nil
+}
+
+// Record implements ports.Recorder. It fills in the time, scrubs personal data and
+// appends the record as one line of JSON.
+func (r *FlightRecorder) Record(ctx context.Context, rec domain.FlightRecord) error {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	if rec.TaskID == "" {
+		rec.TaskID = TaskIDFrom(ctx)
+	}
+
+	redactor := r.opts.Redactor
+	if redactor == nil {
+		redactor = redact.Default()
+	}
+	rec.Args = redactValue(redactor, rec.Args)
+	rec.Result = redactValue(redactor, rec.Result)
+	rec.Details = redactValue(redactor, rec.Details)
+	rec.Error = redactor.Redact(rec.Error)
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("could not encode flight record: %w", err)
+	}
+	data = append(data, '\n')
+
+	if err := r.write(data); err != nil {
+		return err
+	}
+
+	// The file is the source of truth; a failing index shouldn't fail the task
+	if r.opts.Index != nil {
+		if err := r.opts.Index.Record(ctx, rec); err != nil {
+			log.Printf("Failed to index flight record: %v", err)
+		}
+	}
+	return nil
+}
+
+// write appends one encoded line, rotating first if the file is full.
+func (r *FlightRecorder) write(data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return fmt.Errorf("flight recorder is closed")
+	}
+	if r.needsRotation(len(data)) {
+		if err := r.rotate(); err != nil {
+			// Better a file that's too big than a lost record: keep writing where we were
+			log.Printf("Failed to rotate the flight recorder: %v", err)
+		}
+	}
+	if r.file == nil {
+		// An earlier reopen failed (e.g. the disk was full); try again rather than stay dead
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+	n, err := r.file.Write(data)
+	r.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("could not write flight record: %w", err)
+	}
+	return nil
+}
+
+// needsRotation reports whether the next write of n bytes should go to a fresh file. Caller holds r.mu.
+func (r *FlightRecorder) needsRotation(n int) bool {
+	if r.file == nil || r.size == 0 {
+		return false // Never rotate an empty file
+	}
+	if r.opts.MaxBytes > 0 && r.size+int64(n) > r.opts.MaxBytes {
+		return true
+	}
+	return r.opts.MaxAge > 0 && time.Since(r.openedAt) >= r.opts.MaxAge
+}
+
+// rotate moves the full file aside (kortex_flight_recorder.jsonl.20240102-150405.000)
+// and starts a fresh one. Compression and pruning happen in the background so
+// writers are only blocked for the rename. Caller holds r.mu.
+// If the rename fails, the current file is reopened so writing can go on; if even that
+// fails, r.file is left nil and write tries to open it again next time.
+func (r *FlightRecorder) rotate() error {
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		r.open()
+		return fmt.Errorf("could not close flight recorder: %w", err)
+	}
+	rotated := rotatedName(r.opts.Path, time.Now())
+	if err := os.Rename(r.opts.Path, rotated); err != nil {
+		r.open()
+		return fmt.Errorf("could not rotate flight recorder: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.cleanup.Add(1)
+	go func() {
+		defer r.cleanup.Done()
+		r.cleanMu.Lock()
+		defer r.cleanMu.Unlock()
+		if r.opts.Compress {
+			if err := compressFile(rotated); err != nil {
+				log.Printf("Failed to compress %s: %v", rotated, err)
+			}
+		}
+		if err := r.prune(); err != nil {
+			log.Printf("Failed to prune old flight recorder files: %v", err)
+		}
+	}()
+	return nil
+}
+
+// rotatedName picks a name for a rotated file that doesn't clobber an earlier one,
+// even when two rotations happen within the same millisecond.
+func rotatedName(path string, now time.Time) string {
+	base := path + "." + now.Format("20060102-150405.000")
+	name := base
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	return name
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Reopen closes and reopens the file at the configured path. Call it after an
+// external tool such as logrotate has moved the file away (the web server does
+// this on SIGHUP). Writes wait on the same lock, so none are lost. If the file
+// can't be opened, the next write tries again.
+func (r *FlightRecorder) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return fmt.Errorf("flight recorder is closed")
+	}
+	if r.file != nil {
+		err := r.file.Close()
+		r.file = nil
+		if err != nil {
+			log.Printf("Failed to close the flight recorder: %v", err)
+		}
+	}
+	return r.open()
+}
+
+// compressFile gzips path into path.gz and removes the original.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(path)
+}
+
+// prune deletes the oldest rotated files so at most MaxFiles remain.
+// Rotated names end in a sortable timestamp, so sorting by name sorts by age.
+func (r *FlightRecorder) prune() error {
+	if r.opts.MaxFiles <= 0 {
+		return nil
+	}
+	rotated, err := RotatedFiles(r.opts.Path)
+	if err != nil {
+		return err
+	}
+	for len(rotated) > r.opts.MaxFiles {
+		if err := os.Remove(rotated[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// RotatedFiles lists the rotated files that belong to the recorder at path, oldest first.
+func RotatedFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var rotated []string
+	for _, m := range matches {
+		// An original with a .gz twin is mid-compression; count the .gz only
+		if fileExists(m + ".gz") {
+			continue
+		}
+		rotated = append(rotated, m)
+	}
+	sort.Strings(rotated)
+	return rotated, nil
 }
 
+// Close properly closes the log file when the program exits.
+// It waits for any background compression to finish first.
+func (r *FlightRecorder) Close() error {
+	r.cleanup.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func redactValue(redactor ports.Redactor, v any) any {
+	if v == nil {
+		return nil
+	}
+	return redactor.RedactValue(v)
+}
+
+// ReadFile loads every record from a flight recorder file. Rotated files ending
+// in ".gz" are decompressed on the fly. Lines that aren't valid records are skipped,
+// so a file cut short by a crash can still be read.
+func ReadFile(path string) ([]domain.FlightRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open flight recorder file: %w", err)
+	}
+	defer f.Close()
+
+	var reader io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress %s: %w", path, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	var records []domain.FlightRecord
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024) // Snapshots in results can make long lines
+	for scanner.Scan() {
+		var rec domain.FlightRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	return records, nil
+}
+
+// Tee sends every record to several recorders, e.g. the flight recorder and the
+// metrics. All of them get the record; the first error is returned after all have run.
+func Tee(recorders ...ports.Recorder) ports.Recorder {
+	return tee(recorders)
+}
+
+type tee []ports.Recorder
+
+func (t tee) Record(ctx context.Context, rec domain.FlightRecord) error {
+	var first error
+	for _, r := range t {
+		if err := r.Record(ctx, rec); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// --- Task scope ---
+
+type taskIDKey struct{}
+
+// WithTaskID tags a context with the task it belongs to. Every record written with
+// this context (or one derived from it) carries the task ID.
+func WithTaskID(ctx context.Context, taskID string) context.Context {
+	return context.WithValue(ctx, taskIDKey{}, taskID)
+}
+
+// TaskIDFrom returns the task ID stored by WithTaskID, or "".
+func TaskIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(taskIDKey{}).(string)
+	return id
+}
+
+type sessionIDKey struct{}
+
+// WithSessionID groups the tasks run with ctx into one session (e.g. one
+// WebSocket connection), so their records and token usage can be looked up together.
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey{}, sessionID)
+}
+
+// SessionIDFrom returns the session ID stored by WithSessionID, or "".
+func SessionIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(sessionIDKey{}).(string)
+	return id
+}
+
+// --- Global recorder ---
+// Small programs and tests can use the package-level functions instead of passing a recorder around.
+
 var (
 	instance *FlightRecorder // Singleton instance (there can be only one)
 	once     sync.Once       // Ensures Init runs only once
 )
 
 // Init initializes the global flight recorder.
-// It opens the log file and sets up the JSON handler.
 func Init(filePath string) error {
 	var err error
 	once.Do(func() {
-		// Open file in append mode (don't overwrite old logs)
-		f, e := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if e != nil {
-			err = e
-			return
-		}
-
-		// Create a JSON handler that writes to the file
-		handler := slog.NewJSONHandler(f, nil)
-		logger := slog.New(handler)
-
-		instance = &FlightRecorder{
-			logger: logger,
-			file:   f,
-		}
+		instance, err = New(Options{Path: filePath})
 	})
 	return err
 }
 
-// LogThought logs a step in the agent's reasoning process.
-// It takes a context (for tracing), a step name (e.g., "PLANNING"), and details.
+// LogThought logs a step in the agent's reasoning process to the global recorder.
+// It takes a context (for the task ID), a step name (e.g., "PLANNING"), and details.
 func LogThought(ctx context.Context, step string, details interface{}) {
 	if instance == nil {
 		// Fallback if not initialized, just print to console
 		fmt.Printf("FlightRecorder not initialized. Step: %s, Details: %v\n", step, details)
 		return
 	}
-
-	instance.mu.Lock()
-	defer instance.mu.Unlock()
-
-	// Write the log entry as a JSON object
-	instance.logger.InfoContext(ctx, "thought",
-		slog.String("step", step),
-		slog.Any("details", details),
-	)
+	instance.Record(ctx, domain.FlightRecord{
+		Kind:    "thought",
+		Details: map[string]any{"step": step, "details": details},
+	})
 }
 
-// Close properly closes the log file when the program exits.
+// Close closes the global recorder.
 func Close() error {
-	if instance != nil && instance.file != nil {
-		return instance.file.Close()
+	if instance != nil {
+		return instance.Close()
 	}
 	return nil
 }
@@ -0,0 +1,285 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+)
+
+func readRecords(t *testing.T, path string) []domain.FlightRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var records []domain.FlightRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec domain.FlightRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestRecordWritesTaskScopedJSONL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recorder.jsonl")
+	recorder, err := New(Options{Path: path})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	ctx := WithTaskID(context.Background(), "task-1")
+	recorder.Record(ctx, domain.FlightRecord{Kind: "tool", Tool: "type", Step: 1, Args: map[string]string{"Text": "mail bob@example.com"}})
+	recorder.Record(ctx, domain.FlightRecord{Kind: "task_end", Error: "failed for bob@example.com"})
+	recorder.Close()
+
+	records := readRecords(t, path)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].TaskID != "task-1" || records[0].Time.IsZero() || records[0].Step != 1 {
+		t.Errorf("Record missing task ID, time or step: %+v", records[0])
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "bob@example.com") {
+		t.Error("Flight recorder must not contain personal data")
+	}
+}
+
+// memoryIndex collects what the recorder forwards to its index.
+type memoryIndex struct {
+	records []domain.FlightRecord
+}
+
+func (m *memoryIndex) Record(ctx context.Context, rec domain.FlightRecord) error {
+	m.records = append(m.records, rec)
+	return nil
+}
+
+func TestRecordForwardsRedactedRecordsToIndex(t *testing.T) {
+	index := &memoryIndex{}
+	recorder, err := New(Options{Path: filepath.Join(t.TempDir(), "recorder.jsonl"), Index: index})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer recorder.Close()
+
+	ctx := WithTaskID(context.Background(), "task-1")
+	recorder.Record(ctx, domain.FlightRecord{Kind: "tool", Tool: "type", Args: map[string]string{"Text": "bob@example.com"}})
+
+	if len(index.records) != 1 || index.records[0].TaskID != "task-1" {
+		t.Fatalf("Expected the record in the index, got %+v", index.records)
+	}
+	data, _ := json.Marshal(index.records[0])
+	if strings.Contains(string(data), "bob@example.com") {
+		t.Error("Index must receive the redacted record")
+	}
+}
+
+func TestRecordRotatesAtMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "recorder.jsonl")
+	recorder, err := New(Options{Path: path, MaxBytes: 200})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer recorder.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool", Tool: "click"}); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	files, _ := filepath.Glob(path + "*")
+	if len(files) < 2 {
+		t.Errorf("Expected the recorder to rotate, got files %v", files)
+	}
+	if info, _ := os.Stat(path); info.Size() > 200 {
+		t.Errorf("Current file is %d bytes, over the limit", info.Size())
+	}
+}
+
+func TestRotationCompressesAndPrunes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recorder.jsonl")
+	recorder, err := New(Options{Path: path, MaxBytes: 100, MaxFiles: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool", Tool: "navigate"})
+		time.Sleep(2 * time.Millisecond) // Rotated names carry a millisecond timestamp
+	}
+	recorder.Close() // Waits for background compression
+
+	rotated, err := RotatedFiles(path)
+	if err != nil {
+		t.Fatalf("RotatedFiles failed: %v", err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("Expected 2 rotated files to be kept, got %v", rotated)
+	}
+	for _, f := range rotated {
+		if !strings.HasSuffix(f, ".gz") {
+			t.Errorf("Expected %s to be compressed", f)
+		}
+	}
+
+	// The newest rotated file is valid gzip containing JSON lines
+	f, _ := os.Open(rotated[1])
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Rotated file is not gzip: %v", err)
+	}
+	data, _ := io.ReadAll(gz)
+	if !strings.Contains(string(data), `"tool":"navigate"`) {
+		t.Errorf("Unexpected rotated contents %q", data)
+	}
+}
+
+func TestRotationByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recorder.jsonl")
+	recorder, err := New(Options{Path: path, MaxAge: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer recorder.Close()
+
+	recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool"})
+	time.Sleep(5 * time.Millisecond)
+	recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool"})
+
+	if rotated, _ := RotatedFiles(path); len(rotated) != 1 {
+		t.Errorf("Expected one rotation after MaxAge, got %v", rotated)
+	}
+}
+
+func TestReopenAfterExternalMove(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "recorder.jsonl")
+	recorder, err := New(Options{Path: path})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer recorder.Close()
+
+	recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool", Tool: "before"})
+	os.Rename(path, filepath.Join(dir, "moved.jsonl")) // What logrotate does
+	if err := recorder.Reopen(); err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool", Tool: "after"})
+
+	records := readRecords(t, path)
+	if len(records) != 1 || records[0].Tool != "after" {
+		t.Errorf("Expected only the new record in the reopened file, got %+v", records)
+	}
+}
+
+func TestRecorderSurvivesFailedRotationAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "recorder.jsonl")
+	recorder, err := New(Options{Path: path, MaxBytes: 50})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer recorder.Close()
+
+	// With the file gone, rotating it fails: the record still gets written
+	recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool", Tool: "first"})
+	os.Remove(path)
+	if err := recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool", Tool: "second"}); err != nil {
+		t.Fatalf("Expected the record to be written despite the failed rotation, got %v", err)
+	}
+	if records := readRecords(t, path); len(records) != 1 || records[0].Tool != "second" {
+		t.Errorf("Expected the record in a fresh file, got %+v", records)
+	}
+
+	// A reopen that fails (the path is a directory) is retried by the next write
+	os.Rename(path, filepath.Join(dir, "moved.jsonl"))
+	os.Mkdir(path, 0755)
+	if err := recorder.Reopen(); err == nil {
+		t.Fatal("Expected Reopen to fail")
+	}
+	if err := recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool"}); err == nil {
+		t.Error("Expected the write to fail while the file can't be opened")
+	}
+	os.Remove(path)
+	if err := recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool", Tool: "third"}); err != nil {
+		t.Fatalf("Expected writing to resume, got %v", err)
+	}
+	if records := readRecords(t, path); len(records) != 1 || records[0].Tool != "third" {
+		t.Errorf("Expected the record in the reopened file, got %+v", records)
+	}
+}
+
+func TestConcurrentWritesSurviveRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recorder.jsonl")
+	recorder, err := New(Options{Path: path, MaxBytes: 2000})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool", Tool: "click"})
+			}
+		}()
+	}
+	wg.Wait()
+	recorder.Close()
+
+	files, _ := RotatedFiles(path)
+	total := len(readRecords(t, path))
+	for _, f := range files {
+		total += len(readRecords(t, f))
+	}
+	if total != 500 {
+		t.Errorf("Expected 500 records across all files, got %d", total)
+	}
+}
+
+func TestReadFileHandlesGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recorder.jsonl")
+	recorder, err := New(Options{Path: path, MaxBytes: 1, Compress: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool", Tool: "navigate"})
+	recorder.Record(context.Background(), domain.FlightRecord{Kind: "tool", Tool: "click"}) // Rotates the first one
+	recorder.Close()
+
+	rotated, _ := RotatedFiles(path)
+	if len(rotated) != 1 {
+		t.Fatalf("Expected one rotated file, got %v", rotated)
+	}
+	records, err := ReadFile(rotated[0])
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if len(records) != 1 || records[0].Tool != "navigate" {
+		t.Errorf("Unexpected records %+v", records)
+	}
+}
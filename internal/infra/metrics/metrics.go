@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/ports"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Metrics is Kortex's dashboard: Prometheus counters and histograms for tasks,
+// tool calls, model usage, the browser and the vector store.
+//
+// It doesn't need hooks of its own. It implements ports.Recorder, so it reads the
+// same stream of flight records the black box does (task_start, tool, model, task_end)
+// and turns them into numbers.
+type Metrics struct {
+	Registry *prometheus.Registry // Everything below, plus Go runtime and process metrics
+
+	tasksStarted    prometheus.Counter
+	tasksFinished   *prometheus.CounterVec   // outcome: completed, failed, cancelled, budget_exceeded, max_tool_calls, timeout, stuck
+	tasksInProgress prometheus.Gauge         // Tasks currently holding the browser
+	taskDuration    *prometheus.HistogramVec // outcome
+	toolCalls       *prometheus.CounterVec   // tool, outcome: ok, error
+	toolDuration    *prometheus.HistogramVec // tool
+	modelCalls      *prometheus.CounterVec   // outcome
+	modelTokens     *prometheus.CounterVec   // type: prompt, completion
+	modelLatency    prometheus.Histogram
+	modelRecoveries *prometheus.CounterVec   // event: retry, fallback, circuit_open
+	vectorLatency   *prometheus.HistogramVec // operation: save, search
+}
+
+// New creates the metrics on their own registry, so several instances (e.g. in tests) don't clash.
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		tasksStarted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "kortex_tasks_started_total",
+			Help: "Tasks started.",
+		}),
+		tasksFinished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kortex_tasks_finished_total",
+			Help: "Tasks finished, by outcome (completed, failed, cancelled, budget_exceeded, max_tool_calls, timeout, stuck).",
+		}, []string{"outcome"}),
+		tasksInProgress: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "kortex_tasks_in_progress",
+			Help: "Tasks currently running.",
+		}),
+		taskDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kortex_task_duration_seconds",
+			Help:    "How long tasks took, by outcome.",
+			Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800},
+		}, []string{"outcome"}),
+		toolCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kortex_tool_calls_total",
+			Help: "Tool calls, by tool and outcome (ok, error).",
+		}, []string{"tool", "outcome"}),
+		toolDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kortex_tool_duration_seconds",
+			Help:    "How long tool calls took, by tool.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"tool"}),
+		modelCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kortex_model_calls_total",
+			Help: "Model turns, by outcome (ok, error).",
+		}, []string{"outcome"}),
+		modelTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kortex_model_tokens_total",
+			Help: "Tokens used, by type (prompt, completion).",
+		}, []string{"type"}),
+		modelLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "kortex_model_latency_seconds",
+			Help:    "How long the model took to answer.",
+			Buckets: []float64{0.25, 0.5, 1, 2, 4, 8, 16, 32, 64},
+		}),
+		modelRecoveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kortex_model_recoveries_total",
+			Help: "Model errors worked around, by event (retry, fallback, circuit_open).",
+		}, []string{"event"}),
+		vectorLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kortex_vector_store_duration_seconds",
+			Help:    "Vector store latency, by operation (save, search).",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1},
+		}, []string{"operation"}),
+	}
+	m.Registry.MustRegister(
+		m.tasksStarted, m.tasksFinished, m.tasksInProgress, m.taskDuration,
+		m.toolCalls, m.toolDuration,
+		m.modelCalls, m.modelTokens, m.modelLatency, m.modelRecoveries,
+		m.vectorLatency,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Record implements ports.Recorder by counting what the record describes.
+func (m *Metrics) Record(ctx context.Context, rec domain.FlightRecord) error {
+	duration := (time.Duration(rec.DurationMs) * time.Millisecond).Seconds()
+	switch rec.Kind {
+	case "task_start":
+		m.tasksStarted.Inc()
+		m.tasksInProgress.Inc()
+	case "task_end":
+		outcome := "completed"
+		if details, ok := rec.Details.(map[string]any); ok && details["outcome"] != nil {
+			outcome, _ = details["outcome"].(string)
+		} else if rec.Error != "" {
+			outcome = "failed"
+		}
+		m.tasksFinished.WithLabelValues(outcome).Inc()
+		m.tasksInProgress.Dec()
+		m.taskDuration.WithLabelValues(outcome).Observe(duration)
+	case "tool":
+		m.toolCalls.WithLabelValues(rec.Tool, outcome(rec.Error)).Inc()
+		m.toolDuration.WithLabelValues(rec.Tool).Observe(duration)
+	case "model":
+		m.modelCalls.WithLabelValues(outcome(rec.Error)).Inc()
+		m.modelLatency.Observe(duration)
+		if rec.Usage != nil {
+			m.modelTokens.WithLabelValues("prompt").Add(float64(rec.Usage.PromptTokens))
+			m.modelTokens.WithLabelValues("completion").Add(float64(rec.Usage.CompletionTokens))
+		}
+	case "retry", "fallback", "circuit_open":
+		m.modelRecoveries.WithLabelValues(rec.Kind).Inc()
+	}
+	return nil
+}
+
+func outcome(errText string) string {
+	if errText != "" {
+		return "error"
+	}
+	return "ok"
+}
+
+// WatchBrowserContexts exports how many browser contexts are open, read from
+// count at scrape time. Together with kortex_tasks_in_progress this shows how
+// busy the browser is.
+func (m *Metrics) WatchBrowserContexts(count func() int) {
+	m.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "kortex_browser_contexts_open",
+		Help: "Browser contexts currently open.",
+	}, func() float64 { return float64(count()) }))
+}
+
+// InstrumentVectorStore wraps a vector store so every Save and Search is timed.
+func (m *Metrics) InstrumentVectorStore(store ports.VectorStore) ports.VectorStore {
+	return &timedVectorStore{VectorStore: store, latency: m.vectorLatency}
+}
+
+type timedVectorStore struct {
+	ports.VectorStore
+	latency *prometheus.HistogramVec
+}
+
+func (s *timedVectorStore) Save(ctx context.Context, fragment *domain.MemoryFragment) error {
+	defer s.observe("save", time.Now())
+	return s.VectorStore.Save(ctx, fragment)
+}
+
+func (s *timedVectorStore) Search(ctx context.Context, queryVector []float32, limit int) ([]domain.MemoryFragment, error) {
+	defer s.observe("search", time.Now())
+	return s.VectorStore.Search(ctx, queryVector, limit)
+}
+
+func (s *timedVectorStore) observe(operation string, start time.Time) {
+	s.latency.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
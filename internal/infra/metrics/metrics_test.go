@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecordCountsTasksToolsAndTokens(t *testing.T) {
+	m := New()
+	ctx := context.Background()
+	records := []domain.FlightRecord{
+		{Kind: "task_start"},
+		{Kind: "retry", Error: "429 Too Many Requests"},
+		{Kind: "model", DurationMs: 1200, Usage: &domain.TokenUsage{PromptTokens: 100, CompletionTokens: 20}},
+		{Kind: "tool", Tool: "click", DurationMs: 50},
+		{Kind: "tool", Tool: "click", DurationMs: 50, Error: "element not found"},
+		{Kind: "task_end", DurationMs: 3000, Error: "gave up", Details: map[string]any{"outcome": "failed"}},
+		{Kind: "task_start"},
+		{Kind: "task_end", Details: map[string]any{"outcome": "cancelled"}},
+	}
+	for _, rec := range records {
+		m.Record(ctx, rec)
+	}
+
+	checks := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"tasks started", testutil.ToFloat64(m.tasksStarted), 2},
+		{"tasks in progress", testutil.ToFloat64(m.tasksInProgress), 0},
+		{"failed tasks", testutil.ToFloat64(m.tasksFinished.WithLabelValues("failed")), 1},
+		{"cancelled tasks", testutil.ToFloat64(m.tasksFinished.WithLabelValues("cancelled")), 1},
+		{"ok clicks", testutil.ToFloat64(m.toolCalls.WithLabelValues("click", "ok")), 1},
+		{"failed clicks", testutil.ToFloat64(m.toolCalls.WithLabelValues("click", "error")), 1},
+		{"prompt tokens", testutil.ToFloat64(m.modelTokens.WithLabelValues("prompt")), 100},
+		{"completion tokens", testutil.ToFloat64(m.modelTokens.WithLabelValues("completion")), 20},
+		{"model retries", testutil.ToFloat64(m.modelRecoveries.WithLabelValues("retry")), 1},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, c.got)
+		}
+	}
+}
+
+// MockVectorStore implements ports.VectorStore and does nothing.
+type MockVectorStore struct{}
+
+func (MockVectorStore) Save(ctx context.Context, fragment *domain.MemoryFragment) error { return nil }
+func (MockVectorStore) Search(ctx context.Context, queryVector []float32, limit int) ([]domain.MemoryFragment, error) {
+	return nil, nil
+}
+
+func TestInstrumentVectorStore(t *testing.T) {
+	m := New()
+	store := m.InstrumentVectorStore(MockVectorStore{})
+	store.Search(context.Background(), []float32{1}, 5)
+	store.Search(context.Background(), []float32{1}, 5)
+
+	if n := testutil.CollectAndCount(m.vectorLatency, "kortex_vector_store_duration_seconds"); n != 1 {
+		t.Errorf("Expected one search series, got %d", n)
+	}
+	m.WatchBrowserContexts(func() int { return 1 })
+	if n, _ := testutil.GatherAndCount(m.Registry, "kortex_browser_contexts_open"); n != 1 {
+		t.Errorf("Expected the browser contexts gauge, got %d series", n)
+	}
+}
@@ -0,0 +1,190 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Detector finds one kind of sensitive data in text.
+// Validate, if set, gets a second look at each match to weed out false positives
+// (for example, a 16-digit order number that isn't a real card number).
+type Detector struct {
+	Name     string
+	Pattern  *regexp.Regexp
+	Validate func(match string) bool
+}
+
+// Built-in detectors. Order matters: API keys and cards run before phone numbers,
+// otherwise a card number would be half-eaten by the phone pattern first.
+var (
+	APIKeyDetector = Detector{
+		Name: "api_key",
+		Pattern: regexp.MustCompile(`(?i:bearer\s+[A-Za-z0-9._~+/=-]{20,})|` +
+			`\b(?:sk-[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_-]{35}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abposr]-[A-Za-z0-9-]{10,})`),
+	}
+	EmailDetector = Detector{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	}
+	CardDetector = Detector{
+		Name:     "card",
+		Pattern:  regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		Validate: luhnValid,
+	}
+	PhoneDetector = Detector{
+		Name:     "phone",
+		Pattern:  regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{1,4}\)[\s.-]?)?\d{2,4}[\s.-]\d{3,4}(?:[\s.-]\d{2,4})?`),
+		Validate: func(m string) bool { return countDigits(m) >= 7 },
+	}
+)
+
+// DefaultDetectors is what New uses before adding any custom patterns.
+var DefaultDetectors = []Detector{APIKeyDetector, EmailDetector, CardDetector, PhoneDetector}
+
+// Redactor replaces sensitive data with markers like "[REDACTED:email]".
+// It runs before anything is written to the flight recorder or long-term memory,
+// and optionally before page content is shown to the model.
+type Redactor struct {
+	detectors []Detector
+}
+
+// New creates a redactor with the default detectors plus any custom regexes
+// (reported as "[REDACTED:custom]").
+func New(customPatterns []string) (*Redactor, error) {
+	r := &Redactor{detectors: append([]Detector(nil), DefaultDetectors...)}
+	for _, pattern := range customPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", pattern, err)
+		}
+		r.detectors = append(r.detectors, Detector{Name: "custom", Pattern: re})
+	}
+	return r, nil
+}
+
+// NewFromFile creates a redactor with custom patterns read from a file, one regex
+// per line. Blank lines and lines starting with "#" are ignored. An empty path
+// means "default detectors only".
+func NewFromFile(path string) (*Redactor, error) {
+	if path == "" {
+		return New(nil)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read redaction patterns: %v", err)
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return New(patterns)
+}
+
+// Redact implements ports.Redactor.
+func (r *Redactor) Redact(text string) string {
+	for _, d := range r.detectors {
+		text = d.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if d.Validate != nil && !d.Validate(match) {
+				return match
+			}
+			return "[REDACTED:" + d.Name + "]"
+		})
+	}
+	return text
+}
+
+// RedactValue redacts every string inside an arbitrary value (struct, map, slice...).
+// It works on a JSON copy, so the original is never modified; the result is
+// the generic JSON form (maps and slices), which is what loggers write anyway.
+func (r *Redactor) RedactValue(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return v
+	}
+	return r.walk(generic)
+}
+
+func (r *Redactor) walk(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return r.Redact(val)
+	case map[string]interface{}:
+		for k, child := range val {
+			val[k] = r.walk(child)
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = r.walk(child)
+		}
+	}
+	return v
+}
+
+var (
+	defaultMu       sync.RWMutex
+	defaultRedactor = &Redactor{detectors: DefaultDetectors}
+)
+
+// Default returns the process-wide redactor. Until SetDefault is called it uses
+// only the built-in detectors.
+func Default() *Redactor {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultRedactor
+}
+
+// SetDefault replaces the process-wide redactor, e.g. to add custom patterns at startup.
+func SetDefault(r *Redactor) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultRedactor = r
+}
+
+// luhnValid runs the checksum every real card number passes.
+func luhnValid(number string) bool {
+	digits := strings.Map(func(c rune) rune {
+		if c >= '0' && c <= '9' {
+			return c
+		}
+		return -1
+	}, number)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,211 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultSearchLimit caps searches that don't set their own limit.
+const DefaultSearchLimit = 100
+
+// RecordIndex implements ports.RecordIndex. It keeps a copy of every flight record
+// in SQLite, with the fields people filter on (task, session, kind, tool, time, error)
+// in their own indexed columns and the full record as JSON next to them.
+// The JSONL file stays the source of truth; this is just the card catalogue.
+type RecordIndex struct {
+	db *gorm.DB
+}
+
+// flightRecordRow is how a record is stored.
+type flightRecordRow struct {
+	ID        string `gorm:"primaryKey"` // Hash of the record, so indexing the same file twice adds nothing
+	At        int64  `gorm:"index"`      // Unix milliseconds (sorts and compares reliably in SQLite)
+	TaskID    string `gorm:"index"`
+	SessionID string `gorm:"index"`
+	Step      int
+	Kind      string `gorm:"index"`
+	Tool      string `gorm:"index"`
+	Error     string
+	Goal      string // Only set on "task_start" records, for the task list
+	Data      string // The whole record as JSON
+}
+
+func (flightRecordRow) TableName() string { return "flight_records" }
+
+// NewRecordIndex opens (or creates) the index in the database at dbPath.
+// It can share a file with the vector store.
+func NewRecordIndex(dbPath string) (*RecordIndex, error) {
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := db.AutoMigrate(&flightRecordRow{}); err != nil {
+		return nil, fmt.Errorf("failed to auto migrate: %w", err)
+	}
+	return &RecordIndex{db: db}, nil
+}
+
+// Record adds one record to the index. It implements ports.Recorder, so the
+// flight recorder can hand every record it writes straight to the index.
+func (r *RecordIndex) Record(ctx context.Context, rec domain.FlightRecord) error {
+	return r.Index(ctx, []domain.FlightRecord{rec})
+}
+
+// Index adds many records at once, e.g. when importing an old JSONL file.
+// Records that are already indexed are skipped.
+func (r *RecordIndex) Index(ctx context.Context, records []domain.FlightRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	rows := make([]flightRecordRow, 0, len(records))
+	for _, rec := range records {
+		row, err := toRow(rec)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+	err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(rows, 200).Error
+	if err != nil {
+		return fmt.Errorf("failed to index flight records: %w", err)
+	}
+	return nil
+}
+
+func toRow(rec domain.FlightRecord) (flightRecordRow, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return flightRecordRow{}, fmt.Errorf("could not encode flight record: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	row := flightRecordRow{
+		ID:        hex.EncodeToString(sum[:16]),
+		At:        rec.Time.UnixMilli(),
+		TaskID:    rec.TaskID,
+		SessionID: rec.SessionID,
+		Step:      rec.Step,
+		Kind:      rec.Kind,
+		Tool:      rec.Tool,
+		Error:     rec.Error,
+		Data:      string(data),
+	}
+	if details, ok := rec.Details.(map[string]any); ok && rec.Kind == "task_start" {
+		row.Goal, _ = details["goal"].(string)
+	}
+	return row, nil
+}
+
+// Timeline returns every record of one task, oldest first.
+func (r *RecordIndex) Timeline(ctx context.Context, taskID string) ([]domain.FlightRecord, error) {
+	var rows []flightRecordRow
+	err := r.db.WithContext(ctx).
+		Where("task_id = ?", taskID).
+		Order("at, step").
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load task timeline: %w", err)
+	}
+	return fromRows(rows)
+}
+
+// Search finds records matching the query, newest first.
+func (r *RecordIndex) Search(ctx context.Context, q domain.RecordQuery) ([]domain.FlightRecord, error) {
+	db := r.db.WithContext(ctx)
+	if q.TaskID != "" {
+		db = db.Where("task_id = ?", q.TaskID)
+	}
+	if q.SessionID != "" {
+		db = db.Where("session_id = ?", q.SessionID)
+	}
+	if q.Kind != "" {
+		db = db.Where("kind = ?", q.Kind)
+	}
+	if q.Tool != "" {
+		db = db.Where("tool = ?", q.Tool)
+	}
+	if q.ErrorsOnly {
+		db = db.Where("error <> ''")
+	}
+	if !q.Since.IsZero() {
+		db = db.Where("at >= ?", q.Since.UnixMilli())
+	}
+	if !q.Until.IsZero() {
+		db = db.Where("at < ?", q.Until.UnixMilli())
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	var rows []flightRecordRow
+	if err := db.Order("at DESC, step DESC").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to search flight records: %w", err)
+	}
+	return fromRows(rows)
+}
+
+// Tasks lists the most recent tasks, newest first.
+func (r *RecordIndex) Tasks(ctx context.Context, limit int) ([]domain.TaskSummary, error) {
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	// One row per task: when it started, how many tool calls it made and how it ended
+	query := `
+		SELECT task_id,
+		       MAX(goal) AS goal,
+		       MIN(at) AS started_at,
+		       SUM(CASE WHEN kind = 'tool' THEN 1 ELSE 0 END) AS steps,
+		       MAX(CASE WHEN kind = 'task_end' THEN 1 ELSE 0 END) AS done,
+		       MAX(CASE WHEN kind = 'task_end' THEN error ELSE '' END) AS error
+		FROM flight_records
+		WHERE task_id <> ''
+		GROUP BY task_id
+		ORDER BY started_at DESC
+		LIMIT ?
+	`
+	var rows []struct {
+		TaskID    string
+		Goal      string
+		StartedAt int64
+		Steps     int
+		Done      bool
+		Error     string
+	}
+	if err := r.db.WithContext(ctx).Raw(query, limit).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+
+	tasks := make([]domain.TaskSummary, len(rows))
+	for i, row := range rows {
+		tasks[i] = domain.TaskSummary{
+			TaskID:    row.TaskID,
+			Goal:      row.Goal,
+			StartedAt: time.UnixMilli(row.StartedAt),
+			Steps:     row.Steps,
+			Done:      row.Done,
+			Error:     row.Error,
+		}
+	}
+	return tasks, nil
+}
+
+func fromRows(rows []flightRecordRow) ([]domain.FlightRecord, error) {
+	records := make([]domain.FlightRecord, len(rows))
+	for i, row := range rows {
+		if err := json.Unmarshal([]byte(row.Data), &records[i]); err != nil {
+			return nil, fmt.Errorf("corrupt flight record %s: %w", row.ID, err)
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+)
+
+func TestRecordIndex(t *testing.T) {
+	ctx := context.Background()
+	index, err := NewRecordIndex(filepath.Join(t.TempDir(), "kortex.db"))
+	if err != nil {
+		t.Fatalf("NewRecordIndex failed: %v", err)
+	}
+
+	start := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	records := []domain.FlightRecord{
+		{Time: at(0), TaskID: "t1", SessionID: "s1", Kind: "task_start", Details: map[string]any{"goal": "log in"}},
+		{Time: at(1), TaskID: "t1", SessionID: "s1", Step: 1, Kind: "tool", Tool: "navigate"},
+		{Time: at(2), TaskID: "t1", SessionID: "s1", Step: 2, Kind: "tool", Tool: "click", Error: "element not found"},
+		{Time: at(3), TaskID: "t1", SessionID: "s1", Kind: "task_end", Error: "gave up"},
+		{Time: at(10), TaskID: "t2", SessionID: "s2", Kind: "task_start", Details: map[string]any{"goal": "search"}},
+		{Time: at(11), TaskID: "t2", SessionID: "s2", Step: 1, Kind: "tool", Tool: "click"},
+	}
+	if err := index.Index(ctx, records); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	// Indexing the same records again (e.g. re-importing a file) adds nothing
+	if err := index.Index(ctx, records); err != nil {
+		t.Fatalf("Second Index failed: %v", err)
+	}
+
+	timeline, err := index.Timeline(ctx, "t1")
+	if err != nil {
+		t.Fatalf("Timeline failed: %v", err)
+	}
+	if len(timeline) != 4 || timeline[0].Kind != "task_start" || timeline[3].Kind != "task_end" {
+		t.Errorf("Unexpected timeline: %+v", timeline)
+	}
+
+	clicks, _ := index.Search(ctx, domain.RecordQuery{Tool: "click"})
+	if len(clicks) != 2 || clicks[0].TaskID != "t2" {
+		t.Errorf("Expected 2 clicks, newest first, got %+v", clicks)
+	}
+	failed, _ := index.Search(ctx, domain.RecordQuery{Kind: "tool", ErrorsOnly: true})
+	if len(failed) != 1 || failed[0].Error != "element not found" {
+		t.Errorf("Expected the failed click, got %+v", failed)
+	}
+	recent, _ := index.Search(ctx, domain.RecordQuery{Since: at(5), SessionID: "s2"})
+	if len(recent) != 2 {
+		t.Errorf("Expected 2 records from session s2, got %d", len(recent))
+	}
+
+	tasks, err := index.Tasks(ctx, 10)
+	if err != nil {
+		t.Fatalf("Tasks failed: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("Expected 2 tasks, got %d", len(tasks))
+	}
+	if tasks[0].TaskID != "t2" || tasks[0].Done || tasks[0].Goal != "search" {
+		t.Errorf("Unexpected running task: %+v", tasks[0])
+	}
+	if tasks[1].Steps != 2 || !tasks[1].Done || tasks[1].Error != "gave up" || !tasks[1].StartedAt.Equal(start) {
+		t.Errorf("Unexpected finished task: %+v", tasks[1])
+	}
+}
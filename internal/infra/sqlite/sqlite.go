@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/ports"
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
 )
@@ -13,7 +14,8 @@ import (
 // SQLiteVectorStore implements the VectorStore interface using a local SQLite database.
 // It uses the 'sqlite-vec' extension (conceptually) to perform vector similarity searches.
 type SQLiteVectorStore struct {
-	db *gorm.DB // The GORM database connection
+	db       *gorm.DB       // The GORM database connection
+	redactor ports.Redactor // Scrubs personal data before it is stored (nil = store as-is)
 }
 
 // NewSQLiteVectorStore opens or creates the database file.
@@ -38,8 +40,34 @@ func NewSQLiteVectorStore(dbPath string) (*SQLiteVectorStore, error) {
 	return &SQLiteVectorStore{db: db}, nil
 }
 
+// SetRedactor makes Save scrub personal data (emails, card numbers...) from memories.
+// Long-term memory outlives any single task, so it should never hold raw PII.
+func (s *SQLiteVectorStore) SetRedactor(r ports.Redactor) {
+	s.redactor = r
+}
+
+// Ping checks that the database is reachable, for health checks.
+func (s *SQLiteVectorStore) Ping(ctx context.Context) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get database handle: %w", err)
+	}
+	return sqlDB.PingContext(ctx)
+}
+
 // Save stores a memory fragment in the database.
+// If a redactor is set, the fragment's Content and Tags are redacted in place before saving.
+// The Embedding must already be of the redacted text: a vector computed from the raw
+// content still carries the personal data, so such a fragment is refused, not stored.
 func (s *SQLiteVectorStore) Save(ctx context.Context, fragment *domain.MemoryFragment) error {
+	if s.redactor != nil {
+		content := s.redactor.Redact(fragment.Content)
+		if content != fragment.Content && len(fragment.Embedding) > 0 {
+			return fmt.Errorf("memory was embedded before its personal data was redacted; redact the content, then embed it")
+		}
+		fragment.Content = content
+		fragment.Tags = s.redactor.Redact(fragment.Tags)
+	}
 	return s.db.WithContext(ctx).Create(fragment).Error
 }
 
@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/PundarikakshNTripathi/Kortex/internal/infra/redact"
+)
+
+func TestSaveRedactsMemories(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewSQLiteVectorStore(filepath.Join(t.TempDir(), "kortex.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteVectorStore failed: %v", err)
+	}
+	redactor, err := redact.New(nil)
+	if err != nil {
+		t.Fatalf("redact.New failed: %v", err)
+	}
+	store.SetRedactor(redactor)
+
+	// Content and tags are both scrubbed before they reach the database
+	fragment := &domain.MemoryFragment{
+		Content: "Alice's email is alice@example.com",
+		Tags:    `["contact", "alice@example.com"]`,
+	}
+	if err := store.Save(ctx, fragment); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	var saved domain.MemoryFragment
+	if err := store.db.First(&saved, "id = ?", fragment.ID).Error; err != nil {
+		t.Fatalf("Reading the memory back failed: %v", err)
+	}
+	if strings.Contains(saved.Content, "alice@example.com") || strings.Contains(saved.Tags, "alice@example.com") {
+		t.Errorf("Expected the email to be redacted, got content %q and tags %q", saved.Content, saved.Tags)
+	}
+
+	// A vector computed from the raw text would still encode the email, so it is refused
+	raw := &domain.MemoryFragment{Content: "Call bob@example.com", Embedding: []float32{0.1, 0.2}}
+	if err := store.Save(ctx, raw); err == nil {
+		t.Error("Expected a memory embedded before redaction to be refused")
+	}
+	// ...while one embedded from clean text is stored as it is
+	clean := &domain.MemoryFragment{Content: "Prefers window seats", Embedding: []float32{0.1, 0.2}}
+	if err := store.Save(ctx, clean); err != nil {
+		t.Errorf("Save of a memory with nothing to redact failed: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UsageStore implements ports.UsageStore: one row per task with its token count and cost.
+type UsageStore struct {
+	db *gorm.DB
+}
+
+// NewUsageStore opens (or creates) the usage table in the database at dbPath.
+// It can share a file with the vector store.
+func NewUsageStore(dbPath string) (*UsageStore, error) {
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := db.AutoMigrate(&domain.TaskUsage{}); err != nil {
+		return nil, fmt.Errorf("failed to auto migrate: %w", err)
+	}
+	return &UsageStore{db: db}, nil
+}
+
+// SaveUsage creates or replaces the usage row of one task.
+func (s *UsageStore) SaveUsage(ctx context.Context, usage domain.TaskUsage) error {
+	// Times are compared as text in SQLite, so keep them all in one time zone
+	usage.StartedAt = usage.StartedAt.UTC()
+	err := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&usage).Error
+	if err != nil {
+		return fmt.Errorf("failed to save usage: %w", err)
+	}
+	return nil
+}
+
+// UsageSince totals every task started at or after since.
+func (s *UsageStore) UsageSince(ctx context.Context, since time.Time) (domain.TaskUsage, error) {
+	return s.total(s.db.WithContext(ctx).Where("started_at >= ?", since.UTC()))
+}
+
+// SessionUsage totals every task of one session.
+func (s *UsageStore) SessionUsage(ctx context.Context, sessionID string) (domain.TaskUsage, error) {
+	total, err := s.total(s.db.WithContext(ctx).Where("session_id = ?", sessionID))
+	total.SessionID = sessionID
+	return total, err
+}
+
+func (s *UsageStore) total(db *gorm.DB) (domain.TaskUsage, error) {
+	var total domain.TaskUsage
+	err := db.Model(&domain.TaskUsage{}).
+		Select(`COALESCE(SUM(model_calls), 0) AS model_calls,
+			COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens,
+			COALESCE(SUM(completion_tokens), 0) AS completion_tokens,
+			COALESCE(SUM(total_tokens), 0) AS total_tokens,
+			COALESCE(SUM(cost_usd), 0) AS cost_usd`).
+		Scan(&total).Error
+	if err != nil {
+		return total, fmt.Errorf("failed to total usage: %w", err)
+	}
+	return total, nil
+}
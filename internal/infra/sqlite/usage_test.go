@@ -0,0 +1,47 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+)
+
+func TestUsageStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewUsageStore(filepath.Join(t.TempDir(), "kortex.db"))
+	if err != nil {
+		t.Fatalf("NewUsageStore failed: %v", err)
+	}
+
+	now := time.Now()
+	yesterday := now.Add(-24 * time.Hour)
+	store.SaveUsage(ctx, domain.TaskUsage{TaskID: "old", SessionID: "s1", StartedAt: yesterday, TotalTokens: 1000, CostUSD: 1})
+	store.SaveUsage(ctx, domain.TaskUsage{TaskID: "t1", SessionID: "s1", StartedAt: now, TotalTokens: 100, CostUSD: 0.1})
+	// Saving again updates the task's row instead of adding one
+	store.SaveUsage(ctx, domain.TaskUsage{TaskID: "t1", SessionID: "s1", StartedAt: now, TotalTokens: 300, CostUSD: 0.3, ModelCalls: 2})
+	store.SaveUsage(ctx, domain.TaskUsage{TaskID: "t2", SessionID: "s2", StartedAt: now, TotalTokens: 50, CostUSD: 0.05})
+
+	today, err := store.UsageSince(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("UsageSince failed: %v", err)
+	}
+	if today.TotalTokens != 350 || today.ModelCalls != 2 {
+		t.Errorf("Expected 350 tokens over 2 calls today, got %+v", today)
+	}
+
+	session, err := store.SessionUsage(ctx, "s1")
+	if err != nil {
+		t.Fatalf("SessionUsage failed: %v", err)
+	}
+	if session.TotalTokens != 1300 || session.CostUSD < 1.29 || session.CostUSD > 1.31 {
+		t.Errorf("Expected 1300 tokens and $1.30 for session s1, got %+v", session)
+	}
+
+	empty, err := store.UsageSince(ctx, now.Add(time.Hour))
+	if err != nil || empty.TotalTokens != 0 {
+		t.Errorf("Expected no usage in the future, got %+v (%v)", empty, err)
+	}
+}
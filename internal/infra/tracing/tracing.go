@@ -0,0 +1,138 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing sends OpenTelemetry spans for every task, model turn and tool call to a
+// tracing backend (Jaeger, Tempo, Honeycomb...), so a slow or failed task can be
+// followed step by step next to the services that asked for it.
+//
+// The agent always creates spans through the global otel API. Until Setup installs
+// an exporter they go nowhere and cost next to nothing.
+
+// Exporters that Setup understands. The names follow OTEL_TRACES_EXPORTER.
+const (
+	ExporterNone    = "none"    // Tracing off (the default)
+	ExporterOTLP    = "otlp"    // OTLP over HTTP; endpoint and headers come from the standard OTEL_EXPORTER_OTLP_* variables
+	ExporterConsole = "console" // Pretty-printed JSON on stdout, for a quick look
+	ExporterFile    = "file"    // One JSON span per line in a file, for offline use
+)
+
+// DefaultServiceName is used unless OTEL_SERVICE_NAME says otherwise.
+const DefaultServiceName = "kortex"
+
+// Options configures Setup.
+type Options struct {
+	Exporter string // One of the Exporter* constants ("stdout" is accepted for "console")
+	File     string // Where ExporterFile writes (default "kortex_traces.jsonl")
+}
+
+// Setup installs the global tracer provider and the W3C trace-context propagator.
+// The returned function flushes any buffered spans; call it on shutdown.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	// Propagation works even with tracing off, so incoming trace IDs still reach the flight recorder
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, closer, err := newExporter(ctx, opts)
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+
+	// Later detectors win, so OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override our defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(DefaultServiceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not build trace resource: %w", err)
+	}
+
+	// The sampler can be changed with OTEL_TRACES_SAMPLER / OTEL_TRACES_SAMPLER_ARG
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+		return err
+	}, nil
+}
+
+// newExporter builds the exporter named in opts. It returns nil when tracing is off.
+func newExporter(ctx context.Context, opts Options) (sdktrace.SpanExporter, io.Closer, error) {
+	switch strings.ToLower(opts.Exporter) {
+	case "", ExporterNone:
+		return nil, nil, nil
+	case ExporterOTLP:
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not create OTLP exporter: %w", err)
+		}
+		return exporter, nil, nil
+	case ExporterConsole, "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exporter, nil, err
+	case ExporterFile:
+		path := opts.File
+		if path == "" {
+			path = "kortex_traces.jsonl"
+		}
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not open trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return exporter, f, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q (use otlp, console, file or none)", opts.Exporter)
+	}
+}
+
+// Headers are the request headers that carry trace context between services.
+var Headers = []string{"traceparent", "tracestate", "baggage"}
+
+// Extract continues a trace started by whoever sent the request. headers holds
+// the W3C "traceparent" (and optionally "tracestate" and "baggage") values.
+func Extract(ctx context.Context, headers map[string]string) context.Context {
+	carrier := propagation.MapCarrier{}
+	for k, v := range headers {
+		if v != "" {
+			carrier[strings.ToLower(k)] = v
+		}
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// TraceID returns the ID of the trace ctx belongs to, or "" if there is none.
+// Clients can use it to find a task in their tracing backend.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestFileExporterWritesSpans(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+
+	shutdown, err := Setup(context.Background(), Options{Exporter: ExporterFile, File: path})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "kortex.task")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"Name":"kortex.task"`) {
+		t.Errorf("Expected the span in the trace file, got %q", data)
+	}
+}
+
+func TestExtractContinuesCallersTrace(t *testing.T) {
+	Setup(context.Background(), Options{Exporter: ExporterNone})
+
+	ctx := Extract(context.Background(), map[string]string{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	})
+	if got := TraceID(ctx); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the caller's trace ID, got %q", got)
+	}
+	if got := TraceID(context.Background()); got != "" {
+		t.Errorf("Expected no trace ID without a trace, got %q", got)
+	}
+}
+
+func TestUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Options{Exporter: "carrier-pigeon"}); err == nil {
+		t.Error("Expected an error for an unknown exporter")
+	}
+}
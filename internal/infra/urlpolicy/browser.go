@@ -0,0 +1,98 @@
+package urlpolicy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/ports"
+)
+
+// RequestFilterer is implemented by browsers that can veto individual network requests
+// (e.g. PlaywrightBrowser via context routing). It lets the policy catch navigations the
+// page makes by itself: link clicks, form posts and sub-resource fetches. Redirects are
+// only covered if the browser checks every hop itself (PlaywrightBrowser does for page
+// navigations); Navigate also checks where the page ended up.
+type RequestFilterer interface {
+	SetRequestFilter(filter func(url string) error)
+}
+
+// GuardedBrowser wraps a ports.Browser and enforces URL policies on every navigation.
+// There is always a global policy, and optionally a stricter per-task policy on top:
+// a URL must pass both.
+type GuardedBrowser struct {
+	ports.Browser // Every method we don't override goes straight through
+
+	global *Checker
+	mu     sync.RWMutex
+	task   *Checker
+}
+
+// NewGuardedBrowser wraps browser with the given global policy.
+// If the browser supports request filtering, in-page navigations are checked too.
+func NewGuardedBrowser(browser ports.Browser, global Policy) (*GuardedBrowser, error) {
+	checker, err := global.Compile()
+	if err != nil {
+		return nil, err
+	}
+	g := &GuardedBrowser{Browser: browser, global: checker}
+
+	if f, ok := browser.(RequestFilterer); ok {
+		f.SetRequestFilter(func(url string) error {
+			return g.Check(context.Background(), url)
+		})
+	}
+	return g, nil
+}
+
+// SetTaskPolicy adds a per-task policy on top of the global one. Pass nil to clear it.
+func (g *GuardedBrowser) SetTaskPolicy(policy *Policy) error {
+	var checker *Checker
+	if policy != nil {
+		var err error
+		if checker, err = policy.Compile(); err != nil {
+			return err
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.task = checker
+	return nil
+}
+
+// Check runs the URL through the global policy and then the task policy, if any.
+func (g *GuardedBrowser) Check(ctx context.Context, url string) error {
+	if err := g.global.Check(ctx, url); err != nil {
+		return err
+	}
+
+	g.mu.RLock()
+	task := g.task
+	g.mu.RUnlock()
+	if task != nil {
+		return task.Check(ctx, url)
+	}
+	return nil
+}
+
+// Navigate checks the URL before letting the real browser go there, and checks where
+// it ended up afterwards: a redirect may have taken it somewhere else. A page that isn't
+// allowed is left for about:blank.
+func (g *GuardedBrowser) Navigate(url string) error {
+	if err := g.Check(context.Background(), url); err != nil {
+		return err
+	}
+	if err := g.Browser.Navigate(url); err != nil {
+		return err
+	}
+	landed, err := g.Browser.CurrentURL()
+	if err != nil || landed == url {
+		return err
+	}
+	if err := g.Check(context.Background(), landed); err != nil {
+		g.Browser.Navigate("about:blank")
+		return fmt.Errorf("%s redirected to a page that isn't allowed: %v", url, err)
+	}
+	return nil
+}
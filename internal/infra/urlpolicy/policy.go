@@ -0,0 +1,275 @@
+package urlpolicy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PrivateNetworks lists the address ranges that belong to "this machine" or "this LAN".
+// Letting an agent on a server browse these would expose internal services, so the
+// keyword "private" in a deny list expands to all of them.
+var PrivateNetworks = []string{
+	"127.0.0.0/8",    // Loopback
+	"10.0.0.0/8",     // Private LAN
+	"172.16.0.0/12",  // Private LAN (also Docker's default bridge range)
+	"192.168.0.0/16", // Private LAN
+	"169.254.0.0/16", // Link-local (cloud metadata endpoints live here)
+	"100.64.0.0/10",  // Carrier-grade NAT
+	"0.0.0.0/8",      // "This network"
+	"::1/128",        // IPv6 loopback
+	"fc00::/7",       // IPv6 unique local
+	"fe80::/10",      // IPv6 link-local
+}
+
+// DefaultSchemes are the URL schemes allowed when a policy doesn't list any.
+var DefaultSchemes = []string{"http", "https", "about"}
+
+// Policy decides which URLs the agent may visit.
+// Each entry in Allow/Deny is either a host glob ("*.example.com"), a CIDR ("10.0.0.0/8"),
+// the keyword "private" (see PrivateNetworks) or a scheme ending in a colon ("file:").
+// Deny always wins. If Allow is empty, everything not denied is allowed.
+type Policy struct {
+	Allow   []string `json:"allow,omitempty"`
+	Deny    []string `json:"deny,omitempty"`
+	Schemes []string `json:"schemes,omitempty"` // Allowed schemes; defaults to DefaultSchemes
+}
+
+// Error is returned when a URL is blocked. The message is written for the agent:
+// it says what was blocked and why, so the model can pick a different route.
+type Error struct {
+	URL    string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("blocked by URL policy: %s (%s)", e.URL, e.Reason)
+}
+
+// Resolver looks up the IP addresses of a host name. Swappable for tests.
+type Resolver func(ctx context.Context, host string) ([]net.IP, error)
+
+// defaultResolver uses the system DNS with a short timeout so a slow lookup can't stall the agent.
+func defaultResolver(ctx context.Context, host string) ([]net.IP, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	return ips, nil
+}
+
+// DNS answers are cached so page sub-requests don't each hit DNS. Entries expire so a
+// host that moves (or is re-pointed at a private address) is looked up again.
+const (
+	dnsCacheTTL  = time.Minute
+	dnsCacheSize = 1024 // Most hosts kept at once; a page pulling from many domains can't grow it forever
+)
+
+// dnsEntry is one cached DNS answer.
+type dnsEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// ruleSet is one list (allow or deny) split by kind and compiled.
+type ruleSet struct {
+	hosts   []*regexp.Regexp
+	nets    []*net.IPNet
+	schemes map[string]bool
+}
+
+// Checker is a compiled Policy, ready to evaluate URLs quickly.
+type Checker struct {
+	allow    ruleSet
+	deny     ruleSet
+	schemes  map[string]bool
+	resolver Resolver
+
+	mu       sync.Mutex
+	dnsCache map[string]dnsEntry // host -> addresses, see dnsCacheTTL
+}
+
+// Compile validates the policy and prepares it for checking.
+func (p Policy) Compile() (*Checker, error) {
+	c := &Checker{schemes: map[string]bool{}, resolver: defaultResolver, dnsCache: map[string]dnsEntry{}}
+
+	var err error
+	if c.allow, err = compileRules(p.Allow); err != nil {
+		return nil, err
+	}
+	if c.deny, err = compileRules(p.Deny); err != nil {
+		return nil, err
+	}
+
+	schemes := p.Schemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+	for _, s := range schemes {
+		c.schemes[strings.ToLower(strings.TrimSuffix(s, ":"))] = true
+	}
+	return c, nil
+}
+
+// WithResolver returns the checker using a custom DNS resolver (mainly for tests).
+func (c *Checker) WithResolver(r Resolver) *Checker {
+	c.resolver = r
+	return c
+}
+
+// lookup resolves host, using the cache when it has a fresh answer. Failed lookups aren't cached.
+func (c *Checker) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.dnsCache[host]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.ips, nil
+	}
+
+	ips, err := c.resolver(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.dnsCache) >= dnsCacheSize {
+		// Drop what has expired; if that isn't enough, drop arbitrary entries (map order is random)
+		for h, e := range c.dnsCache {
+			if now.After(e.expires) {
+				delete(c.dnsCache, h)
+			}
+		}
+		for h := range c.dnsCache {
+			if len(c.dnsCache) < dnsCacheSize {
+				break
+			}
+			delete(c.dnsCache, h)
+		}
+	}
+	c.dnsCache[host] = dnsEntry{ips: ips, expires: now.Add(dnsCacheTTL)}
+	return ips, nil
+}
+
+func compileRules(entries []string) (ruleSet, error) {
+	rs := ruleSet{schemes: map[string]bool{}}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(strings.ToLower(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "private":
+			for _, cidr := range PrivateNetworks {
+				_, n, _ := net.ParseCIDR(cidr)
+				rs.nets = append(rs.nets, n)
+			}
+		case strings.HasSuffix(entry, ":"):
+			rs.schemes[strings.TrimSuffix(entry, ":")] = true
+		case strings.Contains(entry, "/"):
+			_, n, err := net.ParseCIDR(entry)
+			if err != nil {
+				return rs, fmt.Errorf("invalid CIDR %q: %v", entry, err)
+			}
+			rs.nets = append(rs.nets, n)
+		default:
+			re, err := hostGlob(entry)
+			if err != nil {
+				return rs, err
+			}
+			rs.hosts = append(rs.hosts, re)
+		}
+	}
+	return rs, nil
+}
+
+// hostGlob turns "*.example.com" into a regexp. "*" matches any run of characters,
+// so "*.example.com" matches "a.b.example.com" but not "example.com" itself.
+func hostGlob(glob string) (*regexp.Regexp, error) {
+	pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(glob), `\*`, ".*") + "$"
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host pattern %q: %v", glob, err)
+	}
+	return re, nil
+}
+
+// Check returns nil if the URL is allowed, or an *Error explaining why not.
+func (c *Checker) Check(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return &Error{URL: rawURL, Reason: "URL could not be parsed"}
+	}
+	scheme := strings.ToLower(u.Scheme)
+
+	// 1. Scheme checks (file:, chrome:, javascript: ...)
+	if c.deny.schemes[scheme] {
+		return &Error{URL: rawURL, Reason: fmt.Sprintf("scheme %q is denied", scheme)}
+	}
+	if !c.schemes[scheme] && !c.allow.schemes[scheme] {
+		return &Error{URL: rawURL, Reason: fmt.Sprintf("scheme %q is not allowed", scheme)}
+	}
+
+	// URLs without a host (about:blank, data:) have nothing more to check.
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return nil
+	}
+
+	// 2. Host name globs
+	for _, re := range c.deny.hosts {
+		if re.MatchString(host) {
+			return &Error{URL: rawURL, Reason: fmt.Sprintf("host %s is on the deny list", host)}
+		}
+	}
+
+	// 3. IP ranges. We resolve host names too, otherwise "internal.corp" pointing at
+	// 10.0.0.5 would slip past a "10.0.0.0/8" rule. If the lookup fails we can't tell
+	// where the host points, so we refuse it rather than let it past the ranges.
+	var ips []net.IP
+	if len(c.deny.nets) > 0 || len(c.allow.nets) > 0 {
+		if ip := net.ParseIP(host); ip != nil {
+			ips = []net.IP{ip}
+		} else if resolved, err := c.lookup(ctx, host); err == nil {
+			ips = resolved
+		} else {
+			return &Error{URL: rawURL, Reason: fmt.Sprintf("could not resolve %s to check its address: %v", host, err)}
+		}
+	}
+	for _, ip := range ips {
+		for _, n := range c.deny.nets {
+			if n.Contains(ip) {
+				return &Error{URL: rawURL, Reason: fmt.Sprintf("address %s is in denied range %s", ip, n)}
+			}
+		}
+	}
+
+	// 4. Allow list: if there is one, the URL must match something on it.
+	if len(c.allow.hosts) == 0 && len(c.allow.nets) == 0 {
+		return nil
+	}
+	for _, re := range c.allow.hosts {
+		if re.MatchString(host) {
+			return nil
+		}
+	}
+	for _, ip := range ips {
+		for _, n := range c.allow.nets {
+			if n.Contains(ip) {
+				return nil
+			}
+		}
+	}
+	return &Error{URL: rawURL, Reason: fmt.Sprintf("host %s is not on the allow list", host)}
+}
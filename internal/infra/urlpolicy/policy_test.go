@@ -0,0 +1,211 @@
+package urlpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+)
+
+// fakeResolver pretends every host name resolves to a fixed address.
+func fakeResolver(addrs map[string]string) Resolver {
+	return func(ctx context.Context, host string) ([]net.IP, error) {
+		if a, ok := addrs[host]; ok {
+			return []net.IP{net.ParseIP(a)}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+}
+
+func TestCheckerDenyList(t *testing.T) {
+	checker, err := Policy{Deny: []string{"private", "file:", "*.evil.com"}}.Compile()
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	checker.WithResolver(fakeResolver(map[string]string{"intranet.corp": "10.1.2.3", "example.com": "93.184.216.34"}))
+
+	cases := map[string]bool{
+		"https://example.com/":          true,
+		"about:blank":                   true,
+		"file:///etc/passwd":            false,
+		"http://127.0.0.1:8080/admin":   false,
+		"http://169.254.169.254/latest": false,
+		"http://intranet.corp/wiki":     false, // resolves into 10.0.0.0/8
+		"https://ads.evil.com/x.js":     false,
+		"javascript:alert(1)":           false, // not in the default schemes
+	}
+	for url, allowed := range cases {
+		err := checker.Check(context.Background(), url)
+		if allowed && err != nil {
+			t.Errorf("%s should be allowed, got %v", url, err)
+		}
+		if !allowed && err == nil {
+			t.Errorf("%s should be blocked", url)
+		}
+	}
+}
+
+func TestCheckerAllowList(t *testing.T) {
+	checker, err := Policy{Allow: []string{"*.wikipedia.org", "wikipedia.org"}}.Compile()
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	if err := checker.Check(context.Background(), "https://en.wikipedia.org/wiki/Go"); err != nil {
+		t.Errorf("Wikipedia should be allowed, got %v", err)
+	}
+
+	err = checker.Check(context.Background(), "https://example.com/")
+	var policyErr *Error
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("Expected a policy error, got %v", err)
+	}
+	if policyErr.Reason != "host example.com is not on the allow list" {
+		t.Errorf("Unexpected reason %q", policyErr.Reason)
+	}
+}
+
+func TestCheckerFailsClosedOnDNSError(t *testing.T) {
+	checker, err := Policy{Deny: []string{"private"}}.Compile()
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	checker.WithResolver(fakeResolver(nil)) // Every lookup fails, e.g. a DNS timeout
+
+	if err := checker.Check(context.Background(), "http://internal.corp/"); err == nil {
+		t.Error("A host that can't be resolved should be blocked while deny ranges are set")
+	}
+	// Literal addresses need no lookup
+	if err := checker.Check(context.Background(), "http://93.184.216.34/"); err != nil {
+		t.Errorf("A public address should be allowed, got %v", err)
+	}
+}
+
+func TestDNSCacheExpiresAndIsBounded(t *testing.T) {
+	checker, err := Policy{Deny: []string{"private"}}.Compile()
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	lookups := 0
+	addr := "93.184.216.34"
+	checker.WithResolver(func(ctx context.Context, host string) ([]net.IP, error) {
+		lookups++
+		return []net.IP{net.ParseIP(addr)}, nil
+	})
+
+	ctx := context.Background()
+	if err := checker.Check(ctx, "https://example.com/a"); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if err := checker.Check(ctx, "https://example.com/b"); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if lookups != 1 {
+		t.Errorf("Expected the second check to use the cache, got %d lookups", lookups)
+	}
+
+	// Once the entry expires the host is looked up again, and its new address is checked
+	checker.dnsCache["example.com"] = dnsEntry{ips: checker.dnsCache["example.com"].ips, expires: time.Now().Add(-time.Second)}
+	addr = "10.0.0.5"
+	if err := checker.Check(ctx, "https://example.com/c"); err == nil {
+		t.Error("Expected the re-pointed host to be blocked after the cache entry expired")
+	}
+
+	for i := 0; i < dnsCacheSize*2; i++ {
+		checker.Check(ctx, fmt.Sprintf("https://host%d.example.com/", i))
+	}
+	if len(checker.dnsCache) > dnsCacheSize {
+		t.Errorf("The DNS cache grew to %d entries, want at most %d", len(checker.dnsCache), dnsCacheSize)
+	}
+}
+
+func TestCompileRejectsBadCIDR(t *testing.T) {
+	if _, err := (Policy{Deny: []string{"10.0.0.0/99"}}).Compile(); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
+// recordingBrowser is a minimal ports.Browser that remembers where it was sent,
+// and where it ended up after any redirects.
+type recordingBrowser struct {
+	navigated string
+	redirects map[string]string
+}
+
+func (b *recordingBrowser) Navigate(url string) error {
+	b.navigated = url
+	if to, ok := b.redirects[url]; ok {
+		b.navigated = to
+	}
+	return nil
+}
+func (b *recordingBrowser) GetSnapshot() (string, error)               { return "", nil }
+func (b *recordingBrowser) ReadPage(int) (*domain.PageChunk, error)    { return &domain.PageChunk{}, nil }
+func (b *recordingBrowser) Highlight(string, string) error             { return nil }
+func (b *recordingBrowser) Click(string) error                         { return nil }
+func (b *recordingBrowser) Type(string, string) error                  { return nil }
+func (b *recordingBrowser) HandleDialog(bool, string) error            { return nil }
+func (b *recordingBrowser) GetPageErrors() ([]domain.PageError, error) { return nil, nil }
+func (b *recordingBrowser) CurrentURL() (string, error)                { return b.navigated, nil }
+func (b *recordingBrowser) DescribeElement(string) (*domain.ElementInfo, error) {
+	return &domain.ElementInfo{}, nil
+}
+
+func TestGuardedBrowserTaskPolicy(t *testing.T) {
+	inner := &recordingBrowser{}
+	guard, err := NewGuardedBrowser(inner, Policy{Deny: []string{"file:"}})
+	if err != nil {
+		t.Fatalf("NewGuardedBrowser failed: %v", err)
+	}
+
+	if err := guard.Navigate("file:///etc/passwd"); err == nil {
+		t.Error("Global policy should block file: URLs")
+	}
+	if inner.navigated != "" {
+		t.Errorf("Blocked URL must not reach the browser, got %s", inner.navigated)
+	}
+
+	// A task policy narrows things further, and is removed afterwards.
+	if err := guard.SetTaskPolicy(&Policy{Allow: []string{"docs.example.com"}}); err != nil {
+		t.Fatalf("SetTaskPolicy failed: %v", err)
+	}
+	if err := guard.Navigate("https://news.example.com/"); err == nil {
+		t.Error("Task policy should block hosts outside its allow list")
+	}
+	if err := guard.Navigate("https://docs.example.com/"); err != nil {
+		t.Errorf("Task policy should allow docs.example.com, got %v", err)
+	}
+
+	guard.SetTaskPolicy(nil)
+	if err := guard.Navigate("https://news.example.com/"); err != nil {
+		t.Errorf("Cleared task policy should allow news.example.com, got %v", err)
+	}
+}
+
+func TestGuardedBrowserChecksWhereRedirectsLead(t *testing.T) {
+	inner := &recordingBrowser{redirects: map[string]string{
+		"https://ok.example.com/":    "http://169.254.169.254/latest/meta-data/",
+		"https://short.example.com/": "https://docs.example.com/",
+	}}
+	guard, err := NewGuardedBrowser(inner, Policy{Deny: []string{"169.254.0.0/16"}})
+	if err != nil {
+		t.Fatalf("NewGuardedBrowser failed: %v", err)
+	}
+	guard.global.WithResolver(fakeResolver(map[string]string{
+		"ok.example.com": "93.184.216.34", "short.example.com": "93.184.216.34", "docs.example.com": "93.184.216.34",
+	}))
+
+	if err := guard.Navigate("https://ok.example.com/"); err == nil {
+		t.Error("Expected a redirect to a denied address to be refused")
+	}
+	if inner.navigated != "about:blank" {
+		t.Errorf("Expected the browser to leave the denied page, got %s", inner.navigated)
+	}
+	if err := guard.Navigate("https://short.example.com/"); err != nil || inner.navigated != "https://docs.example.com/" {
+		t.Errorf("Expected an allowed redirect to load, got %v at %s", err, inner.navigated)
+	}
+}
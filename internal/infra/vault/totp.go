@@ -0,0 +1,89 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTPKey is the vault key that holds a site's authenticator seed, e.g. {{secret:github.com.totp}}.
+// Store the base32 seed shown under "can't scan the QR code?", or the whole otpauth:// URI.
+const TOTPKey = "totp"
+
+// totpPeriod and totpDigits are the defaults every common authenticator app uses.
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+)
+
+// parseSeed accepts a base32 seed ("JBSW Y3DP EHPK 3PXP", any case, with or without
+// spaces/padding) or an otpauth://totp/...?secret=... URI, and returns the raw key bytes.
+func parseSeed(seed string) ([]byte, error) {
+	seed = strings.TrimSpace(seed)
+	if strings.HasPrefix(seed, "otpauth://") {
+		u, err := url.Parse(seed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid otpauth URI: %w", err)
+		}
+		seed = u.Query().Get("secret")
+	}
+
+	seed = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(seed))
+	seed = strings.TrimRight(seed, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(seed)
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("TOTP seed is not valid base32")
+	}
+	return key, nil
+}
+
+// GenerateTOTP computes the RFC 6238 code for a seed at a moment in time
+// (HMAC-SHA1, 30 second steps, 6 digits).
+func GenerateTOTP(seed string, at time.Time) (string, error) {
+	key, err := parseSeed(seed)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(at.Unix()/int64(totpPeriod.Seconds())), totpDigits), nil
+}
+
+// hotp is the RFC 4226 building block: HMAC the counter, then "dynamically truncate"
+// the hash to a 31-bit number and keep its last few decimal digits.
+func hotp(key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, code%mod)
+}
+
+// OTPFor implements ports.OTPGenerator: it is OTP, but only for a page on the site (see CheckSite).
+func (v *Vault) OTPFor(site, host string) (string, error) {
+	if err := v.CheckSite(site, host); err != nil {
+		return "", err
+	}
+	return v.OTP(site)
+}
+
+// OTP returns the current code for a site, or an error if the site has no TOTP seed in the vault.
+func (v *Vault) OTP(site string) (string, error) {
+	seed, err := v.Get(site, TOTPKey)
+	if err != nil {
+		return "", err
+	}
+	return GenerateTOTP(seed, time.Now())
+}
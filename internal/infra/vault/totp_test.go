@@ -0,0 +1,66 @@
+package vault
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The RFC 6238 appendix B test vectors use the ASCII seed "12345678901234567890"
+// and 8 digits; the last 6 digits are what a 6-digit authenticator shows.
+func TestGenerateTOTPRFCVectors(t *testing.T) {
+	seed := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // base32 of "12345678901234567890"
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		got, err := GenerateTOTP(seed, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("GenerateTOTP failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("At %d: expected %s, got %s", unix, want, got)
+		}
+	}
+}
+
+func TestParseSeedFormats(t *testing.T) {
+	for _, seed := range []string{
+		"jbsw y3dp ehpk 3pxp",
+		"JBSWY3DPEHPK3PXP",
+		"otpauth://totp/Example:alice?secret=JBSWY3DPEHPK3PXP&issuer=Example",
+	} {
+		if _, err := parseSeed(seed); err != nil {
+			t.Errorf("%q should parse, got %v", seed, err)
+		}
+	}
+	if _, err := parseSeed("not base32!"); err == nil {
+		t.Error("Expected error for invalid seed")
+	}
+}
+
+func TestVaultOTP(t *testing.T) {
+	v, err := Open(filepath.Join(t.TempDir(), "vault.json"), "pass")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := v.Set("github.com", TOTPKey, "not base32!"); err == nil {
+		t.Error("Expected invalid seed to be rejected")
+	}
+	v.Set("github.com", TOTPKey, "JBSWY3DPEHPK3PXP")
+
+	code, err := v.OTP("github.com")
+	if err != nil {
+		t.Fatalf("OTP failed: %v", err)
+	}
+	if len(code) != 6 {
+		t.Errorf("Expected 6 digit code, got %q", code)
+	}
+	if _, err := v.OTP("gitlab.com"); err == nil {
+		t.Error("Expected error for site without a seed")
+	}
+}
@@ -0,0 +1,321 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PundarikakshNTripathi/Kortex/internal/core/domain"
+	"golang.org/x/crypto/scrypt"
+)
+
+// DefaultPath is where the vault lives when VAULT_PATH is not set.
+const DefaultPath = "./kortex_vault.json"
+
+// ErrWrongKey means the vault file exists but could not be decrypted with the given key.
+var ErrWrongKey = errors.New("could not decrypt vault: wrong passphrase or key file")
+
+// placeholder matches {{secret:site.key}}. The site may contain dots ("github.com"),
+// so the key is whatever follows the LAST dot.
+var placeholder = regexp.MustCompile(`\{\{secret:([^{}]+)\.([^.{}]+)\}\}`)
+
+// Vault is a small encrypted key/value store for credentials, grouped by site.
+//
+// The point is that passwords never have to appear in a goal. The user writes
+// "log in with {{secret:github.password}}", the LLM only ever sees that placeholder,
+// and the type tool swaps in the real value inside Go, right before it reaches the page.
+//
+// On disk the whole store is one JSON document encrypted with AES-256-GCM.
+// The key comes from a passphrase (via scrypt) or, if none is given, from a
+// random key file created next to the vault.
+type Vault struct {
+	path string
+	key  []byte
+	salt []byte // Only used with a passphrase
+
+	mu      sync.Mutex
+	secrets map[string]map[string]string // site -> key -> value
+	aliases map[string][]string          // site -> other hosts its secrets may be typed into
+}
+
+// fileFormat is what we actually write to disk. Only Data is secret.
+type fileFormat struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt,omitempty"` // scrypt salt, if a passphrase is used
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"` // AES-GCM sealed JSON of the secrets map
+}
+
+// Open loads the vault at path, creating an empty one if it doesn't exist yet.
+// With an empty passphrase the key is read from (or written to) path + ".key".
+func Open(path, passphrase string) (*Vault, error) {
+	if path == "" {
+		path = DefaultPath
+	}
+	v := &Vault{path: path, secrets: map[string]map[string]string{}}
+
+	var file *fileFormat
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		file = &fileFormat{}
+		if err := json.Unmarshal(data, file); err != nil {
+			return nil, fmt.Errorf("could not parse vault %s: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("could not read vault: %w", err)
+	}
+
+	if passphrase != "" {
+		v.salt = make([]byte, 16)
+		if file != nil && len(file.Salt) > 0 {
+			v.salt = file.Salt
+		} else if _, err := rand.Read(v.salt); err != nil {
+			return nil, fmt.Errorf("could not generate salt: %w", err)
+		}
+		// These are the scrypt parameters recommended for interactive logins (2017).
+		if v.key, err = scrypt.Key([]byte(passphrase), v.salt, 1<<15, 8, 1, 32); err != nil {
+			return nil, fmt.Errorf("could not derive vault key: %w", err)
+		}
+	} else if v.key, err = loadOrCreateKeyFile(path + ".key"); err != nil {
+		return nil, err
+	}
+
+	if file != nil {
+		plain, err := v.open(file.Nonce, file.Data)
+		if err != nil {
+			return nil, ErrWrongKey
+		}
+		if err := json.Unmarshal(plain, &v.secrets); err != nil {
+			return nil, fmt.Errorf("vault contents are corrupt: %w", err)
+		}
+	}
+	return v, nil
+}
+
+// loadOrCreateKeyFile reads a 32-byte key, or generates one readable only by the current user.
+func loadOrCreateKeyFile(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("vault key file %s is not 32 bytes", path)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read vault key file: %w", err)
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("could not generate vault key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("could not create vault directory: %w", err)
+	}
+	if err := os.WriteFile(path, key, 0o600); err != nil {
+		return nil, fmt.Errorf("could not write vault key file: %w", err)
+	}
+	return key, nil
+}
+
+func (v *Vault) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(v.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (v *Vault) open(nonce, data []byte) ([]byte, error) {
+	gcm, err := v.gcm()
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, nonce, data, nil)
+}
+
+// save encrypts the secrets and writes them atomically (temp file + rename),
+// so a crash mid-write can't leave a half-written vault behind. Caller holds v.mu.
+func (v *Vault) save() error {
+	plain, err := json.Marshal(v.secrets)
+	if err != nil {
+		return err
+	}
+	gcm, err := v.gcm()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("could not generate nonce: %w", err)
+	}
+
+	data, err := json.MarshalIndent(fileFormat{
+		Version: 1,
+		Salt:    v.salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plain, nil),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("could not write vault: %w", err)
+	}
+	if err := os.Rename(tmp, v.path); err != nil {
+		return fmt.Errorf("could not write vault: %w", err)
+	}
+	return nil
+}
+
+// Set stores (or replaces) a secret and saves the vault.
+func (v *Vault) Set(site, key, value string) error {
+	site, key = strings.TrimSpace(site), strings.TrimSpace(key)
+	if site == "" || key == "" {
+		return fmt.Errorf("site and key are required")
+	}
+	if strings.Contains(key, ".") {
+		return fmt.Errorf("key %q must not contain a dot", key)
+	}
+	if key == TOTPKey {
+		// Catch typos now rather than at the 2FA prompt halfway through a task
+		if _, err := parseSeed(value); err != nil {
+			return err
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.secrets[site] == nil {
+		v.secrets[site] = map[string]string{}
+	}
+	v.secrets[site][key] = value
+	return v.save()
+}
+
+// Get returns a secret's value.
+func (v *Vault) Get(site, key string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	value, ok := v.secrets[site][key]
+	if !ok {
+		return "", fmt.Errorf("no secret %s.%s in the vault", site, key)
+	}
+	return value, nil
+}
+
+// Delete removes a secret and saves the vault.
+func (v *Vault) Delete(site, key string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.secrets[site][key]; !ok {
+		return fmt.Errorf("no secret %s.%s in the vault", site, key)
+	}
+	delete(v.secrets[site], key)
+	if len(v.secrets[site]) == 0 {
+		delete(v.secrets, site)
+	}
+	return v.save()
+}
+
+// List returns the names of all secrets, sorted, without their values.
+func (v *Vault) List() []domain.SecretRef {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var refs []domain.SecretRef
+	for site, keys := range v.secrets {
+		for key := range keys {
+			refs = append(refs, domain.SecretRef{Site: site, Key: key})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Site != refs[j].Site {
+			return refs[i].Site < refs[j].Site
+		}
+		return refs[i].Key < refs[j].Key
+	})
+	return refs
+}
+
+// SetAliases lets a site's secrets be used on other hosts too, e.g. "github" -> ["github.com"]
+// or "bank" -> ["login.mybank.com"]. Aliases are config, not secrets, so they aren't saved in the vault.
+func (v *Vault) SetAliases(aliases map[string][]string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.aliases = aliases
+}
+
+// CheckSite returns an error unless the page at host belongs to site: the host is the
+// site itself, a subdomain of it, or (a subdomain of) one of the site's aliases.
+// Without it a page could get the model to type another site's password into it.
+func (v *Vault) CheckSite(site, host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return fmt.Errorf("secrets for %s can only be used on a web page", site)
+	}
+	v.mu.Lock()
+	names := append([]string{site}, v.aliases[site]...)
+	v.mu.Unlock()
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if host == name || strings.HasSuffix(host, "."+name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("secrets for %s can't be used on %s", site, host)
+}
+
+// Resolve implements ports.SecretStore. It replaces every {{secret:site.key}}
+// placeholder in text with the stored value. Unknown secrets are an error, so the
+// agent never types a literal placeholder into a login form, and so is a secret for
+// another site than the page's host (see CheckSite).
+// A TOTP seed resolves to the current one-time code, never to the seed itself.
+func (v *Vault) Resolve(text, host string) (string, error) {
+	var missing, refused []string
+	resolved := placeholder.ReplaceAllStringFunc(text, func(match string) string {
+		parts := placeholder.FindStringSubmatch(match)
+		if err := v.CheckSite(parts[1], host); err != nil {
+			refused = append(refused, parts[1]+"."+parts[2])
+			return match
+		}
+		var value string
+		var err error
+		if parts[2] == TOTPKey {
+			value, err = v.OTP(parts[1])
+		} else {
+			value, err = v.Get(parts[1], parts[2])
+		}
+		if err != nil {
+			missing = append(missing, parts[1]+"."+parts[2])
+			return match
+		}
+		return value
+	})
+	if len(refused) > 0 {
+		if host == "" {
+			host = "this page"
+		}
+		return "", fmt.Errorf("secret(s) %s can't be used on %s: they belong to another site", strings.Join(refused, ", "), host)
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unknown secret(s): %s", strings.Join(missing, ", "))
+	}
+	return resolved, nil
+}
+
+// HasPlaceholder reports whether text contains a {{secret:...}} placeholder.
+func HasPlaceholder(text string) bool {
+	return placeholder.MatchString(text)
+}
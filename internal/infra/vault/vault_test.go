@@ -0,0 +1,135 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVaultRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+
+	v, err := Open(path, "correct horse")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := v.Set("github.com", "password", "hunter2"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// The value must not be readable in the file itself
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "hunter2") {
+		t.Error("Vault file contains the secret in plain text")
+	}
+
+	// Re-open with the same passphrase
+	v2, err := Open(path, "correct horse")
+	if err != nil {
+		t.Fatalf("Re-open failed: %v", err)
+	}
+	if got, _ := v2.Get("github.com", "password"); got != "hunter2" {
+		t.Errorf("Expected hunter2, got %q", got)
+	}
+
+	// And with the wrong one
+	if _, err := Open(path, "wrong"); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected ErrWrongKey, got %v", err)
+	}
+}
+
+func TestVaultKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+
+	v, err := Open(path, "")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	v.Set("example.com", "user", "alice")
+
+	if _, err := os.Stat(path + ".key"); err != nil {
+		t.Fatalf("Expected a key file to be created: %v", err)
+	}
+	v2, err := Open(path, "")
+	if err != nil {
+		t.Fatalf("Re-open failed: %v", err)
+	}
+	if got, _ := v2.Get("example.com", "user"); got != "alice" {
+		t.Errorf("Expected alice, got %q", got)
+	}
+}
+
+func TestVaultResolveRefusesOtherSites(t *testing.T) {
+	v, err := Open(filepath.Join(t.TempDir(), "vault.json"), "pass")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	v.Set("github.com", "password", "hunter2")
+	v.Set("bank", "pin", "1234")
+	v.SetAliases(map[string][]string{"bank": {"login.mybank.com"}})
+
+	cases := map[string]bool{
+		"github.com":            true,
+		"gist.github.com":       true, // Subdomains belong to the site
+		"GitHub.com":            true,
+		"github.com.evil.com":   false,
+		"evilgithub.com":        false,
+		"login.mybank.com":      false, // Another site's alias
+		"":                      false, // about:blank, data: URLs
+		"attacker.example.test": false,
+	}
+	for host, allowed := range cases {
+		got, err := v.Resolve("{{secret:github.com.password}}", host)
+		if allowed && (err != nil || got != "hunter2") {
+			t.Errorf("Expected the password on %q, got %q, %v", host, got, err)
+		}
+		if !allowed && (err == nil || strings.Contains(got, "hunter2") || strings.Contains(err.Error(), "hunter2")) {
+			t.Errorf("Expected the password to be refused on %q, got %q, %v", host, got, err)
+		}
+	}
+
+	// Sites that aren't host names work through aliases
+	if got, err := v.Resolve("{{secret:bank.pin}}", "login.mybank.com"); err != nil || got != "1234" {
+		t.Errorf("Expected the alias to allow the PIN, got %q, %v", got, err)
+	}
+	if _, err := v.Resolve("{{secret:bank.pin}}", "mybank.com"); err == nil {
+		t.Error("Expected the PIN to be refused outside its alias")
+	}
+
+	v.Set("github.com", TOTPKey, "JBSWY3DPEHPK3PXP")
+	if _, err := v.OTPFor("github.com", "evil.com"); err == nil {
+		t.Error("Expected the one-time code to be refused on another site")
+	}
+	if _, err := v.OTPFor("github.com", "github.com"); err != nil {
+		t.Errorf("Expected a one-time code on github.com, got %v", err)
+	}
+}
+
+func TestVaultResolve(t *testing.T) {
+	v, err := Open(filepath.Join(t.TempDir(), "vault.json"), "pass")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	v.Set("github.com", "password", "hunter2")
+
+	got, err := v.Resolve("{{secret:github.com.password}}!", "github.com")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if got != "hunter2!" {
+		t.Errorf("Expected hunter2!, got %q", got)
+	}
+
+	if _, err := v.Resolve("{{secret:gitlab.com.password}}", "gitlab.com"); err == nil {
+		t.Error("Expected error for unknown secret")
+	}
+
+	if err := v.Delete("github.com", "password"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if len(v.List()) != 0 {
+		t.Errorf("Expected empty vault, got %v", v.List())
+	}
+}